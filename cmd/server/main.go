@@ -1,16 +1,37 @@
 package main
 
 import (
+	"faq-search-ai/internal/account"
+	"faq-search-ai/internal/analysis"
+	"faq-search-ai/internal/auth"
 	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/faq"
 	"faq-search-ai/internal/vector"
 	"log"
 	"net/http"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
 	config.LoadEnv()
+	auth.AccessTokenTTL = config.AccessTokenTTL
+	auth.RefreshTokenTTL = config.RefreshTokenTTL
+	if config.PasswordHashMemory > 0 {
+		auth.PasswordHashParams.Memory = config.PasswordHashMemory
+	}
+	if config.PasswordHashIterations > 0 {
+		auth.PasswordHashParams.Iterations = config.PasswordHashIterations
+	}
+	if config.PasswordHashParallelism > 0 {
+		auth.PasswordHashParams.Parallelism = config.PasswordHashParallelism
+	}
+	keys, err := loadKeys()
+	if err != nil {
+		log.Fatalf("JWT 署名鍵の読み込み失敗: %v", err)
+	}
+	auth.UseKeyManager(keys)
 
 	db, err := config.InitDB()
 	if err != nil {
@@ -18,10 +39,39 @@ func main() {
 	}
 	defer db.Close()
 
-	if err := vector.InitQdrantCollection(); err != nil {
+	if err := analysis.Init(); err != nil {
+		log.Fatalf("形態素解析辞書の読み込み失敗: %v", err)
+	}
+	if n, err := auth.NewRepository(db).PromoteAdmins(config.AdminEmails); err != nil {
+		log.Fatalf("管理者の設定失敗: %v", err)
+	} else if n > 0 {
+		log.Printf("%d 人のユーザーを管理者にしました", n)
+	}
+	if err := faq.EnsureKeywordIndex(db); err != nil {
+		log.Fatalf("全文検索インデックスの初期化失敗: %v", err)
+	}
+
+	if err := vector.InitCollections(db, faq.ReindexSource(db)); err != nil {
 		log.Fatalf("Qdrant 初期化失敗: %v", err)
 	}
+	// Qdrant の更新に失敗しても次回起動時にやり直すので起動は続ける
+	if err := faq.EnsureWorkspaces(db); err != nil {
+		log.Printf("ワークスペースの移行失敗: %v", err)
+	} else if err := faq.EnsureKnowledgeBases(db); err != nil {
+		log.Printf("ナレッジベースの移行失敗: %v", err)
+	}
+
+	faq.StartTrashSweeper(db, config.TrashRetention, time.Hour)
+	account.StartDeletionSweeper(db, time.Hour)
 
 	log.Printf("Server running at :%s\n", config.Port)
 	log.Fatal(http.ListenAndServe(":"+config.Port, SetupRouter(db)))
 }
+
+// loadKeys は JWT_SIGNING_KEY があれば非対称鍵、無ければ JWT_SECRET の HS256 を使う
+func loadKeys() (*auth.KeyManager, error) {
+	if config.JWTSigningKey == "" {
+		return auth.NewHMACKeyManager([]byte(config.JWTSecret))
+	}
+	return auth.LoadKeyManager(config.JWTSigningKey, config.JWTVerificationKeys)
+}
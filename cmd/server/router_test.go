@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"faq-search-ai/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupRouter(t *testing.T) http.Handler {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return SetupRouter(db)
+}
+
+func TestSetupRouter_VersionedAndLegacyPaths(t *testing.T) {
+	router := setupRouter(t)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/signup", "{", http.StatusBadRequest},
+		{"GET", "/faqs/search?q=x", "", http.StatusUnauthorized},
+		{"GET", "/workspaces", "", http.StatusUnauthorized},
+		{"GET", "/admin/users", "", http.StatusUnauthorized},
+	} {
+		// 同じハンドラーに届き、旧パスにだけ移行先が付く
+		rr := serve(tc.method, apiPrefix+tc.path, tc.body)
+		if rr.Code != tc.want {
+			t.Errorf("%s %s%s: expected %d, got %d", tc.method, apiPrefix, tc.path, tc.want, rr.Code)
+		}
+		if rr.Header().Get("Deprecation") != "" || rr.Header().Get("Link") != "" {
+			t.Errorf("%s %s%s: unexpected deprecation headers %v", tc.method, apiPrefix, tc.path, rr.Header())
+		}
+
+		rr = serve(tc.method, tc.path, tc.body)
+		if rr.Code != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.want, rr.Code)
+		}
+		path, _, _ := strings.Cut(tc.path, "?")
+		if got := rr.Header().Get("Deprecation"); got != "true" {
+			t.Errorf("%s %s: expected Deprecation true, got %q", tc.method, tc.path, got)
+		}
+		if got, want := rr.Header().Get("Link"), "<"+apiPrefix+path+`>; rel="successor-version"`; got != want {
+			t.Errorf("%s %s: expected Link %q, got %q", tc.method, tc.path, want, got)
+		}
+	}
+
+	if rr := serve("DELETE", apiPrefix+"/signup", ""); rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "POST" {
+		t.Errorf("wrong method: expected 405 allowing POST, got %d %q", rr.Code, rr.Header().Get("Allow"))
+	}
+	if rr := serve("GET", apiPrefix+"/nope", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown path: expected 404, got %d", rr.Code)
+	}
+	// プリフライトはどのパスでもルーターの手前で応答する
+	if rr := serve("OPTIONS", apiPrefix+"/faqs", ""); rr.Code != http.StatusOK {
+		t.Errorf("preflight: expected 200, got %d", rr.Code)
+	}
+}
@@ -2,26 +2,143 @@ package main
 
 import (
 	"database/sql"
+	"faq-search-ai/internal/account"
+	"faq-search-ai/internal/audit"
 	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
 	"faq-search-ai/internal/faq"
 	"faq-search-ai/internal/middleware"
+	"faq-search-ai/internal/workspace"
 	"net/http"
+	"strings"
 )
 
+// apiPrefix は API のバージョンを表すパスの接頭辞
+const apiPrefix = "/api/v1"
+
+// routes は同じミドルウェアを通すルートをまとめて登録する
+type routes struct {
+	mux         *http.ServeMux
+	middlewares []middleware.Middleware
+}
+
+// With は middlewares を後ろに足したグループを返す
+func (g routes) With(middlewares ...middleware.Middleware) routes {
+	g.middlewares = append(g.middlewares[:len(g.middlewares):len(g.middlewares)], middlewares...)
+	return g
+}
+
+// Handle は "METHOD /path" を apiPrefix の下に登録する。
+// 旧パスも非推奨の別名として残し、Deprecation ヘッダーで移行先を知らせる
+func (g routes) Handle(pattern string, h http.HandlerFunc) {
+	method, path, _ := strings.Cut(pattern, " ")
+	handler := middleware.Chain(h, g.middlewares...)
+	g.mux.Handle(method+" "+apiPrefix+path, handler)
+	g.mux.Handle(pattern, middleware.Deprecated(apiPrefix)(handler))
+}
+
 func SetupRouter(db *sql.DB) http.Handler {
 	mux := http.NewServeMux()
 	authHandler := auth.NewAuthHandler(db)
+	oidcHandler := auth.NewOIDCHandler(db, config.OIDCProviders)
+
+	// 鍵の配布場所は仕様で決まっているのでバージョンを付けない
+	mux.HandleFunc("GET /.well-known/jwks.json", auth.HandleJWKS)
 
 	// Public
-	mux.Handle("/signup", middleware.WithCORS(http.HandlerFunc(authHandler.Signup)))
-	mux.Handle("/login", middleware.WithCORS(http.HandlerFunc(authHandler.Login)))
+	public := routes{mux: mux}
+	public.Handle("POST /signup", authHandler.Signup)
+	public.Handle("POST /login", authHandler.Login)
+	public.Handle("POST /login/mfa", authHandler.LoginMFA)
+	public.Handle("POST /token/refresh", authHandler.Refresh)
+	public.Handle("POST /verify-email", authHandler.VerifyEmail)
+	public.Handle("POST /password/forgot", authHandler.ForgotPassword)
+	public.Handle("POST /password/reset", authHandler.ResetPassword)
+	public.Handle("GET /auth/oidc", oidcHandler.ListProviders)
+	public.Handle("GET /auth/oidc/{provider}/login", oidcHandler.Login)
+	public.Handle("GET /auth/oidc/{provider}/callback", oidcHandler.Callback)
 
 	// Protect
-	mux.Handle("/me", middleware.WithCORS(auth.JWTAuthMiddleware(http.HandlerFunc(authHandler.Me))))
+	protected := public.With(auth.JWTAuthMiddleware(authHandler.Repo))
+	protected.Handle("POST /logout", authHandler.Logout)
+	protected.Handle("POST /verify-email/request", authHandler.RequestEmailVerification)
+	protected.Handle("GET /me/sessions", authHandler.ListSessions)
+	protected.Handle("DELETE /me/sessions", authHandler.RevokeOtherSessions)
+	protected.Handle("DELETE /me/sessions/{id}", authHandler.RevokeSession)
+	protected.Handle("GET /me/export", account.HandleExport(db))
+	protected.Handle("GET /me/deletion", account.HandleGetDeletion(db))
+
+	// 管理者の代理ログインでは認証情報の変更や退会はできない
+	owner := protected.With(auth.RejectImpersonation)
+	owner.Handle("POST /me/password", authHandler.ChangePassword)
+	owner.Handle("POST /me/deletion", account.HandleScheduleDeletion(db, authHandler.Mailer))
+	owner.Handle("DELETE /me/deletion", account.HandleCancelDeletion(db))
+	owner.Handle("GET /me/mfa", authHandler.MFAStatus)
+	owner.Handle("DELETE /me/mfa", authHandler.DisableMFA)
+	owner.Handle("POST /me/mfa/enroll", authHandler.EnrollMFA)
+	owner.Handle("POST /me/mfa/verify", authHandler.VerifyMFA)
+	owner.Handle("POST /me/mfa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+	owner.Handle("GET /api-keys", authHandler.ListAPIKeys)
+	owner.Handle("POST /api-keys", authHandler.CreateAPIKey)
+	owner.Handle("DELETE /api-keys/{id}", authHandler.RevokeAPIKey)
+
+	admin := protected.With(authHandler.RequireAdmin)
+	admin.Handle("GET /admin/lockouts", authHandler.ListLockouts)
+	admin.Handle("POST /admin/lockouts/unlock", authHandler.Unlock)
+	admin.Handle("GET /admin/audit-log", audit.HandleAuditLog(db))
+	admin.Handle("GET /admin/audit-log/export", audit.HandleAuditLogExport(db))
+	admin.Handle("GET /admin/users", authHandler.ListUsers)
+	admin.Handle("GET /admin/users/{id}", authHandler.GetUser)
+	admin.Handle("PATCH /admin/users/{id}", authHandler.UpdateUser)
+	admin.Handle("POST /admin/users/{id}/disable", authHandler.DisableUser)
+	admin.Handle("POST /admin/users/{id}/enable", authHandler.EnableUser)
+	admin.Handle("POST /admin/users/{id}/reset-credentials", authHandler.ResetUserCredentials)
+	admin.Handle("POST /admin/users/{id}/impersonate", authHandler.ImpersonateUser)
+
+	// FAQ の操作は API キーでも行える。アカウントやワークスペースの管理は JWT のみ
+	read := public.With(auth.APIKeyOrJWTMiddleware(db, auth.RequireScope(auth.ScopeRead)))
+	ask := public.With(auth.APIKeyOrJWTMiddleware(db, auth.RequireScope(auth.ScopeAsk)))
+	readWrite := public.With(auth.APIKeyOrJWTMiddleware(db, auth.ReadWriteScope))
+
+	read.Handle("GET /me", authHandler.Me)
+	read.Handle("GET /faqs/search", faq.HandleSearchFAQ(db))
+	ask.Handle("POST /faqs/ask", faq.HandleAskFAQ(db))
+
+	readWrite.Handle("GET /faqs", faq.HandleListFAQs(db))
+	readWrite.Handle("POST /faqs", faq.HandleCreateFAQ(db))
+	readWrite.Handle("GET /faqs/{id}", faq.HandleGetFAQ(db))
+	readWrite.Handle("PUT /faqs/{id}", faq.HandleUpdateFAQ(db))
+	readWrite.Handle("PATCH /faqs/{id}", faq.HandleUpdateFAQ(db))
+	readWrite.Handle("DELETE /faqs/{id}", faq.HandleDeleteFAQ(db))
+	readWrite.Handle("GET /faqs/{id}/draft", faq.HandleGetDraft(db))
+	readWrite.Handle("PUT /faqs/{id}/draft", faq.HandleSaveDraft(db))
+	readWrite.Handle("DELETE /faqs/{id}/draft", faq.HandleDeleteDraft(db))
+	readWrite.Handle("POST /faqs/{id}/{action}", faq.HandleTransition(db))
+	readWrite.Handle("GET /faqs/{id}/revisions", faq.HandleListRevisions(db))
+	readWrite.Handle("GET /faqs/{id}/revisions/diff", faq.HandleDiffRevisions(db))
+	readWrite.Handle("POST /faqs/{id}/revisions/{rev}/revert", faq.HandleRevertFAQ(db))
+	readWrite.Handle("GET /trash", faq.HandleListTrash(db))
+	readWrite.Handle("POST /trash/{id}/restore", faq.HandleRestoreFAQ(db))
+	readWrite.Handle("DELETE /trash/{id}", faq.HandlePurgeFAQ(db))
+	readWrite.Handle("GET /knowledge-bases", faq.HandleListKnowledgeBases(db))
+	readWrite.Handle("POST /knowledge-bases", faq.HandleCreateKnowledgeBase(db))
+	readWrite.Handle("GET /knowledge-bases/{id}", faq.HandleGetKnowledgeBase(db))
+	readWrite.Handle("PATCH /knowledge-bases/{id}", faq.HandleUpdateKnowledgeBase(db))
+	readWrite.Handle("DELETE /knowledge-bases/{id}", faq.HandleDeleteKnowledgeBase(db))
 
-	mux.Handle("/faqs/ask", middleware.WithCORS(auth.JWTAuthMiddleware(http.HandlerFunc(faq.HandleAskFAQ(db)))))
-	mux.Handle("/faqs", middleware.WithCORS(auth.JWTAuthMiddleware(http.HandlerFunc(faq.HandleFAQListOrCreate(db)))))
-	mux.Handle("/faqs/", middleware.WithCORS(auth.JWTAuthMiddleware(http.HandlerFunc(faq.HandleFAQDetail(db)))))
+	protected.Handle("GET /workspaces", workspace.HandleListWorkspaces(db))
+	protected.Handle("POST /workspaces", workspace.HandleCreateWorkspace(db))
+	protected.Handle("GET /workspaces/{id}", workspace.HandleGetWorkspace(db))
+	protected.Handle("PATCH /workspaces/{id}", workspace.HandleRenameWorkspace(db))
+	protected.Handle("DELETE /workspaces/{id}", workspace.HandleDeleteWorkspace(db))
+	protected.Handle("GET /workspaces/{id}/members", workspace.HandleListMembers(db))
+	protected.Handle("PATCH /workspaces/{id}/members/{user_id}", workspace.HandleUpdateMember(db))
+	protected.Handle("DELETE /workspaces/{id}/members/{user_id}", workspace.HandleRemoveMember(db))
+	protected.Handle("GET /workspaces/{id}/invitations", workspace.HandleListInvitations(db))
+	protected.Handle("POST /workspaces/{id}/invitations", workspace.HandleCreateInvitation(db))
+	protected.Handle("DELETE /workspaces/{id}/invitations/{invitation_id}", workspace.HandleRevokeInvitation(db))
+	protected.Handle("POST /invitations/accept", workspace.HandleAcceptInvitation(db))
 
-	return mux
+	// プリフライトや 404 / 405 の応答にも CORS ヘッダーを付けるため、ルーター全体を包む
+	return middleware.WithCORS(mux)
 }
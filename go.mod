@@ -9,4 +9,14 @@ require (
 	golang.org/x/crypto v0.39.0
 )
 
-require github.com/google/uuid v1.6.0 // indirect
+require (
+	github.com/google/uuid v1.6.0
+	github.com/ikawaha/kagome-dict/ipa v1.2.0
+	github.com/ikawaha/kagome/v2 v2.9.11
+	golang.org/x/text v0.26.0
+)
+
+require (
+	github.com/ikawaha/kagome-dict v1.1.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+)
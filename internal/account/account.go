@@ -0,0 +1,146 @@
+package account
+
+import (
+	"database/sql"
+	"errors"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/faq"
+	"faq-search-ai/internal/workspace"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrNotScheduled = errors.New("account deletion is not scheduled")
+	// ErrSoleOwner は他のメンバーがいるワークスペースの唯一のオーナーのとき。先にオーナーを引き継いでもらう
+	ErrSoleOwner = errors.New("transfer ownership of shared workspaces before deleting your account")
+)
+
+// Deletion は退会の予約
+type Deletion struct {
+	UserID      int64     `json:"-"`
+	RequestedAt time.Time `json:"requested_at"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+}
+
+// ScheduleDeletion は grace 後の削除を予約する。予約済みなら既存の予約を返す
+func ScheduleDeletion(db *sql.DB, userID int64, grace time.Duration) (*Deletion, error) {
+	shared, err := workspace.SoleOwnedShared(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(shared) > 0 {
+		return nil, ErrSoleOwner
+	}
+
+	now := time.Now()
+	if _, err := db.Exec(`
+		INSERT INTO account_deletions (user_id, requested_at, scheduled_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO NOTHING`, userID, now, now.Add(grace)); err != nil {
+		return nil, err
+	}
+	return GetDeletion(db, userID)
+}
+
+// GetDeletion は予約を返す。予約が無ければ nil
+func GetDeletion(db *sql.DB, userID int64) (*Deletion, error) {
+	d := &Deletion{UserID: userID}
+	err := db.QueryRow(`SELECT requested_at, scheduled_at FROM account_deletions WHERE user_id = ?`, userID).
+		Scan(&d.RequestedAt, &d.ScheduledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// CancelDeletion は予約を取り消す
+func CancelDeletion(db *sql.DB, userID int64) error {
+	result, err := db.Exec(`DELETE FROM account_deletions WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotScheduled
+	}
+	return nil
+}
+
+// DeleteAccount はユーザーのFAQ (Qdrant のポイントを含む)、ワークスペースの所属、ユーザーの行を削除する。
+// 各段階はやり直せるので、途中で失敗しても予約を残して次の回に続きから削除する
+func DeleteAccount(db *sql.DB, userID int64) error {
+	workspaces, err := workspace.SoleMemberWorkspaces(db, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := faq.PurgeUserFAQs(db, userID, workspaces); err != nil {
+		return err
+	}
+	if err := workspace.RemoveUser(db, userID, workspaces); err != nil {
+		return err
+	}
+	if err := auth.NewRepository(db).DeleteUser(userID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM account_deletions WHERE user_id = ?`, userID)
+	return err
+}
+
+// PurgeDueAccounts は予約日時を過ぎたアカウントを削除し、件数を返す。失敗したアカウントのエラーはまとめて返す
+func PurgeDueAccounts(db *sql.DB, now time.Time) (int, error) {
+	rows, err := db.Query(`SELECT user_id FROM account_deletions WHERE scheduled_at <= ? ORDER BY scheduled_at`, now)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// 1件の失敗 (Qdrant に繋がらないなど) で後の予約を止めないよう、失敗した分は次の回に回して続ける
+	deleted := 0
+	var errs []error
+	for _, id := range ids {
+		if err := DeleteAccount(db, id); err != nil {
+			log.Printf("failed to delete account %d: %v", id, err)
+			errs = append(errs, fmt.Errorf("account %d: %w", id, err))
+			continue
+		}
+		deleted++
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// StartDeletionSweeper は interval ごとに予約日時を過ぎたアカウントを削除する
+func StartDeletionSweeper(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			n, err := PurgeDueAccounts(db, time.Now())
+			if err != nil {
+				log.Printf("account deletion sweep failed: %v", err)
+			}
+			if n > 0 {
+				log.Printf("account deletion sweep removed %d accounts", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
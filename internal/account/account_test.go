@@ -0,0 +1,386 @@
+package account_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"faq-search-ai/internal/account"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/mail"
+	"faq-search-ai/internal/model"
+	"faq-search-ai/internal/workspace"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	return db
+}
+
+// createUser はパスワード "pass1234word" のユーザーと個人用ワークスペースを作る
+func createUser(t *testing.T, db *sql.DB, email string) (int64, int64) {
+	hash, err := auth.HashPassword("pass1234word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := db.Exec(`INSERT INTO users (email, username, password_hash) VALUES (?, ?, ?)`, email, email, hash)
+	if err != nil {
+		t.Fatalf("failed to insert user: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	ws, err := workspace.EnsurePersonal(db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, ws
+}
+
+type nopMailer struct{ sent []mail.Message }
+
+func (m *nopMailer) Send(msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func serve(h http.HandlerFunc, userID int64, method string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, "/me/deletion", &buf)
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, userID))
+	rr := httptest.NewRecorder()
+	h(rr, req)
+	return rr
+}
+
+// stubQdrant は削除されたポイントの ID を記録する
+func stubQdrant(t *testing.T) func() []string {
+	var mu sync.Mutex
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/points/delete") {
+			var body struct {
+				Points []string `json:"points"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			deleted = append(deleted, body.Points...)
+			mu.Unlock()
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	old := config.QdrantURL
+	config.QdrantURL = server.URL
+	t.Cleanup(func() {
+		config.QdrantURL = old
+		server.Close()
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		ids := append([]string(nil), deleted...)
+		sort.Strings(ids)
+		return ids
+	}
+}
+
+func TestHandleExport(t *testing.T) {
+	db := setupTestDB(t)
+	userID, ws := createUser(t, db, "a@example.com")
+	if _, err := db.Exec(`INSERT INTO faqs (id, workspace_id, user_id, question, answer) VALUES ('faq-1', ?, ?, 'Q', 'A')`, ws, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/me/export", nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, userID))
+	rr := httptest.NewRecorder()
+	account.HandleExport(db)(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		buf.ReadFrom(rc)
+		rc.Close()
+		files[f.Name] = buf.Bytes()
+	}
+	for _, name := range []string{"account.json", "faqs.json", "revisions.json", "workspaces.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+	if !bytes.Contains(files["account.json"], []byte(`"email": "a@example.com"`)) {
+		t.Errorf("account.json does not include the profile: %s", files["account.json"])
+	}
+	if bytes.Contains(files["account.json"], []byte("argon2id")) {
+		t.Error("account.json must not include the password hash")
+	}
+	var faqs []model.FAQ
+	if err := json.Unmarshal(files["faqs.json"], &faqs); err != nil || len(faqs) != 1 || faqs[0].ID != "faq-1" {
+		t.Errorf("unexpected faqs.json: %s", files["faqs.json"])
+	}
+}
+
+// deletionRoutes は /me/deletion の3つのハンドラーを本番と同じメソッドで振り分ける
+func deletionRoutes(db *sql.DB, mailer mail.Mailer) http.HandlerFunc {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /me/deletion", account.HandleGetDeletion(db))
+	mux.HandleFunc("POST /me/deletion", account.HandleScheduleDeletion(db, mailer))
+	mux.HandleFunc("DELETE /me/deletion", account.HandleCancelDeletion(db))
+	return mux.ServeHTTP
+}
+
+func TestHandleDeletion_ScheduleAndCancel(t *testing.T) {
+	db := setupTestDB(t)
+	userID, _ := createUser(t, db, "a@example.com")
+	mailer := &nopMailer{}
+	h := deletionRoutes(db, mailer)
+
+	if rr := serve(h, userID, "GET", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 before scheduling, got %d", rr.Code)
+	}
+	if rr := serve(h, userID, "POST", map[string]string{"password": "wrong-password"}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for wrong password, got %d", rr.Code)
+	}
+
+	rr := serve(h, userID, "POST", map[string]string{"password": "pass1234word"})
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var d account.Deletion
+	json.NewDecoder(rr.Body).Decode(&d)
+	if got := d.ScheduledAt.Sub(d.RequestedAt); got != config.AccountDeletionGrace {
+		t.Errorf("expected grace %v, got %v", config.AccountDeletionGrace, got)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "a@example.com" {
+		t.Errorf("expected a notice mail, got %+v", mailer.sent)
+	}
+
+	// 予約済みなら日時は変わらない
+	rr = serve(h, userID, "POST", map[string]string{"password": "pass1234word"})
+	var again account.Deletion
+	json.NewDecoder(rr.Body).Decode(&again)
+	if !again.ScheduledAt.Equal(d.ScheduledAt) {
+		t.Errorf("rescheduling moved the date: %v -> %v", d.ScheduledAt, again.ScheduledAt)
+	}
+
+	if rr := serve(h, userID, "DELETE", nil); rr.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rr.Code)
+	}
+	if rr := serve(h, userID, "DELETE", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after cancel, got %d", rr.Code)
+	}
+	if n, err := account.PurgeDueAccounts(db, time.Now().Add(365*24*time.Hour)); err != nil || n != 0 {
+		t.Errorf("cancelled deletion was purged: n=%d err=%v", n, err)
+	}
+}
+
+func TestHandleDeletion_SoleOwnerOfSharedWorkspace(t *testing.T) {
+	db := setupTestDB(t)
+	owner, _ := createUser(t, db, "owner@example.com")
+	member, _ := createUser(t, db, "member@example.com")
+	ws := &model.Workspace{Name: "team", CreatedBy: owner}
+	if err := workspace.CreateWorkspace(db, ws); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO workspace_members (workspace_id, user_id, role) VALUES (?, ?, ?)`, ws.ID, member, model.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+
+	h := deletionRoutes(db, &nopMailer{})
+	if rr := serve(h, owner, "POST", map[string]string{"password": "pass1234word"}); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for sole owner, got %d", rr.Code)
+	}
+	// メンバーは退会できる
+	if rr := serve(h, member, "POST", map[string]string{"password": "pass1234word"}); rr.Code != http.StatusAccepted {
+		t.Errorf("expected 202 for member, got %d", rr.Code)
+	}
+}
+
+func TestPurgeDueAccounts(t *testing.T) {
+	db := setupTestDB(t)
+	deleted := stubQdrant(t)
+	userID, personal := createUser(t, db, "a@example.com")
+	other, otherWS := createUser(t, db, "b@example.com")
+
+	for _, f := range []struct {
+		id     string
+		ws     int64
+		author int64
+	}{
+		{"mine-1", personal, userID},
+		{"mine-2", personal, userID},
+		{"theirs", otherWS, other},
+	} {
+		if _, err := db.Exec(`INSERT INTO faqs (id, workspace_id, user_id, question, answer) VALUES (?, ?, ?, 'Q', 'A')`, f.id, f.ws, f.author); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := account.ScheduleDeletion(db, userID, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := account.PurgeDueAccounts(db, time.Now()); err != nil || n != 0 {
+		t.Fatalf("purged before the grace period: n=%d err=%v", n, err)
+	}
+	n, err := account.PurgeDueAccounts(db, time.Now().Add(2*time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 purged account, got n=%d err=%v", n, err)
+	}
+
+	if got := deleted(); len(got) != 2 || got[0] != "mine-1" || got[1] != "mine-2" {
+		t.Errorf("unexpected Qdrant deletions: %v", got)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM users WHERE id = ` + itoa(userID):                  0,
+		`SELECT COUNT(*) FROM faqs WHERE user_id = ` + itoa(userID):              0,
+		`SELECT COUNT(*) FROM workspaces WHERE id = ` + itoa(personal):           0,
+		`SELECT COUNT(*) FROM workspace_members WHERE user_id = ` + itoa(userID): 0,
+		`SELECT COUNT(*) FROM account_deletions`:                                 0,
+		`SELECT COUNT(*) FROM faqs WHERE id = 'theirs'`:                          1,
+		`SELECT COUNT(*) FROM users WHERE id = ` + itoa(other):                   1,
+	} {
+		var got int
+		if err := db.QueryRow(query).Scan(&got); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %d, got %d", query, want, got)
+		}
+	}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func TestDeleteAccount_KeepsSharedWorkspaceFAQs(t *testing.T) {
+	db := setupTestDB(t)
+	deleted := stubQdrant(t)
+	owner, _ := createUser(t, db, "owner@example.com")
+	member, personal := createUser(t, db, "member@example.com")
+	ws := &model.Workspace{Name: "team", CreatedBy: owner}
+	if err := workspace.CreateWorkspace(db, ws); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO workspace_members (workspace_id, user_id, role) VALUES (?, ?, ?)`, ws.ID, member, model.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []struct {
+		id     string
+		ws     int64
+		author int64
+	}{
+		{"private", personal, member},
+		{"team-by-member", ws.ID, member},
+		{"team-by-owner", ws.ID, owner},
+	} {
+		if _, err := db.Exec(`INSERT INTO faqs (id, workspace_id, user_id, question, answer) VALUES (?, ?, ?, 'Q', 'A')`, f.id, f.ws, f.author); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := account.DeleteAccount(db, member); err != nil {
+		t.Fatalf("DeleteAccount failed: %v", err)
+	}
+
+	// チームのFAQは残り、退会したメンバーのものはオーナーに引き継がれる
+	if got := deleted(); len(got) != 1 || got[0] != "private" {
+		t.Errorf("unexpected Qdrant deletions: %v", got)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM faqs WHERE id = 'private'`:                                     0,
+		`SELECT COUNT(*) FROM faqs WHERE workspace_id = ` + itoa(ws.ID):                      2,
+		`SELECT COUNT(*) FROM faqs WHERE id = 'team-by-member' AND user_id = ` + itoa(owner): 1,
+		`SELECT COUNT(*) FROM workspace_members WHERE workspace_id = ` + itoa(ws.ID):         1,
+		`SELECT COUNT(*) FROM users WHERE id = ` + itoa(member):                              0,
+	} {
+		var got int
+		if err := db.QueryRow(query).Scan(&got); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %d, got %d", query, want, got)
+		}
+	}
+}
+
+func TestPurgeDueAccounts_ContinuesAfterFailure(t *testing.T) {
+	db := setupTestDB(t)
+	// "broken" のポイントの削除だけ失敗させる
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "broken") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	old := config.QdrantURL
+	config.QdrantURL = server.URL
+	t.Cleanup(func() {
+		config.QdrantURL = old
+		server.Close()
+	})
+
+	first, firstWS := createUser(t, db, "a@example.com")
+	second, _ := createUser(t, db, "b@example.com")
+	if _, err := db.Exec(`INSERT INTO faqs (id, workspace_id, user_id, question, answer) VALUES ('broken', ?, ?, 'Q', 'A')`, firstWS, first); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{first, second} {
+		if _, err := account.ScheduleDeletion(db, id, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := account.PurgeDueAccounts(db, time.Now().Add(2*time.Hour))
+	if err == nil || n != 1 {
+		t.Fatalf("expected 1 purged account and an error, got n=%d err=%v", n, err)
+	}
+	var remaining []int64
+	rows, _ := db.Query(`SELECT user_id FROM account_deletions`)
+	for rows.Next() {
+		var id int64
+		rows.Scan(&id)
+		remaining = append(remaining, id)
+	}
+	rows.Close()
+	if len(remaining) != 1 || remaining[0] != first {
+		t.Errorf("expected only the failed account to stay scheduled, got %v", remaining)
+	}
+}
@@ -0,0 +1,184 @@
+package account
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/faq"
+	"faq-search-ai/internal/mail"
+	"faq-search-ai/internal/workspace"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// HandleExport は GET /me/export で自分のデータを zip で返す。
+// プロフィールとログインの記録、作成したFAQ、変更履歴、所属するワークスペースを含む
+func HandleExport(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(auth.UserIDContextKey).(int64)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// 書き始めるとエラーを返せないので、先に全て読み込む
+		files, err := exportFiles(db, userID)
+		if err != nil {
+			log.Printf("export error: %v", err)
+			http.Error(w, "Failed to export data", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="faq-search-ai-export-%s.zip"`, time.Now().Format("20060102")))
+		archive := zip.NewWriter(w)
+		for _, f := range files {
+			fw, err := archive.Create(f.name)
+			if err != nil {
+				log.Printf("export error: %v", err)
+				return
+			}
+			enc := json.NewEncoder(fw)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(f.data); err != nil {
+				log.Printf("export error: %v", err)
+				return
+			}
+		}
+		if err := archive.Close(); err != nil {
+			log.Printf("export error: %v", err)
+		}
+	}
+}
+
+type exportFile struct {
+	name string
+	data interface{}
+}
+
+func exportFiles(db *sql.DB, userID int64) ([]exportFile, error) {
+	account, err := auth.NewRepository(db).GetPersonalData(userID)
+	if err != nil {
+		return nil, err
+	}
+	faqs, err := faq.GetFAQsByAuthor(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := faq.GetRevisionsByAuthor(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	workspaces, err := workspace.ListWorkspaces(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	deletion, err := GetDeletion(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return []exportFile{
+		{"account.json", map[string]interface{}{"account": account, "deletion": deletion}},
+		{"faqs.json", faqs},
+		{"revisions.json", revisions},
+		{"workspaces.json", workspaces},
+	}, nil
+}
+
+// HandleGetDeletion は GET /me/deletion で退会の予約を返す
+func HandleGetDeletion(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(auth.UserIDContextKey).(int64)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		d, err := GetDeletion(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch deletion", http.StatusInternalServerError)
+			return
+		}
+		if d == nil {
+			http.Error(w, ErrNotScheduled.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d)
+	}
+}
+
+// HandleScheduleDeletion は POST /me/deletion {"password"} で猶予期間の後に削除するよう予約する
+func HandleScheduleDeletion(db *sql.DB, mailer mail.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(auth.UserIDContextKey).(int64)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var input struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		user, err := auth.NewRepository(db).GetUserByID(userID)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// SSO だけのユーザーはパスワードを持たない
+		if user.Password != "" && !auth.CheckPasswordHash(input.Password, user.Password) {
+			http.Error(w, "password is incorrect", http.StatusForbidden)
+			return
+		}
+
+		d, err := ScheduleDeletion(db, userID, config.AccountDeletionGrace)
+		if errors.Is(err, ErrSoleOwner) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("ScheduleDeletion error: %v", err)
+			http.Error(w, "Failed to schedule deletion", http.StatusInternalServerError)
+			return
+		}
+		if err := mailer.Send(mail.Message{
+			To:      user.Email,
+			Subject: "退会の手続きを受け付けました",
+			Body: fmt.Sprintf("%s さん\n\n%s にアカウントと作成したFAQを削除します。\nそれまでは設定画面から取り消せます。心当たりがない場合はすぐにパスワードを変更してください。\n",
+				user.Username, d.ScheduledAt.Format("2006-01-02 15:04")),
+		}); err != nil {
+			log.Printf("deletion notice error: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(d)
+	}
+}
+
+// HandleCancelDeletion は DELETE /me/deletion で退会の予約を取り消す
+func HandleCancelDeletion(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(auth.UserIDContextKey).(int64)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		err := CancelDeletion(db, userID)
+		if errors.Is(err, ErrNotScheduled) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to cancel deletion", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
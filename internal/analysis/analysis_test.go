@@ -0,0 +1,65 @@
+package analysis_test
+
+import (
+	"faq-search-ai/internal/analysis"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"ＡＢＣ１２３":      "abc123",
+		"ﾊﾟｽﾜｰﾄﾞ":     "ぱすわーど",
+		"パスワード":       "ぱすわーど",
+		"サーバ～":        "さーばー",
+		"Ｈｅｌｌｏ World": "hello world",
+	}
+	for in, want := range tests {
+		if got := analysis.Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAnalyze_Japanese(t *testing.T) {
+	text := "パスワードを忘れた場合は再設定できます"
+	tokens := analysis.Analyze(text)
+
+	got := map[string]bool{}
+	for _, tok := range tokens {
+		got[tok.Term] = true
+		if s := string([]rune(text)[tok.Start:tok.End]); s == "" {
+			t.Errorf("empty span for %q", tok.Term)
+		}
+	}
+	for _, want := range []string{"ぱすわーど", "忘れる", "場合", "再", "設定"} {
+		if !got[want] {
+			t.Errorf("expected term %q in %v", want, analysis.Terms(text))
+		}
+	}
+	for _, stop := range []string{"を", "は", "た"} {
+		if got[stop] {
+			t.Errorf("expected %q to be dropped, got %v", stop, analysis.Terms(text))
+		}
+	}
+}
+
+func TestAnalyze_WidthAndKanaVariantsMatch(t *testing.T) {
+	a := analysis.Terms("ﾊﾟｽﾜｰﾄﾞの変更")
+	b := analysis.Terms("パスワード変更")
+	if len(a) == 0 || len(b) == 0 || a[0] != b[0] {
+		t.Errorf("expected same leading term, got %v and %v", a, b)
+	}
+}
+
+func TestAnalyze_Positions(t *testing.T) {
+	text := "ＶＰＮに接続できない"
+	for _, tok := range analysis.Analyze(text) {
+		if tok.Term == "vpn" {
+			if s := string([]rune(text)[tok.Start:tok.End]); s != "ＶＰＮ" {
+				t.Errorf("expected span over original text, got %q", s)
+			}
+			return
+		}
+	}
+	t.Errorf("expected vpn term, got %v", analysis.Terms(text))
+}
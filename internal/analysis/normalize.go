@@ -0,0 +1,89 @@
+package analysis
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize folds text into the form used for matching: NFKC (full-width
+// ASCII and half-width katakana to their standard widths), lower case, and
+// katakana folded to hiragana so that りんご and リンゴ compare equal.
+func Normalize(s string) string {
+	return foldKana(widthFold(s))
+}
+
+// widthFold applies NFKC and lower-casing without touching kana, which the
+// tokenizer needs to tell loanwords apart. Dash look-alikes after katakana are
+// turned into the prolonged sound mark, so サーバ～ and サーバー compare equal.
+func widthFold(s string) string {
+	runes := []rune(strings.ToLower(norm.NFKC.String(s)))
+	for i := 1; i < len(runes); i++ {
+		if isDashLike(runes[i]) && isKana(runes[i-1]) {
+			runes[i] = 'ー'
+		}
+	}
+	return string(runes)
+}
+
+func isDashLike(r rune) bool {
+	switch r {
+	case '~', '〜', '-', '‐', '―', '−':
+		return true
+	}
+	return false
+}
+
+func isKana(r rune) bool {
+	return unicode.In(r, unicode.Katakana, unicode.Hiragana) || r == 'ー'
+}
+
+func foldKana(s string) string {
+	return strings.Map(func(r rune) rune {
+		// ァ(U+30A1)..ヶ(U+30F6) map onto ぁ(U+3041)..ゖ(U+3096)
+		if r >= 'ァ' && r <= 'ヶ' {
+			return r - 0x60
+		}
+		return r
+	}, s)
+}
+
+// alignedFold applies widthFold and records, for every rune of the result,
+// the span of runes in s it came from. A rune is normalized together with
+// the voiced sound marks and combining marks that follow it, so half-width
+// ﾊﾟ still composes into パ.
+func alignedFold(s string) ([]rune, []span) {
+	in := []rune(s)
+	var out []rune
+	var origin []span
+	for i := 0; i < len(in); {
+		j := i + 1
+		for j < len(in) && isCombining(in[j]) {
+			j++
+		}
+		if unicode.IsSpace(in[i]) {
+			out = append(out, ' ')
+			origin = append(origin, span{i, j})
+		} else {
+			for _, r := range strings.ToLower(norm.NFKC.String(string(in[i:j]))) {
+				out = append(out, r)
+				origin = append(origin, span{i, j})
+			}
+		}
+		i = j
+	}
+	for k := 1; k < len(out); k++ {
+		if isDashLike(out[k]) && isKana(out[k-1]) {
+			out[k] = 'ー'
+		}
+	}
+	return out, origin
+}
+
+// span is a half-open range of rune offsets into the original text.
+type span struct{ start, end int }
+
+func isCombining(r rune) bool {
+	return r == 'ﾞ' || r == 'ﾟ' || unicode.Is(unicode.Mn, r)
+}
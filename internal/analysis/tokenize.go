@@ -0,0 +1,116 @@
+package analysis
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/ikawaha/kagome-dict/ipa"
+	"github.com/ikawaha/kagome/v2/tokenizer"
+)
+
+// Token is one searchable term and where it appears in the analyzed text.
+// Start and End are rune offsets into the original (unnormalized) input.
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// skippedPOS are parts of speech that carry no meaning on their own in search.
+var skippedPOS = map[string]bool{
+	"助詞":      true,
+	"助動詞":     true,
+	"記号":      true,
+	"フィラー":    true,
+	"BOS/EOS": true,
+}
+
+// stopWords are terms dropped after normalization. Japanese entries are in
+// hiragana since that is what Normalize produces.
+var stopWords = map[string]bool{
+	"する": true, "いる": true, "ある": true, "なる": true, "れる": true, "られる": true,
+	"こと": true, "もの": true, "よう": true, "ため": true, "とき": true,
+	"これ": true, "それ": true, "あれ": true, "この": true, "その": true, "あの": true,
+	"a": true, "an": true, "the": true, "is": true, "are": true, "be": true,
+	"of": true, "to": true, "in": true, "on": true, "for": true, "and": true, "or": true,
+	"i": true, "my": true, "do": true, "does": true, "how": true, "what": true,
+}
+
+var (
+	tokenizerOnce sync.Once
+	tok           *tokenizer.Tokenizer
+	tokErr        error
+)
+
+// Init loads the morphological dictionary. It is loaded lazily on first use
+// otherwise; calling Init at startup moves that cost out of the first request.
+func Init() error {
+	tokenizerOnce.Do(func() {
+		tok, tokErr = tokenizer.New(ipa.Dict(), tokenizer.OmitBosEos())
+	})
+	return tokErr
+}
+
+// Analyze splits text into normalized terms, dropping particles, symbols and
+// stop words. Inflected words are reduced to their dictionary form so that
+// 使えます and 使う produce the same term.
+func Analyze(text string) []Token {
+	if err := Init(); err != nil {
+		return nil
+	}
+
+	folded, origin := alignedFold(text)
+	var tokens []Token
+	for _, t := range tok.Analyze(string(folded), tokenizer.Search) {
+		if t.Start >= len(origin) || t.End <= t.Start {
+			continue
+		}
+		if pos := t.POS(); len(pos) > 0 && skippedPOS[pos[0]] {
+			continue
+		}
+		if !hasWordRune(t.Surface) {
+			continue
+		}
+
+		term := t.Surface
+		if base, ok := t.BaseForm(); ok && base != "*" && base != "" {
+			term = base
+		}
+		term = foldKana(term)
+		if stopWords[term] {
+			continue
+		}
+		tokens = append(tokens, Token{
+			Term:  term,
+			Start: origin[t.Start].start,
+			End:   origin[t.End-1].end,
+		})
+	}
+	return tokens
+}
+
+// Terms returns the terms of Analyze without positions.
+func Terms(text string) []string {
+	tokens := Analyze(text)
+	terms := make([]string, len(tokens))
+	for i, t := range tokens {
+		terms[i] = t.Term
+	}
+	return terms
+}
+
+// IndexText renders text as space separated terms, ready to be stored in a
+// full-text index that splits on whitespace.
+func IndexText(text string) string {
+	return strings.Join(Terms(text), " ")
+}
+
+func hasWordRune(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"faq-search-ai/internal/middleware"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 記録する操作。対象の種類ごとに "種類.操作" の形にする
+const (
+	ActionLogin           = "auth.login"
+	ActionLoginFailed     = "auth.login_failed"
+	ActionLoginUnlocked   = "auth.unlock"
+	ActionAPIKeyCreated   = "api_key.create"
+	ActionAPIKeyRevoked   = "api_key.revoke"
+	ActionFAQCreated      = "faq.create"
+	ActionFAQUpdated      = "faq.update"
+	ActionFAQDeleted      = "faq.delete"
+	ActionFAQRestored     = "faq.restore"
+	ActionFAQPurged       = "faq.purge"
+	ActionFAQDraftSaved   = "faq.draft_save"
+	ActionFAQDraftDeleted = "faq.draft_delete"
+	ActionSessionRevoked  = "session.revoke"
+
+	ActionKnowledgeBaseCreated = "knowledge_base.create"
+	ActionKnowledgeBaseUpdated = "knowledge_base.update"
+	ActionKnowledgeBaseDeleted = "knowledge_base.delete"
+
+	ActionUserRoleChanged      = "user.role"
+	ActionUserDisabled         = "user.disable"
+	ActionUserEnabled          = "user.enable"
+	ActionUserCredentialsReset = "user.reset_credentials"
+	ActionUserImpersonated     = "user.impersonate"
+)
+
+// 対象の種類
+const (
+	TargetUser          = "user"
+	TargetAPIKey        = "api_key"
+	TargetFAQ           = "faq"
+	TargetKnowledgeBase = "knowledge_base"
+	TargetSession       = "session"
+	TargetLockout       = "lockout"
+)
+
+// Event は監査ログの1行。ActorID が0なら操作した人が分からない (存在しないアカウントへのログインなど)
+type Event struct {
+	ID          int64             `json:"id"`
+	Time        time.Time         `json:"time"`
+	Action      string            `json:"action"`
+	ActorID     int64             `json:"actor_id,omitempty"`
+	IP          string            `json:"ip,omitempty"`
+	UserAgent   string            `json:"user_agent,omitempty"`
+	TargetType  string            `json:"target_type,omitempty"`
+	TargetID    string            `json:"target_id,omitempty"`
+	WorkspaceID int64             `json:"workspace_id,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// Record は監査ログに1行追加する。Time が空なら現在時刻にする
+func Record(db *sql.DB, e *Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	details := "{}"
+	if len(e.Details) > 0 {
+		b, err := json.Marshal(e.Details)
+		if err != nil {
+			return err
+		}
+		details = string(b)
+	}
+	result, err := db.Exec(`
+		INSERT INTO audit_log (created_at, action, actor_id, ip, user_agent, target_type, target_id, workspace_id, details)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time, e.Action, e.ActorID, e.IP, e.UserAgent, e.TargetType, e.TargetID, e.WorkspaceID, details)
+	if err != nil {
+		return err
+	}
+	e.ID, err = result.LastInsertId()
+	return err
+}
+
+// Log はリクエストの送信元を付けて記録する。記録に失敗しても操作自体は止めず、サーバーのログに残す
+func Log(db *sql.DB, r *http.Request, e Event) {
+	e.IP = middleware.ClientIP(r)
+	e.UserAgent = r.UserAgent()
+	if err := Record(db, &e); err != nil {
+		log.Printf("audit %s error: %v", e.Action, err)
+	}
+}
+
+// Filter は一覧とエクスポートの絞り込み条件。Actions はいずれかに一致する行を返す
+type Filter struct {
+	Actions    []string
+	ActorID    int64
+	TargetType string
+	TargetID   string
+	IP         string
+	Since      time.Time
+	Until      time.Time
+}
+
+func (f Filter) where() (string, []interface{}) {
+	conds := []string{"1 = 1"}
+	var args []interface{}
+	if len(f.Actions) > 0 {
+		conds = append(conds, "action IN (?"+strings.Repeat(", ?", len(f.Actions)-1)+")")
+		for _, a := range f.Actions {
+			args = append(args, a)
+		}
+	}
+	if f.ActorID != 0 {
+		conds = append(conds, "actor_id = ?")
+		args = append(args, f.ActorID)
+	}
+	if f.TargetType != "" {
+		conds = append(conds, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		conds = append(conds, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.IP != "" {
+		conds = append(conds, "ip = ?")
+		args = append(args, f.IP)
+	}
+	// 保存時のタイムゾーン表記の違いを吸収するため datetime() でUTCに揃えて比較する
+	if !f.Since.IsZero() {
+		conds = append(conds, "datetime(created_at) >= datetime(?)")
+		args = append(args, f.Since.UTC().Format(time.DateTime))
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "datetime(created_at) < datetime(?)")
+		args = append(args, f.Until.UTC().Format(time.DateTime))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// List は新しい順に limit 件を返す。before が0でなければその ID より古い行だけを返す
+func List(db *sql.DB, f Filter, before int64, limit int) ([]Event, error) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	where, args := f.where()
+	if before > 0 {
+		where += " AND id < ?"
+		args = append(args, before)
+	}
+	args = append(args, limit)
+
+	events := []Event{}
+	err := scan(db, `SELECT `+columns+` FROM audit_log WHERE `+where+` ORDER BY id DESC LIMIT ?`, args, func(e Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Each は古い順に条件に合う行を全て fn に渡す。エクスポートで全件をメモリに載せないために使う
+func Each(db *sql.DB, f Filter, fn func(Event) error) error {
+	where, args := f.where()
+	return scan(db, `SELECT `+columns+` FROM audit_log WHERE `+where+` ORDER BY id`, args, fn)
+}
+
+const columns = `id, created_at, action, actor_id, ip, user_agent, target_type, target_id, workspace_id, details`
+
+func scan(db *sql.DB, query string, args []interface{}, fn func(Event) error) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Event
+		var details string
+		if err := rows.Scan(&e.ID, &e.Time, &e.Action, &e.ActorID, &e.IP, &e.UserAgent, &e.TargetType, &e.TargetID, &e.WorkspaceID, &details); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(details), &e.Details); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,165 @@
+package audit_test
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	return db
+}
+
+func seed(t *testing.T, db *sql.DB) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, e := range []audit.Event{
+		{Action: audit.ActionLoginFailed, IP: "192.0.2.1", TargetType: audit.TargetUser, Details: map[string]string{"email": "a@example.com"}},
+		{Action: audit.ActionLogin, ActorID: 1, IP: "192.0.2.1", TargetType: audit.TargetUser, TargetID: "1"},
+		{Action: audit.ActionFAQCreated, ActorID: 1, IP: "192.0.2.1", TargetType: audit.TargetFAQ, TargetID: "faq-1", WorkspaceID: 1},
+		{Action: audit.ActionFAQUpdated, ActorID: 2, IP: "198.51.100.7", TargetType: audit.TargetFAQ, TargetID: "faq-1", WorkspaceID: 1},
+		{Action: audit.ActionFAQDeleted, ActorID: 1, IP: "192.0.2.1", TargetType: audit.TargetFAQ, TargetID: "faq-1", WorkspaceID: 1},
+	} {
+		e.Time = base.Add(time.Duration(i) * 24 * time.Hour)
+		if err := audit.Record(db, &e); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	db := setupTestDB(t)
+	seed(t, db)
+
+	tests := []struct {
+		name   string
+		filter audit.Filter
+		want   []string
+	}{
+		{"all newest first", audit.Filter{}, []string{"faq.delete", "faq.update", "faq.create", "auth.login", "auth.login_failed"}},
+		{"actions", audit.Filter{Actions: []string{audit.ActionLogin, audit.ActionLoginFailed}}, []string{"auth.login", "auth.login_failed"}},
+		{"actor", audit.Filter{ActorID: 2}, []string{"faq.update"}},
+		{"target", audit.Filter{TargetType: audit.TargetFAQ, TargetID: "faq-1"}, []string{"faq.delete", "faq.update", "faq.create"}},
+		{"ip", audit.Filter{IP: "198.51.100.7"}, []string{"faq.update"}},
+		{"time range", audit.Filter{
+			Since: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+			Until: time.Date(2025, 1, 4, 0, 0, 0, 0, time.UTC),
+		}, []string{"faq.create", "auth.login"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := audit.List(db, tt.filter, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range events {
+				got = append(got, e.Action)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// before で続きのページを取る
+	page, err := audit.List(db, audit.Filter{}, 0, 2)
+	if err != nil || len(page) != 2 {
+		t.Fatalf("expected 2 events, got %d (%v)", len(page), err)
+	}
+	next, err := audit.List(db, audit.Filter{}, page[1].ID, 2)
+	if err != nil || len(next) != 2 || next[0].Action != audit.ActionFAQCreated {
+		t.Fatalf("unexpected second page: %+v (%v)", next, err)
+	}
+}
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	db := setupTestDB(t)
+	seed(t, db)
+
+	if _, err := db.Exec(`UPDATE audit_log SET actor_id = 99`); err == nil {
+		t.Error("expected UPDATE to be rejected")
+	}
+	if _, err := db.Exec(`DELETE FROM audit_log`); err == nil {
+		t.Error("expected DELETE to be rejected")
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE actor_id = 99`).Scan(&n)
+	if n != 0 {
+		t.Errorf("rows were modified")
+	}
+}
+
+func TestHandleAuditLog(t *testing.T) {
+	db := setupTestDB(t)
+	seed(t, db)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/audit-log", audit.HandleAuditLog(db))
+	mux.HandleFunc("GET /admin/audit-log/export", audit.HandleAuditLogExport(db))
+	h := mux.ServeHTTP
+
+	req := httptest.NewRequest("GET", "/admin/audit-log?action=faq.create&action=faq.update&limit=1", nil)
+	rr := httptest.NewRecorder()
+	h(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var events []audit.Event
+	json.NewDecoder(rr.Body).Decode(&events)
+	if len(events) != 1 || events[0].Action != audit.ActionFAQUpdated {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if rr.Header().Get("X-Next-Cursor") == "" {
+		t.Error("expected X-Next-Cursor for a full page")
+	}
+
+	rr = httptest.NewRecorder()
+	h(rr, httptest.NewRequest("GET", "/admin/audit-log?since=yesterday", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid since, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h(rr, httptest.NewRequest("GET", "/admin/audit-log/export?target_type=faq", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	// JSON Lines は古い順
+	var actions []string
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		var e audit.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		actions = append(actions, e.Action)
+	}
+	if strings.Join(actions, ",") != "faq.create,faq.update,faq.delete" {
+		t.Errorf("unexpected export: %v", actions)
+	}
+
+	rr = httptest.NewRecorder()
+	h(rr, httptest.NewRequest("POST", "/admin/audit-log", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rr.Code)
+	}
+}
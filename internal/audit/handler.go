@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HandleAuditLog は GET /admin/audit-log で監査ログを新しい順に返す。管理者用のミドルウェアの内側で使う。
+// 次のページは X-Next-Cursor の値を before に渡す
+//
+// 絞り込み: action (複数可), actor_id, target_type, target_id, ip, since, until (RFC3339 または YYYY-MM-DD)
+func HandleAuditLog(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := ParseFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var before int64
+		limit := DefaultPageSize
+		if v := r.URL.Query().Get("before"); v != "" {
+			if before, err = strconv.ParseInt(v, 10, 64); err != nil || before <= 0 {
+				http.Error(w, "before must be a positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := r.URL.Query().Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = min(limit, MaxPageSize)
+		}
+		events, err := List(db, filter, before, limit)
+		if err != nil {
+			log.Printf("audit List error: %v", err)
+			http.Error(w, "Failed to fetch audit log", http.StatusInternalServerError)
+			return
+		}
+		// ちょうど limit 件なら続きがあるものとして扱う。次のページが空になることはある
+		if len(events) == limit {
+			w.Header().Set("X-Next-Cursor", strconv.FormatInt(events[len(events)-1].ID, 10))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events)
+	}
+}
+
+// HandleAuditLogExport は GET /admin/audit-log/export で監査ログを古い順の JSON Lines で返す。
+// 絞り込みは HandleAuditLog と同じ
+func HandleAuditLogExport(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := ParseFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-log-%s.jsonl"`, time.Now().Format("20060102")))
+		enc := json.NewEncoder(w)
+		// 書き始めた後はステータスを変えられないので、途中で失敗したらサーバーのログに残して打ち切る
+		if err := Each(db, filter, func(e Event) error { return enc.Encode(e) }); err != nil {
+			log.Printf("audit export error: %v", err)
+		}
+	}
+}
+
+// ParseFilter は絞り込みのクエリパラメータを解釈する
+func ParseFilter(values url.Values) (Filter, error) {
+	f := Filter{
+		Actions:    values["action"],
+		TargetType: values.Get("target_type"),
+		TargetID:   values.Get("target_id"),
+		IP:         values.Get("ip"),
+	}
+	if v := values.Get("actor_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return f, fmt.Errorf("actor_id must be a positive integer")
+		}
+		f.ActorID = id
+	}
+	var err error
+	if f.Since, err = parseTime(values.Get("since")); err != nil {
+		return f, fmt.Errorf("since: %w", err)
+	}
+	if f.Until, err = parseTime(values.Get("until")); err != nil {
+		return f, fmt.Errorf("until: %w", err)
+	}
+	return f, nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
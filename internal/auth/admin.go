@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"encoding/json"
+	"faq-search-ai/internal/audit"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// RequireAdmin は役割が admin の有効なユーザーだけを通す。JWTAuthMiddleware の内側で使う。
+// 役割を外したときにすぐ効くよう、トークンではなく毎回 DB を確認する
+func (h *AuthHandler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(UserIDContextKey).(int64)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if claims, ok := r.Context().Value(ClaimsContextKey).(*AccessClaims); ok && claims.ImpersonatorID != 0 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		user, err := h.Repo.GetUserByID(userID)
+		if err != nil || user.Role != RoleAdmin || user.DisabledAt != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListLockouts は GET /admin/lockouts で遅延中かロック中のアカウントと IP を一覧する
+func (h *AuthHandler) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := h.Repo.ListLockouts()
+	if err != nil {
+		log.Printf("ListLockouts error: %v", err)
+		http.Error(w, "Failed to list lockouts", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lockouts)
+}
+
+// Unlock は POST /admin/lockouts/unlock で {"email": ...} か {"ip": ...} のロックを解除する
+func (h *AuthHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Email == "") == (req.IP == "") {
+		http.Error(w, "either email or ip is required", http.StatusBadRequest)
+		return
+	}
+	key := AccountKey(req.Email)
+	if req.IP != "" {
+		key = IPKey(strings.TrimSpace(req.IP))
+	}
+	found, err := h.Repo.ResetLoginFailures(key)
+	if err != nil {
+		log.Printf("ResetLoginFailures error: %v", err)
+		http.Error(w, "Failed to unlock", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "no failed logins recorded", http.StatusNotFound)
+		return
+	}
+	adminID, _ := r.Context().Value(UserIDContextKey).(int64)
+	audit.Log(h.Repo.DB, r, audit.Event{
+		Action:     audit.ActionLoginUnlocked,
+		ActorID:    adminID,
+		TargetType: audit.TargetLockout,
+		TargetID:   key,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
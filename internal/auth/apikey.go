@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// API キーに付けられるスコープ
+const (
+	ScopeRead  = "read"
+	ScopeAsk   = "ask"
+	ScopeWrite = "write"
+)
+
+// APIKeyHeader は API キーを送るヘッダー。Authorization: Bearer でも受け付ける
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyPrefix で JWT と見分ける
+const apiKeyPrefix = "fsk_"
+
+var scopeOrder = []string{ScopeRead, ScopeAsk, ScopeWrite}
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidScope   = errors.New("scopes must be one or more of read, ask, write")
+)
+
+// NormalizeScopes は重複を除いて定義順に並べる。空や未知のスコープはエラー
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		valid := false
+		for _, known := range scopeOrder {
+			if s == known {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, ErrInvalidScope
+		}
+		seen[s] = true
+	}
+	if len(seen) == 0 {
+		return nil, ErrInvalidScope
+	}
+	normalized := []string{}
+	for _, s := range scopeOrder {
+		if seen[s] {
+			normalized = append(normalized, s)
+		}
+	}
+	return normalized, nil
+}
+
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// API キーやリフレッシュトークンは十分なエントロピーがあるので、パスワードと違いソルトなしの SHA-256 で照合する
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey はキーを発行して key.Key に設定する。保存するのはハッシュと表示用の先頭部分のみ
+func (r *Repository) CreateAPIKey(key *APIKey) error {
+	scopes, err := NormalizeScopes(key.Scopes)
+	if err != nil {
+		return err
+	}
+	secret, err := GenerateAPIKey()
+	if err != nil {
+		return err
+	}
+	plain := apiKeyPrefix + secret
+
+	key.Scopes = scopes
+	key.Prefix = plain[:len(apiKeyPrefix)+8]
+	key.CreatedAt = time.Now()
+	result, err := r.DB.Exec(`
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, key.UserID, key.Name, key.Prefix, hashToken(plain), strings.Join(scopes, ","), key.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if key.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	key.Key = plain
+	return nil
+}
+
+// ListAPIKeys はユーザーのキーを作成順に返す。取り消し済みのキーも含む
+func (r *Repository) ListAPIKeys(userID int64) ([]APIKey, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, user_id, name, prefix, scopes, created_at, last_used_at, revoked_at
+		FROM api_keys WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		var scopes string
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &scopes, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		k.Scopes = strings.Split(scopes, ",")
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey はキーを取り消す。記録は残す
+func (r *Repository) RevokeAPIKey(userID, id int64) error {
+	result, err := r.DB.Exec(`
+		UPDATE api_keys SET revoked_at = ?
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL`, time.Now(), id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey は有効なキーとその持ち主のユーザー名を返し、最終利用日時を更新する。
+// 無効なキーなら ErrAPIKeyNotFound
+func (r *Repository) AuthenticateAPIKey(plain string) (*APIKey, string, error) {
+	var k APIKey
+	var scopes, username string
+	err := r.DB.QueryRow(`
+		SELECT k.id, k.user_id, k.name, k.prefix, k.scopes, k.created_at, u.username
+		FROM api_keys k JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = ? AND k.revoked_at IS NULL AND u.disabled_at IS NULL`, hashToken(plain)).
+		Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &scopes, &k.CreatedAt, &username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	k.Scopes = strings.Split(scopes, ",")
+
+	now := time.Now()
+	if _, err := r.DB.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, now, k.ID); err != nil {
+		return nil, "", err
+	}
+	k.LastUsedAt = &now
+	return &k, username, nil
+}
@@ -0,0 +1,107 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"faq-search-ai/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	useTestKeys(t)
+	db := setupTestDB(t)
+	if _, err := db.Exec(`INSERT INTO users (email, username, password_hash) VALUES ('a@example.com', 'testuser', 'x')`); err != nil {
+		t.Fatalf("failed to insert user: %v", err)
+	}
+	h := auth.NewAuthHandler(db)
+
+	keys := routes(map[string]http.HandlerFunc{
+		"GET /api-keys":         h.ListAPIKeys,
+		"POST /api-keys":        h.CreateAPIKey,
+		"DELETE /api-keys/{id}": h.RevokeAPIKey,
+	})
+	callKeys := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		rr := httptest.NewRecorder()
+		keys.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := callKeys("POST", "/api-keys", map[string]interface{}{"name": "bot", "scopes": []string{"admin"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown scope: expected 400, got %d", rr.Code)
+	}
+	rr := callKeys("POST", "/api-keys", map[string]interface{}{"name": "bot", "scopes": []string{"ask", "read", "read"}})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d", rr.Code)
+	}
+	var created auth.APIKey
+	json.NewDecoder(rr.Body).Decode(&created)
+	if created.Key == "" || len(created.Scopes) != 2 {
+		t.Fatalf("unexpected key: %+v", created)
+	}
+
+	// 一覧にキー本体は含まれない
+	rr = callKeys("GET", "/api-keys", nil)
+	var listed []auth.APIKey
+	json.NewDecoder(rr.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].Key != "" || listed[0].Prefix != created.Key[:len(listed[0].Prefix)] {
+		t.Fatalf("unexpected list: %+v", listed)
+	}
+
+	var gotUser int64
+	var gotName string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = r.Context().Value(auth.UserIDContextKey).(int64)
+		gotName, _ = r.Context().Value(auth.UsernameContextKey).(string)
+	})
+	protected := auth.APIKeyOrJWTMiddleware(db, auth.ReadWriteScope)(next)
+	call := func(method, header, value string) int {
+		req := httptest.NewRequest(method, "/faqs", nil)
+		req.Header.Set(header, value)
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := call("GET", auth.APIKeyHeader, created.Key); code != http.StatusOK || gotUser != 1 || gotName != "testuser" {
+		t.Errorf("read with key: got %d user=%d name=%q", code, gotUser, gotName)
+	}
+	if code := call("GET", "Authorization", "Bearer "+created.Key); code != http.StatusOK {
+		t.Errorf("read with bearer key: expected 200, got %d", code)
+	}
+	if code := call("POST", auth.APIKeyHeader, created.Key); code != http.StatusForbidden {
+		t.Errorf("write without scope: expected 403, got %d", code)
+	}
+	if code := call("GET", auth.APIKeyHeader, "fsk_unknown"); code != http.StatusUnauthorized {
+		t.Errorf("unknown key: expected 401, got %d", code)
+	}
+
+	// JWT はスコープの制限を受けない
+	user, _ := h.Repo.GetUserByID(1)
+	pair, err := h.Repo.IssueTokens(user, auth.Client{})
+	if err != nil {
+		t.Fatalf("IssueTokens failed: %v", err)
+	}
+	if code := call("POST", "Authorization", "Bearer "+pair.Token); code != http.StatusOK {
+		t.Errorf("jwt: expected 200, got %d", code)
+	}
+
+	if rr := callKeys("DELETE", "/api-keys/"+strconv.FormatInt(created.ID, 10), nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke: expected 204, got %d", rr.Code)
+	}
+	if code := call("GET", auth.APIKeyHeader, created.Key); code != http.StatusUnauthorized {
+		t.Errorf("revoked key: expected 401, got %d", code)
+	}
+	if rr := callKeys("DELETE", "/api-keys/"+strconv.FormatInt(created.ID, 10), nil); rr.Code != http.StatusNotFound {
+		t.Errorf("revoke twice: expected 404, got %d", rr.Code)
+	}
+}
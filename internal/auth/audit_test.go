@@ -0,0 +1,48 @@
+package auth_test
+
+import (
+	"faq-search-ai/internal/audit"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLoginAndAPIKeysAreAudited(t *testing.T) {
+	h := setupTokenTest(t)
+
+	attempt(h, "nobody@example.com", "pass1234word", "10.0.0.1")
+	attempt(h, "a@example.com", "wrong-password", "10.0.0.2")
+	if rr := attempt(h, "a@example.com", "pass1234word", "10.0.0.3"); rr.Code != http.StatusOK {
+		t.Fatalf("login failed: %d", rr.Code)
+	}
+	if rr := post(h.CreateAPIKey, "/api-keys", map[string]interface{}{"name": "ci", "scopes": []string{"read"}}); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rr.Code)
+	}
+
+	var got []audit.Event
+	err := audit.Each(h.Repo.DB, audit.Filter{}, func(e audit.Event) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary []string
+	for _, e := range got {
+		summary = append(summary, e.Action+"@"+e.IP)
+	}
+	want := "auth.login_failed@10.0.0.1,auth.login_failed@10.0.0.2,auth.login@10.0.0.3,api_key.create@192.0.2.1"
+	if strings.Join(summary, ",") != want {
+		t.Fatalf("expected %s, got %s", want, strings.Join(summary, ","))
+	}
+
+	if got[0].ActorID != 0 || got[0].Details["email"] != "nobody@example.com" {
+		t.Errorf("unknown account: unexpected event %+v", got[0])
+	}
+	if got[1].ActorID != 1 || got[1].TargetID != "1" || got[1].Details["method"] != "password" {
+		t.Errorf("wrong password: unexpected event %+v", got[1])
+	}
+	if got[3].ActorID != 1 || got[3].TargetType != audit.TargetAPIKey || got[3].Details["name"] != "ci" {
+		t.Errorf("api key: unexpected event %+v", got[3])
+	}
+}
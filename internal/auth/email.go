@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/mail"
+	"faq-search-ai/internal/middleware"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// RequestEmailVerification は POST /verify-email/request で確認メールを再送する
+func (h *AuthHandler) RequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.Repo.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		http.Error(w, "email address is already verified", http.StatusConflict)
+		return
+	}
+	if err := h.sendVerification(user); err != nil {
+		log.Printf("sendVerification error: %v", err)
+		http.Error(w, "could not send verification email", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyEmail は POST /verify-email でメールのトークンを使ってアドレスを確認済みにする
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	_, err := h.Repo.VerifyEmail(req.Token)
+	if errors.Is(err, ErrInvalidUserToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("VerifyEmail error: %v", err)
+		http.Error(w, "could not verify email", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgotPassword は POST /password/forgot で再設定メールを送る。
+// 登録の有無が分からないよう、常に 202 を返し、宛先の確認と送信は応答の後に行う
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// メールの大量送信を防ぐため、宛先と IP ごとに試行を数える。
+	// ログインの失敗とは別に数え、再設定の依頼でログインが遅延しないようにする
+	accountKey := passwordResetKey(AccountKey(req.Email))
+	ipKey := passwordResetKey(IPKey(middleware.ClientIP(r)))
+	if h.throttled(w, accountKey, ipKey) {
+		return
+	}
+	if err := h.Repo.RecordLoginFailure(accountKey, ipKey); err != nil {
+		log.Printf("RecordLoginFailure error: %v", err)
+	}
+
+	h.sending.Add(1)
+	go func() {
+		defer h.sending.Done()
+		user, err := h.Repo.GetUserByEmail(req.Email)
+		if err != nil {
+			return
+		}
+		if err := h.sendPasswordReset(user); err != nil {
+			log.Printf("sendPasswordReset error: %v", err)
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword は POST /password/reset でトークンを使ってパスワードを再設定する。既存のトークンは全て失効する
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.NewPassword == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	// メールアドレスやユーザー名との一致はトークンを使う前には分からないので、ここでは長さと一覧だけを確認する
+	if msg := ValidatePassword(req.NewPassword, "", ""); msg != "" {
+		writeValidationError(w, http.StatusBadRequest, ValidationError{"new_password": msg})
+		return
+	}
+	hashed, err := HashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "could not update password", http.StatusInternalServerError)
+		return
+	}
+	_, err = h.Repo.ResetPassword(req.Token, hashed)
+	if errors.Is(err, ErrInvalidUserToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("ResetPassword error: %v", err)
+		http.Error(w, "could not update password", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) sendVerification(user *User) error {
+	token, err := h.Repo.CreateEmailVerification(user.ID)
+	if err != nil {
+		return err
+	}
+	return h.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "メールアドレスの確認",
+		Body: fmt.Sprintf("%s さん\n\n以下のリンクからメールアドレスを確認してください。リンクの有効期限は%d時間です。\n\n%s\n",
+			user.Username, int(EmailVerificationTTL.Hours()), link("/verify-email", token)),
+	})
+}
+
+func (h *AuthHandler) sendPasswordReset(user *User) error {
+	token, err := h.Repo.CreatePasswordReset(user.ID)
+	if err != nil {
+		return err
+	}
+	return h.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "パスワードの再設定",
+		Body: fmt.Sprintf("%s さん\n\n以下のリンクから新しいパスワードを設定してください。リンクの有効期限は%d分です。\n心当たりがない場合はこのメールを無視してください。\n\n%s\n",
+			user.Username, int(PasswordResetTTL.Minutes()), link("/reset-password", token)),
+	})
+}
+
+// link はフロントエンドのページへのトークン付きの URL
+func link(path, token string) string {
+	return config.AppBaseURL + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,159 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/mail"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type captureMailer struct {
+	sent []mail.Message
+}
+
+func (m *captureMailer) Send(msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var tokenPattern = regexp.MustCompile(`\?token=(\S+)`)
+
+// tokenFrom は最後に送ったメールのリンクからトークンを取り出す
+func (m *captureMailer) tokenFrom(t *testing.T) string {
+	t.Helper()
+	if len(m.sent) == 0 {
+		t.Fatal("no mail sent")
+	}
+	match := tokenPattern.FindStringSubmatch(m.sent[len(m.sent)-1].Body)
+	if match == nil {
+		t.Fatalf("no token link in mail: %q", m.sent[len(m.sent)-1].Body)
+	}
+	token, _ := url.QueryUnescape(match[1])
+	return token
+}
+
+// forgot はパスワード再設定を依頼し、応答の後に送るメールを待つ
+func forgot(h *auth.AuthHandler, email string) *httptest.ResponseRecorder {
+	rr := post(h.ForgotPassword, "/password/forgot", map[string]string{"email": email})
+	h.Wait()
+	return rr
+}
+
+func post(handler http.HandlerFunc, path string, body interface{}) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewBuffer(b))
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestEmailVerification(t *testing.T) {
+	h := setupTokenTest(t)
+	mailer := h.Mailer.(*captureMailer)
+	mailer.sent = nil
+
+	if rr := post(h.RequestEmailVerification, "/verify-email/request", nil); rr.Code != http.StatusAccepted {
+		t.Fatalf("request: expected 202, got %d", rr.Code)
+	}
+	if mailer.sent[0].To != "a@example.com" {
+		t.Errorf("unexpected recipient %q", mailer.sent[0].To)
+	}
+	token := mailer.tokenFrom(t)
+
+	if rr := post(h.VerifyEmail, "/verify-email", map[string]string{"token": token}); rr.Code != http.StatusNoContent {
+		t.Fatalf("verify: expected 204, got %d", rr.Code)
+	}
+	if rr := post(h.VerifyEmail, "/verify-email", map[string]string{"token": token}); rr.Code != http.StatusBadRequest {
+		t.Errorf("reuse: expected 400, got %d", rr.Code)
+	}
+	user, _ := h.Repo.GetUserByID(1)
+	if user.EmailVerifiedAt == nil {
+		t.Error("expected email to be verified")
+	}
+	if rr := post(h.RequestEmailVerification, "/verify-email/request", nil); rr.Code != http.StatusConflict {
+		t.Errorf("already verified: expected 409, got %d", rr.Code)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	h := setupTokenTest(t)
+	mailer := h.Mailer.(*captureMailer)
+	mailer.sent = nil
+	session := login(t, h)
+
+	// 未登録のアドレスでも同じ応答で、メールは送らない
+	if rr := forgot(h, "nobody@example.com"); rr.Code != http.StatusAccepted || len(mailer.sent) != 0 {
+		t.Fatalf("unknown email: got %d with %d mails", rr.Code, len(mailer.sent))
+	}
+
+	forgot(h, "a@example.com")
+	stale := mailer.tokenFrom(t)
+	forgot(h, "a@example.com")
+	token := mailer.tokenFrom(t)
+
+	// 新しく発行すると古いリンクは使えない
+	if rr := post(h.ResetPassword, "/password/reset", map[string]string{"token": stale, "new_password": "newpass456"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("stale token: expected 400, got %d", rr.Code)
+	}
+	if rr := post(h.ResetPassword, "/password/reset", map[string]string{"token": token, "new_password": "newpass456"}); rr.Code != http.StatusNoContent {
+		t.Fatalf("reset: expected 204, got %d", rr.Code)
+	}
+	if rr := post(h.ResetPassword, "/password/reset", map[string]string{"token": token, "new_password": "again789"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("reuse: expected 400, got %d", rr.Code)
+	}
+
+	if authorized(h, session.Token) {
+		t.Error("sessions should be revoked after a reset")
+	}
+	body, _ := json.Marshal(map[string]string{"email": "a@example.com", "password": "newpass456"})
+	rr := httptest.NewRecorder()
+	h.Login(rr, httptest.NewRequest("POST", "/login", bytes.NewBuffer(body)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("login with new password: expected 200, got %d", rr.Code)
+	}
+}
+
+func TestPasswordResetExpires(t *testing.T) {
+	h := setupTokenTest(t)
+	mailer := h.Mailer.(*captureMailer)
+	mailer.sent = nil
+
+	ttl := auth.PasswordResetTTL
+	auth.PasswordResetTTL = -time.Minute
+	t.Cleanup(func() { auth.PasswordResetTTL = ttl })
+
+	forgot(h, "a@example.com")
+	if rr := post(h.ResetPassword, "/password/reset", map[string]string{"token": mailer.tokenFrom(t), "new_password": "newpass456"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expired token: expected 400, got %d", rr.Code)
+	}
+}
+
+func TestForgotPasswordThrottled(t *testing.T) {
+	h := setupTokenTest(t)
+	usePolicy(t, auth.LoginThrottle{FreeAttempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour, Window: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		if rr := forgot(h, "a@example.com"); rr.Code != http.StatusAccepted {
+			t.Fatalf("request %d: expected 202, got %d", i+1, rr.Code)
+		}
+	}
+	// 登録の有無にかかわらず同じように数える
+	if rr := forgot(h, "a@example.com"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", rr.Code)
+	}
+	if rr := forgot(h, "nobody@example.com"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("same ip: expected 429, got %d", rr.Code)
+	}
+	// 再設定の依頼でログインは遅延しない
+	if rr := attempt(h, "a@example.com", "pass1234word", "192.0.2.1"); rr.Code != http.StatusOK {
+		t.Errorf("login: expected 200, got %d", rr.Code)
+	}
+}
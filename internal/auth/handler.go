@@ -3,20 +3,34 @@ package auth
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/mail"
+	"faq-search-ai/internal/middleware"
+	"log"
+	"math"
 	"net/http"
-	"os"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 type AuthHandler struct {
-	Repo *Repository
+	Repo   *Repository
+	Mailer mail.Mailer
+
+	// sending は応答の後に送っているメールの数
+	sending sync.WaitGroup
+}
+
+// Wait は応答の後に送っているメールを送り終えるまで待つ
+func (h *AuthHandler) Wait() {
+	h.sending.Wait()
 }
 
 func NewAuthHandler(db *sql.DB) *AuthHandler {
-	return &AuthHandler{Repo: NewRepository(db)}
+	return &AuthHandler{Repo: NewRepository(db), Mailer: mail.New()}
 }
 
 type signupRequest struct {
@@ -37,18 +51,38 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashed, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if errs := validateSignup(&req); errs != nil {
+		writeValidationError(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	hashed, err := HashPassword(req.Password)
+	if err != nil {
+		log.Printf("HashPassword error: %v", err)
+		http.Error(w, "could not create user", http.StatusInternalServerError)
+		return
+	}
 
 	user := &User{
 		Email:    req.Email,
 		Username: req.Username,
-		Password: string(hashed),
+		Password: hashed,
 	}
 
-	if err := h.Repo.CreateUser(user); err != nil {
+	err = h.Repo.CreateUser(user)
+	if errors.Is(err, ErrEmailTaken) {
+		writeValidationError(w, http.StatusConflict, ValidationError{"email": "is already registered"})
+		return
+	}
+	if err != nil {
+		log.Printf("CreateUser error: %v", err)
 		http.Error(w, "could not create user", http.StatusInternalServerError)
 		return
 	}
+	// 確認メールが送れなくても登録は済んでいるので、再送してもらう
+	if err := h.sendVerification(user); err != nil {
+		log.Printf("sendVerification error: %v", err)
+	}
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -66,30 +100,74 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 連続した失敗はアカウントと IP の両方で数え、どちらかが遅延中なら試行させない
+	accountKey, ipKey := AccountKey(req.Email), IPKey(middleware.ClientIP(r))
+	if h.throttled(w, accountKey, ipKey) {
+		return
+	}
+
+	// ユーザーの有無が応答や処理時間から分からないよう、存在しなくてもハッシュを比較する
 	user, err := h.Repo.GetUserByEmail(req.Email)
-	if err != nil {
+	hash := dummyPasswordHash()
+	if err == nil {
+		hash = user.Password
+	}
+	ok, rehash := VerifyPassword(req.Password, hash)
+	if !ok || err != nil {
+		if err != nil {
+			user = nil
+		}
+		auditLogin(h.Repo.DB, r, audit.ActionLoginFailed, "password", user, req.Email)
+		if err := h.Repo.RecordLoginFailure(accountKey, ipKey); err != nil {
+			log.Printf("RecordLoginFailure error: %v", err)
+		}
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]string{
-			"error": "unauthorized: user not found",
+			"error": "unauthorized: invalid email or password",
 		})
 		return
 	}
+	// bcrypt や古いパラメーターのハッシュは、平文が手元にある今のうちに作り直す
+	if rehash {
+		if err := h.rehashPassword(user, req.Password); err != nil {
+			log.Printf("rehashPassword error: %v", err)
+		}
+	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+	if user.DisabledAt != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": ErrAccountDisabled.Error(),
+		})
+		return
+	}
+	if config.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		w.WriteHeader(http.StatusForbidden)
 		json.NewEncoder(w).Encode(map[string]string{
-			"error": "unauthorized: invalid credentials",
+			"error": "email address is not verified",
 		})
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
-	})
-	secret := os.Getenv("JWT_SECRET")
-	tokenStr, err := token.SignedString([]byte(secret))
+	// 二段階認証が有効なら、コードを確認するまで失敗の記録は残してトークンも発行しない
+	mfa, err := h.Repo.GetMFAStatus(user.ID)
+	if err != nil {
+		log.Printf("GetMFAStatus error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "could not log in",
+		})
+		return
+	}
+	if mfa.Enabled {
+		h.challengeMFA(w, user)
+		return
+	}
+	if _, err := h.Repo.ResetLoginFailures(accountKey); err != nil {
+		log.Printf("ResetLoginFailures error: %v", err)
+	}
+
+	pair, err := h.Repo.IssueTokens(user, ClientFrom(r))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{
@@ -97,11 +175,159 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	auditLogin(h.Repo.DB, r, audit.ActionLogin, "password", user, user.Email)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": tokenStr,
-	})
+	json.NewEncoder(w).Encode(pair)
+}
+
+// auditLogin はログインの成否を監査ログに残す。user が nil なら存在しないアカウントへの試行
+func auditLogin(db *sql.DB, r *http.Request, action, method string, user *User, email string) {
+	e := audit.Event{
+		Action:     action,
+		TargetType: audit.TargetUser,
+		Details:    map[string]string{"method": method, "email": NormalizeEmail(email)},
+	}
+	if user != nil {
+		e.ActorID, e.TargetID = user.ID, strconv.FormatInt(user.ID, 10)
+	}
+	audit.Log(db, r, e)
+}
+
+func (h *AuthHandler) rehashPassword(user *User, password string) error {
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := h.Repo.UpdatePasswordHash(user.ID, user.Password, hashed); err != nil {
+		return err
+	}
+	user.Password = hashed
+	return nil
+}
+
+// throttled は失敗や試行が続いているキーがあれば 429 を返して true を返す
+func (h *AuthHandler) throttled(w http.ResponseWriter, keys ...string) bool {
+	wait, err := h.Repo.LoginRetryAfter(keys...)
+	if err != nil {
+		log.Printf("LoginRetryAfter error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "could not log in",
+		})
+		return true
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "too many attempts, try again later",
+		})
+		return true
+	}
+	return false
+}
+
+// Refresh はリフレッシュトークンを新しいトークンの組と交換する。使用済みのトークンならファミリーごと失効させる
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "invalid request",
+		})
+		return
+	}
+
+	pair, err := h.Repo.Refresh(req.RefreshToken, ClientFrom(r))
+	if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			log.Printf("refresh token reuse detected; token family revoked")
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "unauthorized: " + err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Refresh error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "could not generate token",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pair)
+}
+
+// Logout は使用中のアクセストークンと、同じログインのリフレッシュトークンを失効させる
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(ClaimsContextKey).(*AccessClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.Repo.Logout(claims); err != nil {
+		log.Printf("Logout error: %v", err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword は POST /me/password でパスワードを変更する。
+// 既存のトークンは全て失効するので、新しいトークンの組を返す
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewPassword == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Repo.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !CheckPasswordHash(req.CurrentPassword, user.Password) {
+		http.Error(w, "current password is incorrect", http.StatusForbidden)
+		return
+	}
+	if msg := ValidatePassword(req.NewPassword, user.Email, user.Username); msg != "" {
+		writeValidationError(w, http.StatusBadRequest, ValidationError{"new_password": msg})
+		return
+	}
+	hashed, err := HashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "could not update password", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Repo.ChangePassword(userID, hashed); err != nil {
+		log.Printf("ChangePassword error: %v", err)
+		http.Error(w, "could not update password", http.StatusInternalServerError)
+		return
+	}
+
+	pair, err := h.Repo.IssueTokens(user, ClientFrom(r))
+	if err != nil {
+		http.Error(w, "could not generate token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pair)
 }
 
 func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
@@ -115,3 +341,91 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 		"username": username,
 	})
 }
+
+// ListAPIKeys は GET /api-keys で API キーを一覧する。キー本体は含めない
+func (h *AuthHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	keys, err := h.Repo.ListAPIKeys(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch API keys", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// CreateAPIKey は POST /api-keys で API キーを発行する。キーはこの応答でしか返さない
+func (h *AuthHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var input struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	key := &APIKey{UserID: userID, Name: strings.TrimSpace(input.Name), Scopes: input.Scopes}
+	if key.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	err := h.Repo.CreateAPIKey(key)
+	if errors.Is(err, ErrInvalidScope) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("CreateAPIKey error: %v", err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	audit.Log(h.Repo.DB, r, audit.Event{
+		Action:     audit.ActionAPIKeyCreated,
+		ActorID:    userID,
+		TargetType: audit.TargetAPIKey,
+		TargetID:   strconv.FormatInt(key.ID, 10),
+		Details:    map[string]string{"name": key.Name, "scopes": strings.Join(key.Scopes, " ")},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// RevokeAPIKey は DELETE /api-keys/{id} で API キーを取り消す
+func (h *AuthHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	err = h.Repo.RevokeAPIKey(userID, id)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	audit.Log(h.Repo.DB, r, audit.Event{
+		Action:     audit.ActionAPIKeyRevoked,
+		ActorID:    userID,
+		TargetType: audit.TargetAPIKey,
+		TargetID:   strconv.FormatInt(id, 10),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,12 +1,110 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Argon2Params は argon2id のパラメーター。Memory は KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// PasswordHashParams は新しく作るハッシュのパラメーター。既定値は OWASP の推奨 (19 MiB, t=2, p=1)。
+// 保存済みのハッシュと異なれば、次のログインで作り直す
+var PasswordHashParams = Argon2Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var errInvalidHash = errors.New("invalid password hash")
+
+var phcEncoding = base64.RawStdEncoding
+
+// HashPassword は PHC 形式 ($argon2id$v=19$m=...,t=...,p=...$salt$hash) のハッシュを返す
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	p := PasswordHashParams
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword はパスワードを照合する。rehash は一致したハッシュが bcrypt か古いパラメーターのとき true
+func VerifyPassword(password, hash string) (ok, rehash bool) {
+	if strings.HasPrefix(hash, "$2") {
+		// argon2id 導入前の bcrypt のハッシュ
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, true
+	}
+	p, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, false
+	}
+	got := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return false, false
+	}
+	want := PasswordHashParams
+	return true, p.Memory != want.Memory || p.Iterations != want.Iterations || p.Parallelism != want.Parallelism ||
+		p.SaltLength != want.SaltLength || p.KeyLength != want.KeyLength
 }
 
 func CheckPasswordHash(password, hash string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	ok, _ := VerifyPassword(password, hash)
+	return ok
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, errInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, errInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil ||
+		p.Iterations == 0 || p.Parallelism == 0 {
+		return p, nil, nil, errInvalidHash
+	}
+	salt, errSalt := phcEncoding.DecodeString(parts[4])
+	key, errKey := phcEncoding.DecodeString(parts[5])
+	if errSalt != nil || errKey != nil || len(key) == 0 {
+		return p, nil, nil, errInvalidHash
+	}
+	p.SaltLength, p.KeyLength = uint32(len(salt)), uint32(len(key))
+	return p, salt, key, nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash は存在しないユーザーのログインで比較に使うハッシュ
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy password for timing")
+	})
+	return dummyHash
 }
@@ -0,0 +1,78 @@
+package auth_test
+
+import (
+	"faq-search-ai/internal/auth"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPasswordPHC(t *testing.T) {
+	hash, err := auth.HashPassword("pass1234word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") || len(strings.Split(hash, "$")) != 6 {
+		t.Fatalf("unexpected hash format %q", hash)
+	}
+	if other, _ := auth.HashPassword("pass1234word"); other == hash {
+		t.Error("expected a random salt")
+	}
+	if ok, rehash := auth.VerifyPassword("pass1234word", hash); !ok || rehash {
+		t.Errorf("expected match without rehash, got %v %v", ok, rehash)
+	}
+	if ok, _ := auth.VerifyPassword("wrong", hash); ok {
+		t.Error("wrong password matched")
+	}
+	for _, broken := range []string{"", "plain", "$argon2id$v=18$m=1,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=1,t=0,p=1$c2FsdA$a2V5"} {
+		if ok, _ := auth.VerifyPassword("pass1234word", broken); ok {
+			t.Errorf("malformed hash %q matched", broken)
+		}
+	}
+}
+
+func TestLoginRehashesOutdatedPasswords(t *testing.T) {
+	h := setupTokenTest(t)
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("pass1234word"), bcrypt.MinCost)
+	h.Repo.DB.Exec(`UPDATE users SET password_hash = ? WHERE email = ?`, string(legacy), "a@example.com")
+
+	stored := func() string {
+		user, err := h.Repo.GetUserByEmail("a@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.Password
+	}
+
+	// 失敗したログインでは作り直さない
+	attempt(h, "a@example.com", "wrong-password", "10.0.0.1")
+	if stored() != string(legacy) {
+		t.Fatal("hash changed after a failed login")
+	}
+	login(t, h)
+	upgraded := stored()
+	if !strings.HasPrefix(upgraded, "$argon2id$") {
+		t.Fatalf("expected bcrypt hash to be upgraded, got %q", upgraded)
+	}
+
+	// パラメーターを変えると次のログインで作り直す
+	saved := auth.PasswordHashParams
+	auth.PasswordHashParams.Iterations = 3
+	t.Cleanup(func() { auth.PasswordHashParams = saved })
+	if ok, rehash := auth.VerifyPassword("pass1234word", upgraded); !ok || !rehash {
+		t.Fatalf("expected rehash for old parameters, got %v %v", ok, rehash)
+	}
+	session := login(t, h)
+	if !strings.Contains(stored(), ",t=3,") {
+		t.Errorf("expected new parameters, got %q", stored())
+	}
+	// 作り直してもセッションは失効しない
+	if !authorized(h, session.Token) {
+		t.Error("rehash should not revoke tokens")
+	}
+	if rr := attempt(h, "a@example.com", "pass1234word", "10.0.0.1"); rr.Code != http.StatusOK {
+		t.Errorf("login after rehash: expected 200, got %d", rr.Code)
+	}
+}
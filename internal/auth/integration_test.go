@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -23,20 +24,24 @@ func setupTestDB(t *testing.T) *sql.DB {
 	if err != nil {
 		t.Fatalf("failed to open db: %v", err)
 	}
-	_, err = db.Exec(`CREATE TABLE users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		email TEXT,
-		username TEXT,
-		password_hash TEXT
-	)`)
-	if err != nil {
-		t.Fatalf("failed to create table: %v", err)
+	db.SetMaxOpenConns(1)
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
 	}
 	return db
 }
 
+// routes はパターンごとのハンドラーを本番と同じようにメソッドとパスで振り分ける
+func routes(handlers map[string]http.HandlerFunc) http.Handler {
+	mux := http.NewServeMux()
+	for pattern, h := range handlers {
+		mux.HandleFunc(pattern, h)
+	}
+	return mux
+}
+
 func TestAuthFlow(t *testing.T) {
-	t.Setenv("JWT_SECRET", "test-secret")
+	useTestKeys(t)
 	db := setupTestDB(t)
 	h := auth.NewAuthHandler(db)
 
@@ -44,7 +49,7 @@ func TestAuthFlow(t *testing.T) {
 	signupBody := map[string]string{
 		"email":    "a@example.com",
 		"username": "testuser",
-		"password": "pass123",
+		"password": "pass1234word",
 	}
 	body, _ := json.Marshal(signupBody)
 	req := httptest.NewRequest("POST", "/signup", bytes.NewBuffer(body))
@@ -58,7 +63,7 @@ func TestAuthFlow(t *testing.T) {
 	// Login
 	loginBody := map[string]string{
 		"email":    "a@example.com",
-		"password": "pass123",
+		"password": "pass1234word",
 	}
 	body, _ = json.Marshal(loginBody)
 	t.Logf("login response: %s", string(body))
@@ -80,7 +85,7 @@ func TestAuthFlow(t *testing.T) {
 	req = httptest.NewRequest("GET", "/me", nil)
 	req.Header.Set("Authorization", "Bearer "+res.Token)
 	rr = httptest.NewRecorder()
-	hWithJWT := auth.JWTAuthMiddleware(http.HandlerFunc(h.Me))
+	hWithJWT := auth.JWTAuthMiddleware(h.Repo)(http.HandlerFunc(h.Me))
 	hWithJWT.ServeHTTP(rr, req)
 	if rr.Code != http.StatusOK {
 		t.Fatalf("me failed: %d", rr.Code)
@@ -2,39 +2,93 @@ package auth
 
 import (
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-func GenerateJWT(userID int64, username string) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
+// アクセストークンとリフレッシュトークンの有効期間。起動時に config の値で上書きする
+var (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// AccessClaims はアクセストークンの中身。SessionID はログインごとのセッション (リフレッシュトークンの系列) の ID。
+// ImpersonatorID は管理者が代理でログインしたときの管理者のユーザー ID
+type AccessClaims struct {
+	UserID         int64
+	Username       string
+	TokenID        string
+	SessionID      string
+	ImpersonatorID int64
+	ExpiresAt      time.Time
+}
+
+func generateAccessToken(userID int64, username, sessionID string) (string, time.Time, error) {
+	return signAccessToken(userID, username, sessionID, 0)
+}
+
+func signAccessToken(userID int64, username, sessionID string, impersonatorID int64) (string, time.Time, error) {
+	keys, err := currentKeys()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(AccessTokenTTL)
 	claims := jwt.MapClaims{
 		"user_id":  userID,
 		"username": username,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
+		"jti":      uuid.NewString(),
+		"iat":      time.Now().Unix(),
+		"exp":      expiresAt.Unix(),
+	}
+	if sessionID != "" {
+		claims["sid"] = sessionID
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	if impersonatorID != 0 {
+		claims["imp"] = impersonatorID
+	}
+	signed, err := keys.Sign(claims)
+	return signed, expiresAt, err
 }
 
 func ParseJWT(tokenStr string) (int64, string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
-	if err != nil || !token.Valid {
+	claims, err := ParseAccessToken(tokenStr)
+	if err != nil {
 		return 0, "", err
 	}
+	return claims.UserID, claims.Username, nil
+}
+
+func ParseAccessToken(tokenStr string) (*AccessClaims, error) {
+	keys, err := currentKeys()
+	if err != nil {
+		return nil, err
+	}
+	token, err := keys.Parse(tokenStr, jwt.MapClaims{})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok {
 		userIDFloat, ok := claims["user_id"].(float64)
 		if !ok {
-			return 0, "", fmt.Errorf("user_id not found or not float64")
+			return nil, fmt.Errorf("user_id not found or not float64")
+		}
+		parsed := &AccessClaims{UserID: int64(userIDFloat)}
+		parsed.Username, _ = claims["username"].(string)
+		parsed.TokenID, _ = claims["jti"].(string)
+		parsed.SessionID, _ = claims["sid"].(string)
+		if imp, ok := claims["imp"].(float64); ok {
+			parsed.ImpersonatorID = int64(imp)
+		}
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			parsed.ExpiresAt = exp.Time
 		}
-		username, _ := claims["username"].(string)
-		return int64(userIDFloat), username, nil
+		return parsed, nil
 	}
-	return 0, "", fmt.Errorf("invalid token claims")
+	return nil, fmt.Errorf("invalid token claims")
 }
@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// hmacKeyID は JWT_SECRET で署名したトークンの kid
+const hmacKeyID = "hs256"
+
+// minRSABits 未満の RSA 鍵は受け付けない
+const minRSABits = 2048
+
+var (
+	ErrUnknownKey        = errors.New("token signed with an unknown key")
+	ErrAlgorithmMismatch = errors.New("token algorithm does not match its key")
+	ErrUnsupportedKey    = errors.New("key must be RSA (2048 bits or more) or Ed25519")
+	ErrNoKeyManager      = errors.New("no signing keys configured; call UseKeyManager at startup")
+)
+
+// JWK は JWKS で公開する公開鍵
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+	jwk    *JWK // HMAC の鍵は公開しないので nil
+}
+
+// KeyManager はトークンに署名する鍵と、検証に使う鍵の一覧を持つ。
+// ローテーション中は古い鍵を検証用にだけ残し、kid で使い分ける。各鍵は自分のアルゴリズム以外を受け付けない
+type KeyManager struct {
+	signingKID string
+	signer     interface{}
+	method     jwt.SigningMethod
+	keys       map[string]verificationKey
+	kids       []string
+}
+
+// NewKeyManager は signer で署名し、signer の公開鍵と verification で検証する鍵マネージャーを作る
+func NewKeyManager(signer crypto.Signer, verification ...crypto.PublicKey) (*KeyManager, error) {
+	m := &KeyManager{signer: signer, keys: map[string]verificationKey{}}
+	kid, err := m.addPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	m.signingKID = kid
+	m.method = m.keys[kid].method
+	for _, pub := range verification {
+		if _, err := m.addPublicKey(pub); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// NewHMACKeyManager は共有鍵の HS256 で署名・検証する。非対称鍵を設定していない環境向け
+func NewHMACKeyManager(secret []byte) (*KeyManager, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("JWT secret is empty")
+	}
+	return &KeyManager{
+		signingKID: hmacKeyID,
+		signer:     secret,
+		method:     jwt.SigningMethodHS256,
+		keys:       map[string]verificationKey{hmacKeyID: {method: jwt.SigningMethodHS256, key: secret}},
+		kids:       []string{hmacKeyID},
+	}, nil
+}
+
+// LoadKeyManager は PEM の秘密鍵 signingPath で署名し、verificationPaths の鍵
+// (公開鍵か秘密鍵) でも検証する鍵マネージャーを作る
+func LoadKeyManager(signingPath string, verificationPaths []string) (*KeyManager, error) {
+	signingKey, err := readPEMKey(signingPath)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := signingKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: not a private key", signingPath)
+	}
+	var verification []crypto.PublicKey
+	for _, path := range verificationPaths {
+		key, err := readPEMKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := key.(crypto.Signer); ok {
+			key = s.Public()
+		}
+		verification = append(verification, key)
+	}
+	return NewKeyManager(signer, verification...)
+}
+
+func (m *KeyManager) addPublicKey(pub crypto.PublicKey) (string, error) {
+	var vk verificationKey
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return "", ErrUnsupportedKey
+		}
+		vk = verificationKey{method: jwt.SigningMethodRS256, key: k, jwk: &JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}}
+	case ed25519.PublicKey:
+		vk = verificationKey{method: jwt.SigningMethodEdDSA, key: k, jwk: &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k),
+		}}
+	default:
+		return "", ErrUnsupportedKey
+	}
+
+	kid, err := thumbprint(vk.jwk)
+	if err != nil {
+		return "", err
+	}
+	vk.jwk.Kid, vk.jwk.Use, vk.jwk.Alg = kid, "sig", vk.method.Alg()
+	if _, exists := m.keys[kid]; !exists {
+		m.keys[kid] = vk
+		m.kids = append(m.kids, kid)
+	}
+	return kid, nil
+}
+
+// thumbprint は RFC 7638 の JWK Thumbprint を kid にする
+func thumbprint(jwk *JWK) (string, error) {
+	var required interface{}
+	if jwk.Kty == "RSA" {
+		required = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		required = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	b, err := json.Marshal(required)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// Sign は署名用の鍵で claims に署名し、ヘッダーに kid を付ける
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(m.method, claims)
+	token.Header["kid"] = m.signingKID
+	return token.SignedString(m.signer)
+}
+
+// Parse は kid の鍵で検証する。kid の無いトークンや、鍵と異なるアルゴリズムのトークンは拒否する
+func (m *KeyManager) Parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	algs := make([]string, 0, len(m.kids))
+	for _, kid := range m.kids {
+		algs = append(algs, m.keys[kid].method.Alg())
+	}
+	return jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := m.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, ErrAlgorithmMismatch
+		}
+		return key.key, nil
+	}, jwt.WithValidMethods(algs))
+}
+
+// JWKS は検証に使う公開鍵の一覧。HMAC の鍵は含めない
+func (m *KeyManager) JWKS() []JWK {
+	jwks := []JWK{}
+	for _, kid := range m.kids {
+		if jwk := m.keys[kid].jwk; jwk != nil {
+			jwks = append(jwks, *jwk)
+		}
+	}
+	return jwks
+}
+
+var (
+	keysMu sync.RWMutex
+	keys   *KeyManager
+)
+
+// UseKeyManager はトークンの署名と検証に m を使うようにする
+func UseKeyManager(m *KeyManager) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	keys = m
+}
+
+// currentKeys は UseKeyManager で設定した鍵を返す。未設定ならエラーにする
+func currentKeys() (*KeyManager, error) {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	if keys == nil {
+		return nil, ErrNoKeyManager
+	}
+	return keys, nil
+}
+
+// HandleJWKS は GET /.well-known/jwks.json で検証用の公開鍵を返す
+func HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	m, err := currentKeys()
+	if err != nil {
+		http.Error(w, "No signing keys configured", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string][]JWK{"keys": m.JWKS()})
+}
+
+func readPEMKey(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+}
@@ -0,0 +1,150 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"faq-search-ai/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": 1, "username": "testuser", "jti": "t", "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func TestKeyManagerRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	before, err := auth.NewKeyManager(oldKey)
+	if err != nil {
+		t.Fatalf("NewKeyManager failed: %v", err)
+	}
+	oldToken, _ := before.Sign(claims())
+
+	// 新しい鍵で署名しつつ、古い鍵で署名済みのトークンも受け付ける
+	during, err := auth.NewKeyManager(newKey, oldKey.Public())
+	if err != nil {
+		t.Fatalf("NewKeyManager failed: %v", err)
+	}
+	newToken, _ := during.Sign(claims())
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := during.Parse(token, jwt.MapClaims{}); err != nil {
+			t.Errorf("%s token rejected during rotation: %v", name, err)
+		}
+	}
+	parsed, _ := jwt.Parse(newToken, nil)
+	if parsed.Method.Alg() != "EdDSA" || parsed.Header["kid"] == "" {
+		t.Errorf("unexpected header: %v", parsed.Header)
+	}
+
+	// 古い鍵を外した後は受け付けない
+	after, _ := auth.NewKeyManager(newKey)
+	if _, err := after.Parse(oldToken, jwt.MapClaims{}); err == nil {
+		t.Error("expected token signed with the retired key to be rejected")
+	}
+
+	if jwks := during.JWKS(); len(jwks) != 2 || jwks[0].Kty != "OKP" || jwks[1].Kty != "RSA" || jwks[1].Alg != "RS256" {
+		t.Errorf("unexpected JWKS: %+v", jwks)
+	}
+}
+
+func TestKeyManagerAlgorithmPinning(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	m, _ := auth.NewKeyManager(key)
+	kid := m.JWKS()[0].Kid
+
+	// 公開鍵を HMAC の共有鍵として使う alg 混同攻撃
+	pub, _ := x509.MarshalPKIXPublicKey(key.Public())
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	forged.Header["kid"] = kid
+	hs, _ := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+	if _, err := m.Parse(hs, jwt.MapClaims{}); err == nil {
+		t.Error("expected HS256 token with an RSA kid to be rejected")
+	}
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, claims())
+	none.Header["kid"] = kid
+	unsigned, _ := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := m.Parse(unsigned, jwt.MapClaims{}); err == nil {
+		t.Error("expected alg none to be rejected")
+	}
+
+	valid := jwt.NewWithClaims(jwt.SigningMethodRS256, claims())
+	noKid, _ := valid.SignedString(key)
+	if _, err := m.Parse(noKid, jwt.MapClaims{}); err == nil {
+		t.Error("expected token without kid to be rejected")
+	}
+
+	small, _ := rsa.GenerateKey(rand.Reader, 1024)
+	if _, err := auth.NewKeyManager(small); err == nil {
+		t.Error("expected 1024-bit RSA key to be refused")
+	}
+}
+
+func TestLoadKeyManagerAndJWKS(t *testing.T) {
+	dir := t.TempDir()
+	_, signing, _ := ed25519.GenerateKey(rand.Reader)
+	retired, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	der, _ := x509.MarshalPKCS8PrivateKey(signing)
+	signingPath := filepath.Join(dir, "signing.pem")
+	os.WriteFile(signingPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	pub, _ := x509.MarshalPKIXPublicKey(retired.Public())
+	retiredPath := filepath.Join(dir, "retired.pem")
+	os.WriteFile(retiredPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0o600)
+
+	m, err := auth.LoadKeyManager(signingPath, []string{retiredPath})
+	if err != nil {
+		t.Fatalf("LoadKeyManager failed: %v", err)
+	}
+	auth.UseKeyManager(m)
+	t.Cleanup(func() { auth.UseKeyManager(nil) })
+
+	token, err := m.Sign(jwt.MapClaims{"user_id": 7, "username": "keyuser", "exp": time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if userID, username, err := auth.ParseJWT(token); err != nil || userID != 7 || username != "keyuser" {
+		t.Errorf("ParseJWT = %d, %q, %v", userID, username, err)
+	}
+
+	rr := httptest.NewRecorder()
+	auth.HandleJWKS(rr, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("jwks: expected 200, got %d", rr.Code)
+	}
+	var body struct {
+		Keys []auth.JWK `json:"keys"`
+	}
+	json.NewDecoder(rr.Body).Decode(&body)
+	if len(body.Keys) != 2 || body.Keys[0].Crv != "Ed25519" || body.Keys[1].N == "" {
+		t.Errorf("unexpected jwks: %+v", body.Keys)
+	}
+}
+
+func TestKeysRequireKeyManager(t *testing.T) {
+	auth.UseKeyManager(nil)
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	// JWT_SECRET があっても UseKeyManager なしではトークンを検証しない
+	if _, _, err := auth.ParseJWT("token"); !errors.Is(err, auth.ErrNoKeyManager) {
+		t.Errorf("expected ErrNoKeyManager, got %v", err)
+	}
+	rr := httptest.NewRecorder()
+	auth.HandleJWKS(rr, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("jwks: expected 500, got %d", rr.Code)
+	}
+}
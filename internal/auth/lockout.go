@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// LoginThrottle はログイン失敗に対する遅延とロックの設定
+type LoginThrottle struct {
+	// FreeAttempts 回までの失敗は遅延なしで再試行できる
+	FreeAttempts int
+	// BaseDelay から失敗のたびに倍になり、MaxDelay で頭打ちになる
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// 失敗がこの回数に達すると LockDuration の間ロックする
+	AccountLockAfter int
+	IPLockAfter      int
+	LockDuration     time.Duration
+	// 最後の失敗から Window を過ぎると回数をリセットする
+	Window time.Duration
+}
+
+// LoginPolicy はログインに適用する設定。IP は共有されることがあるので閾値を高くしている
+var LoginPolicy = LoginThrottle{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         30 * time.Second,
+	AccountLockAfter: 10,
+	IPLockAfter:      100,
+	LockDuration:     15 * time.Minute,
+	Window:           15 * time.Minute,
+}
+
+// Lockout は login_failures の 1 行
+type Lockout struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// AccountKey と IPKey は login_failures のキー
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// passwordResetKey はパスワード再設定の依頼を数えるキー。ログインの失敗とは別に数える
+func passwordResetKey(key string) string {
+	return "password-reset:" + key
+}
+
+// LoginRetryAfter はキーのどれかが遅延中かロック中なら、次に試行できるまでの時間を返す
+func (r *Repository) LoginRetryAfter(keys ...string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		l, err := r.getLockout(key)
+		if err != nil {
+			return 0, err
+		}
+		if l == nil {
+			continue
+		}
+		if d := LoginPolicy.nextAttempt(l).Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure は各キーの失敗回数を増やし、閾値に達したらロックする
+func (r *Repository) RecordLoginFailure(accountKey, ipKey string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, k := range []struct {
+		key       string
+		lockAfter int
+	}{{accountKey, LoginPolicy.AccountLockAfter}, {ipKey, LoginPolicy.IPLockAfter}} {
+		failures := 0
+		var last time.Time
+		err := tx.QueryRow(`SELECT failures, last_failure_at FROM login_failures WHERE key = ?`, k.key).Scan(&failures, &last)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if now.Sub(last) > LoginPolicy.Window {
+			failures = 0
+		}
+		failures++
+		var lockedUntil *time.Time
+		if k.lockAfter > 0 && failures >= k.lockAfter {
+			until := now.Add(LoginPolicy.LockDuration)
+			lockedUntil = &until
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO login_failures (key, failures, last_failure_at, locked_until) VALUES (?, ?, ?, ?)
+			ON CONFLICT(key) DO UPDATE SET failures = excluded.failures,
+				last_failure_at = excluded.last_failure_at, locked_until = excluded.locked_until`,
+			k.key, failures, now, lockedUntil); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ResetLoginFailures はキーの記録を消す。ログイン成功時と管理者によるロック解除で使う
+func (r *Repository) ResetLoginFailures(key string) (bool, error) {
+	result, err := r.DB.Exec(`DELETE FROM login_failures WHERE key = ?`, key)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListLockouts は遅延中かロック中のキーを返す
+func (r *Repository) ListLockouts() ([]Lockout, error) {
+	rows, err := r.DB.Query(`
+		SELECT key, failures, last_failure_at, locked_until FROM login_failures
+		WHERE last_failure_at > ? ORDER BY last_failure_at DESC`, time.Now().Add(-LoginPolicy.Window-LoginPolicy.LockDuration))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	lockouts := []Lockout{}
+	for rows.Next() {
+		var l Lockout
+		if err := rows.Scan(&l.Key, &l.Failures, &l.LastFailureAt, &l.LockedUntil); err != nil {
+			return nil, err
+		}
+		if LoginPolicy.nextAttempt(&l).After(now) {
+			lockouts = append(lockouts, l)
+		}
+	}
+	return lockouts, rows.Err()
+}
+
+func (r *Repository) getLockout(key string) (*Lockout, error) {
+	l := &Lockout{Key: key}
+	err := r.DB.QueryRow(`SELECT failures, last_failure_at, locked_until FROM login_failures WHERE key = ?`, key).
+		Scan(&l.Failures, &l.LastFailureAt, &l.LockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return l, err
+}
+
+// nextAttempt は次に試行できる時刻。ロック中は解除時刻、それ以外は失敗回数に応じた遅延の後
+func (p LoginThrottle) nextAttempt(l *Lockout) time.Time {
+	if l.LockedUntil != nil && l.LockedUntil.After(l.LastFailureAt) {
+		return *l.LockedUntil
+	}
+	if time.Since(l.LastFailureAt) > p.Window || l.Failures <= p.FreeAttempts {
+		return time.Time{}
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < l.Failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return l.LastFailureAt.Add(delay)
+}
@@ -0,0 +1,129 @@
+package auth_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func attempt(h *auth.AuthHandler, email, password, ip string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"email": email, "password": password})
+	req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	req.RemoteAddr = ip + ":40000"
+	rr := httptest.NewRecorder()
+	h.Login(rr, req)
+	return rr
+}
+
+func usePolicy(t *testing.T, p auth.LoginThrottle) {
+	saved := auth.LoginPolicy
+	auth.LoginPolicy = p
+	t.Cleanup(func() { auth.LoginPolicy = saved })
+}
+
+func TestLoginFailuresAreUniform(t *testing.T) {
+	h := setupTokenTest(t)
+	unknown := attempt(h, "nobody@example.com", "pass1234word", "10.0.0.1")
+	wrong := attempt(h, "a@example.com", "wrong", "10.0.0.1")
+	if unknown.Code != http.StatusUnauthorized || wrong.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for both, got %d and %d", unknown.Code, wrong.Code)
+	}
+	if unknown.Body.String() != wrong.Body.String() {
+		t.Errorf("responses differ: %q and %q", unknown.Body, wrong.Body)
+	}
+}
+
+func TestLoginProgressiveDelay(t *testing.T) {
+	h := setupTokenTest(t)
+	usePolicy(t, auth.LoginThrottle{FreeAttempts: 2, BaseDelay: time.Hour, MaxDelay: 2 * time.Hour, Window: 3 * time.Hour})
+
+	for i := 0; i < 3; i++ {
+		if rr := attempt(h, "a@example.com", "wrong", "10.0.0.1"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, rr.Code)
+		}
+	}
+	// 正しいパスワードでも遅延が明けるまでは試せない。別の IP からでも同じ
+	rr := attempt(h, "a@example.com", "pass1234word", "10.0.0.2")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	if retry, _ := strconv.Atoi(rr.Header().Get("Retry-After")); retry < 3500 || retry > 3600 {
+		t.Errorf("expected Retry-After about an hour, got %q", rr.Header().Get("Retry-After"))
+	}
+	// 他のアカウントには影響しない
+	if rr := attempt(h, "b@example.com", "wrong", "10.0.0.2"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("other account: expected 401, got %d", rr.Code)
+	}
+}
+
+func TestLoginLockoutAndAdminUnlock(t *testing.T) {
+	h := setupTokenTest(t)
+	session := login(t, h)
+	usePolicy(t, auth.LoginThrottle{AccountLockAfter: 3, IPLockAfter: 5, LockDuration: time.Hour, Window: time.Hour})
+	if err := h.Repo.SetUserRole(1, auth.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		attempt(h, "a@example.com", "wrong", "10.0.0.1")
+	}
+	if rr := attempt(h, "a@example.com", "pass1234word", "10.0.0.9"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked account: expected 429, got %d", rr.Code)
+	}
+
+	// 同じ IP から別々のアカウントを狙っても IP 単位でロックされる
+	for _, email := range []string{"b@example.com", "c@example.com"} {
+		attempt(h, email, "wrong", "10.0.0.1")
+	}
+	if rr := attempt(h, "d@example.com", "wrong", "10.0.0.1"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked ip: expected 429, got %d", rr.Code)
+	}
+
+	admin := auth.JWTAuthMiddleware(h.Repo)(h.RequireAdmin(routes(map[string]http.HandlerFunc{
+		"GET /admin/lockouts":         h.ListLockouts,
+		"POST /admin/lockouts/unlock": h.Unlock,
+	})))
+	call := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(b))
+		req.Header.Set("Authorization", "Bearer "+session.Token)
+		rr := httptest.NewRecorder()
+		admin.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := call("GET", "/admin/lockouts", nil)
+	var lockouts []auth.Lockout
+	json.NewDecoder(rr.Body).Decode(&lockouts)
+	if rr.Code != http.StatusOK || len(lockouts) != 2 {
+		t.Fatalf("expected 2 lockouts, got %d: %+v", rr.Code, lockouts)
+	}
+
+	if rr := call("POST", "/admin/lockouts/unlock", map[string]string{"email": "A@example.com"}); rr.Code != http.StatusNoContent {
+		t.Fatalf("unlock email: expected 204, got %d", rr.Code)
+	}
+	if rr := call("POST", "/admin/lockouts/unlock", map[string]string{"ip": "10.0.0.1"}); rr.Code != http.StatusNoContent {
+		t.Fatalf("unlock ip: expected 204, got %d", rr.Code)
+	}
+	if rr := call("POST", "/admin/lockouts/unlock", map[string]string{"ip": "10.0.0.1"}); rr.Code != http.StatusNotFound {
+		t.Errorf("unlock again: expected 404, got %d", rr.Code)
+	}
+	if rr := attempt(h, "a@example.com", "pass1234word", "10.0.0.1"); rr.Code != http.StatusOK {
+		t.Errorf("after unlock: expected 200, got %d", rr.Code)
+	}
+	events, _ := audit.List(h.Repo.DB, audit.Filter{Actions: []string{audit.ActionLoginUnlocked}}, 0, 0)
+	if len(events) != 2 || events[0].ActorID != 1 {
+		t.Errorf("expected two audited unlocks by the admin, got %+v", events)
+	}
+
+	h.Repo.SetUserRole(1, auth.RoleUser)
+	if rr := call("GET", "/admin/lockouts", nil); rr.Code != http.StatusForbidden {
+		t.Errorf("non-admin: expected 403, got %d", rr.Code)
+	}
+}
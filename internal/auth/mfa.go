@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	purposeMFAChallenge = "mfa_challenge"
+	// recoveryCodeCount は一度に発行するリカバリーコードの数
+	recoveryCodeCount = 10
+)
+
+// MFAChallengeTTL はパスワードの確認からコードの入力までの猶予
+var MFAChallengeTTL = 5 * time.Minute
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled    = errors.New("two-factor authentication is not set up")
+	ErrInvalidMFACode    = errors.New("invalid authentication code")
+)
+
+// MFAStatus は GET /me/mfa の応答
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// BeginMFAEnrollment は新しい秘密鍵を保存し、認証アプリ用の URI とともに返す。
+// 登録途中の鍵は上書きする。VerifyMFAEnrollment で確認するまで有効にならない
+func (r *Repository) BeginMFAEnrollment(user *User) (string, string, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	result, err := r.DB.Exec(`
+		INSERT INTO user_mfa (user_id, secret) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE user_mfa.enabled_at IS NULL`, user.ID, secret)
+	if err != nil {
+		return "", "", err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+	return secret, totpURI(secret, user.Email), nil
+}
+
+// VerifyMFAEnrollment は認証アプリのコードを確認して二段階認証を有効にし、リカバリーコードを返す
+func (r *Repository) VerifyMFAEnrollment(userID int64, code string) ([]string, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var secret string
+	var enabledAt *time.Time
+	err = tx.QueryRow(`SELECT secret, enabled_at FROM user_mfa WHERE user_id = ?`, userID).Scan(&secret, &enabledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	step, ok := matchTOTP(secret, code, time.Now(), 0)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	if _, err := tx.Exec(`UPDATE user_mfa SET enabled_at = ?, last_used_step = ? WHERE user_id = ?`, time.Now(), step, userID); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// RegenerateRecoveryCodes は確認コードを検証してリカバリーコードを作り直す。古いコードは使えなくなる
+func (r *Repository) RegenerateRecoveryCodes(userID int64, code string) ([]string, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := verifyMFACode(tx, userID, code); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// DisableMFA は確認コードを検証して二段階認証を解除する
+func (r *Repository) DisableMFA(userID int64, code string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := verifyMFACode(tx, userID, code); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_mfa WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetMFAStatus は二段階認証が有効かと、未使用のリカバリーコードの数を返す
+func (r *Repository) GetMFAStatus(userID int64) (*MFAStatus, error) {
+	status := &MFAStatus{}
+	err := r.DB.QueryRow(`
+		SELECT m.enabled_at IS NOT NULL,
+			(SELECT COUNT(*) FROM mfa_recovery_codes c WHERE c.user_id = m.user_id AND c.used_at IS NULL)
+		FROM user_mfa m WHERE m.user_id = ?`, userID).Scan(&status.Enabled, &status.RecoveryCodesRemaining)
+	if errors.Is(err, sql.ErrNoRows) {
+		return status, nil
+	}
+	return status, err
+}
+
+// CreateMFAChallenge はパスワードを確認したユーザーに二段階目で使うトークンを発行する
+func (r *Repository) CreateMFAChallenge(userID int64) (string, error) {
+	return r.createUserToken(userID, purposeMFAChallenge, MFAChallengeTTL)
+}
+
+// MFAChallengeUser はトークンを消費せずに持ち主を返す。コードを間違えても再入力できるようにするため
+func (r *Repository) MFAChallengeUser(plain string) (*User, error) {
+	var userID int64
+	var expiresAt time.Time
+	err := r.DB.QueryRow(`
+		SELECT user_id, expires_at FROM user_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL`, hashToken(plain), purposeMFAChallenge).
+		Scan(&userID, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && time.Now().After(expiresAt)) {
+		return nil, ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.GetUserByID(userID)
+}
+
+// CompleteMFAChallenge はコードを検証し、正しければトークンを使用済みにする
+func (r *Repository) CompleteMFAChallenge(plain, code string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRow(`
+		SELECT user_id FROM user_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL`, hashToken(plain), purposeMFAChallenge).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidUserToken
+	}
+	if err != nil {
+		return err
+	}
+	if err := verifyMFACode(tx, userID, code); err != nil {
+		return err
+	}
+	if _, err := consumeUserToken(tx, purposeMFAChallenge, plain); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// verifyMFACode は TOTP のコードかリカバリーコードを検証する。
+// 受け付けた TOTP の時間枠とリカバリーコードは使用済みにする
+func verifyMFACode(tx *sql.Tx, userID int64, code string) error {
+	var secret string
+	var lastStep int64
+	err := tx.QueryRow(`
+		SELECT secret, last_used_step FROM user_mfa
+		WHERE user_id = ? AND enabled_at IS NOT NULL`, userID).Scan(&secret, &lastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrMFANotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+
+	if step, ok := matchTOTP(secret, code, time.Now(), lastStep); ok {
+		_, err := tx.Exec(`UPDATE user_mfa SET last_used_step = ? WHERE user_id = ?`, step, userID)
+		return err
+	}
+	result, err := tx.Exec(`
+		UPDATE mfa_recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`, time.Now(), userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int64) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hashToken(normalizeRecoveryCode(code))); err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+	return codes, nil
+}
+
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// newRecoveryCode は 80 ビットの乱数を xxxx-xxxx-xxxx-xxxx の形で返す
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := recoveryEncoding.EncodeToString(b)
+	return s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16], nil
+}
+
+// normalizeRecoveryCode は入力の揺れ (大文字、区切り、空白) を吸収する
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
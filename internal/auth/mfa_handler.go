@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/middleware"
+	"log"
+	"net/http"
+)
+
+// challengeMFA はパスワードを確認したユーザーに二段階目のトークンを返す。アクセストークンはまだ発行しない
+func (h *AuthHandler) challengeMFA(w http.ResponseWriter, user *User) {
+	token, err := h.Repo.CreateMFAChallenge(user.ID)
+	if err != nil {
+		log.Printf("CreateMFAChallenge error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "could not log in",
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mfa_required": true,
+		"mfa_token":    token,
+		"expires_in":   int64(MFAChallengeTTL.Seconds()),
+	})
+}
+
+// LoginMFA は POST /login/mfa で二段階目のトークンと認証コード (またはリカバリーコード) をトークンの組と交換する。
+// コードの失敗もログインの失敗として数える
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "invalid request",
+		})
+		return
+	}
+
+	user, err := h.Repo.MFAChallengeUser(req.MFAToken)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidUserToken) {
+			log.Printf("MFAChallengeUser error: %v", err)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "login request is invalid or expired, log in again",
+		})
+		return
+	}
+	if user.DisabledAt != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": ErrAccountDisabled.Error(),
+		})
+		return
+	}
+	accountKey, ipKey := AccountKey(user.Email), IPKey(middleware.ClientIP(r))
+	if h.throttled(w, accountKey, ipKey) {
+		return
+	}
+
+	err = h.Repo.CompleteMFAChallenge(req.MFAToken, req.Code)
+	switch {
+	case errors.Is(err, ErrInvalidMFACode):
+		auditLogin(h.Repo.DB, r, audit.ActionLoginFailed, "mfa", user, user.Email)
+		if err := h.Repo.RecordLoginFailure(accountKey, ipKey); err != nil {
+			log.Printf("RecordLoginFailure error: %v", err)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	case errors.Is(err, ErrInvalidUserToken), errors.Is(err, ErrMFANotEnrolled):
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "login request is invalid or expired, log in again",
+		})
+		return
+	case err != nil:
+		log.Printf("CompleteMFAChallenge error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "could not log in",
+		})
+		return
+	}
+	if _, err := h.Repo.ResetLoginFailures(accountKey); err != nil {
+		log.Printf("ResetLoginFailures error: %v", err)
+	}
+
+	pair, err := h.Repo.IssueTokens(user, ClientFrom(r))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "could not generate token",
+		})
+		return
+	}
+	auditLogin(h.Repo.DB, r, audit.ActionLogin, "mfa", user, user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pair)
+}
+
+// MFAStatus は GET /me/mfa で二段階認証が有効かどうかと残りのリカバリーコードの数を返す
+func (h *AuthHandler) MFAStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	status, err := h.Repo.GetMFAStatus(userID)
+	if err != nil {
+		log.Printf("GetMFAStatus error: %v", err)
+		http.Error(w, "Failed to get two-factor status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// EnrollMFA は POST /me/mfa/enroll で秘密鍵と otpauth:// の URI を発行する
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.Repo.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	secret, uri, err := h.Repo.BeginMFAEnrollment(user)
+	if errors.Is(err, ErrMFAAlreadyEnabled) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("BeginMFAEnrollment error: %v", err)
+		http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"secret": secret, "otpauth_uri": uri})
+}
+
+// VerifyMFA は POST /me/mfa/verify {"code"} で認証アプリのコードを確認して有効にし、リカバリーコードを返す
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	h.withMFACode(w, r, h.Repo.VerifyMFAEnrollment)
+}
+
+// RegenerateRecoveryCodes は POST /me/mfa/recovery-codes {"code"} でリカバリーコードを作り直す
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	h.withMFACode(w, r, h.Repo.RegenerateRecoveryCodes)
+}
+
+// DisableMFA は DELETE /me/mfa {"code"} で二段階認証を無効にする
+func (h *AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	h.withMFACode(w, r, func(userID int64, code string) ([]string, error) {
+		return nil, h.Repo.DisableMFA(userID, code)
+	})
+}
+
+// withMFACode は本文の認証コードで op を呼ぶ。op がリカバリーコードを返せばそれを、無ければ 204 を返す。
+// 盗まれたセッションでコードを総当たりされないよう、コードの失敗はログインの失敗として数える
+func (h *AuthHandler) withMFACode(w http.ResponseWriter, r *http.Request, op func(userID int64, code string) ([]string, error)) {
+	userID, ok := r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.Repo.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+	accountKey, ipKey := AccountKey(user.Email), IPKey(middleware.ClientIP(r))
+	if h.throttled(w, accountKey, ipKey) {
+		return
+	}
+
+	codes, err := op(userID, req.Code)
+	switch {
+	case errors.Is(err, ErrInvalidMFACode):
+		if err := h.Repo.RecordLoginFailure(accountKey, ipKey); err != nil {
+			log.Printf("RecordLoginFailure error: %v", err)
+		}
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, ErrMFANotEnrolled), errors.Is(err, ErrMFAAlreadyEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("MFA %s error: %v", r.Method+" "+r.URL.Path, err)
+		http.Error(w, "Failed to update two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.Repo.ResetLoginFailures(accountKey); err != nil {
+		log.Printf("ResetLoginFailures error: %v", err)
+	}
+	if codes == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
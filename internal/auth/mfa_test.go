@@ -0,0 +1,219 @@
+package auth_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"faq-search-ai/internal/auth"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// totp は認証アプリと同じ計算で at の時点のコードを返す
+func totp(secret string, at time.Time) string {
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	return hotp(key, at.Unix()/30, 6)
+}
+
+func hotp(key []byte, counter int64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+func TestHOTPVector(t *testing.T) {
+	// RFC 6238 付録 B の SHA-1 のテストベクター
+	if got := hotp([]byte("12345678901234567890"), 59/30, 8); got != "94287082" {
+		t.Fatalf("unexpected code %s", got)
+	}
+}
+
+func mfaCall(h *auth.AuthHandler, access, method, path string, body interface{}) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewBuffer(b))
+	req.Header.Set("Authorization", "Bearer "+access)
+	rr := httptest.NewRecorder()
+	auth.JWTAuthMiddleware(h.Repo)(routes(map[string]http.HandlerFunc{
+		"GET /me/mfa":                 h.MFAStatus,
+		"DELETE /me/mfa":              h.DisableMFA,
+		"POST /me/mfa/enroll":         h.EnrollMFA,
+		"POST /me/mfa/verify":         h.VerifyMFA,
+		"POST /me/mfa/recovery-codes": h.RegenerateRecoveryCodes,
+	})).ServeHTTP(rr, req)
+	return rr
+}
+
+// enrollMFA は二段階認証を有効にし、秘密鍵とリカバリーコードを返す
+func enrollMFA(t *testing.T, h *auth.AuthHandler, access string) (string, []string) {
+	t.Helper()
+	rr := mfaCall(h, access, "POST", "/me/mfa/enroll", nil)
+	var enrollment struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+	json.NewDecoder(rr.Body).Decode(&enrollment)
+	if rr.Code != http.StatusOK || enrollment.Secret == "" {
+		t.Fatalf("enroll: expected secret, got %d", rr.Code)
+	}
+	uri, err := url.Parse(enrollment.OTPAuthURI)
+	if err != nil || uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Query().Get("secret") != enrollment.Secret ||
+		!strings.HasSuffix(uri.Path, ":a@example.com") {
+		t.Fatalf("unexpected otpauth URI %q", enrollment.OTPAuthURI)
+	}
+
+	if rr := mfaCall(h, access, "POST", "/me/mfa/verify", map[string]string{"code": "000000"}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("verify with wrong code: expected 401, got %d", rr.Code)
+	}
+	rr = mfaCall(h, access, "POST", "/me/mfa/verify", map[string]string{"code": totp(enrollment.Secret, time.Now())})
+	var verified struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(rr.Body).Decode(&verified)
+	if rr.Code != http.StatusOK || len(verified.RecoveryCodes) != 10 {
+		t.Fatalf("verify: expected 10 recovery codes, got %d %v", rr.Code, verified.RecoveryCodes)
+	}
+	return enrollment.Secret, verified.RecoveryCodes
+}
+
+func loginMFA(h *auth.AuthHandler, token, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"mfa_token": token, "code": code})
+	rr := httptest.NewRecorder()
+	h.LoginMFA(rr, httptest.NewRequest("POST", "/login/mfa", bytes.NewBuffer(body)))
+	return rr
+}
+
+// passwordStep はパスワードでログインし、二段階目のトークンを返す
+func passwordStep(t *testing.T, h *auth.AuthHandler) string {
+	t.Helper()
+	rr := attempt(h, "a@example.com", "pass1234word", "10.0.0.1")
+	var challenge struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		Token       string `json:"token"`
+	}
+	json.NewDecoder(rr.Body).Decode(&challenge)
+	if rr.Code != http.StatusOK || !challenge.MFARequired || challenge.MFAToken == "" || challenge.Token != "" {
+		t.Fatalf("expected an MFA challenge without tokens, got %d %+v", rr.Code, challenge)
+	}
+	return challenge.MFAToken
+}
+
+func TestMFALogin(t *testing.T) {
+	h := setupTokenTest(t)
+	// 間違えたコードは同じ IP の失敗として積み重なるので、ここでは遅延させない
+	policy := auth.LoginPolicy
+	policy.FreeAttempts = 10
+	usePolicy(t, policy)
+	session := login(t, h)
+	secret, recovery := enrollMFA(t, h, session.Token)
+
+	if rr := mfaCall(h, session.Token, "POST", "/me/mfa/enroll", nil); rr.Code != http.StatusConflict {
+		t.Errorf("enroll twice: expected 409, got %d", rr.Code)
+	}
+
+	challenge := passwordStep(t, h)
+	if rr := loginMFA(h, challenge, "123456"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code: expected 401, got %d", rr.Code)
+	}
+	// 登録で使ったコードは再利用できないので、次の時間枠のコードを使う
+	if rr := loginMFA(h, challenge, totp(secret, time.Now())); rr.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code: expected 401, got %d", rr.Code)
+	}
+	rr := loginMFA(h, challenge, totp(secret, time.Now().Add(30*time.Second)))
+	var pair auth.TokenPair
+	json.NewDecoder(rr.Body).Decode(&pair)
+	if rr.Code != http.StatusOK || !authorized(h, pair.Token) {
+		t.Fatalf("valid code: expected a working token pair, got %d", rr.Code)
+	}
+	if rr := loginMFA(h, challenge, totp(secret, time.Now().Add(30*time.Second))); rr.Code != http.StatusUnauthorized {
+		t.Errorf("reused challenge: expected 401, got %d", rr.Code)
+	}
+
+	// リカバリーコードは一度だけ使える。表記の揺れは許す
+	if rr := loginMFA(h, passwordStep(t, h), strings.ToUpper(recovery[0])); rr.Code != http.StatusOK {
+		t.Fatalf("recovery code: expected 200, got %d", rr.Code)
+	}
+	if rr := loginMFA(h, passwordStep(t, h), recovery[0]); rr.Code != http.StatusUnauthorized {
+		t.Errorf("used recovery code: expected 401, got %d", rr.Code)
+	}
+
+	rr = mfaCall(h, session.Token, "GET", "/me/mfa", nil)
+	var status auth.MFAStatus
+	json.NewDecoder(rr.Body).Decode(&status)
+	if !status.Enabled || status.RecoveryCodesRemaining != 9 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	if rr := mfaCall(h, session.Token, "DELETE", "/me/mfa", map[string]string{"code": recovery[1]}); rr.Code != http.StatusNoContent {
+		t.Fatalf("disable: expected 204, got %d", rr.Code)
+	}
+	login(t, h)
+}
+
+func TestMFARecoveryCodesStoredHashed(t *testing.T) {
+	h := setupTokenTest(t)
+	session := login(t, h)
+	_, recovery := enrollMFA(t, h, session.Token)
+
+	var stored string
+	if err := h.Repo.DB.QueryRow(`SELECT group_concat(code_hash) FROM mfa_recovery_codes`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range recovery {
+		if strings.Contains(stored, strings.ReplaceAll(code, "-", "")) || strings.Contains(stored, code) {
+			t.Fatalf("recovery code %s stored in plain text", code)
+		}
+	}
+}
+
+func TestMFAFailuresAreThrottled(t *testing.T) {
+	h := setupTokenTest(t)
+	session := login(t, h)
+	secret, _ := enrollMFA(t, h, session.Token)
+	usePolicy(t, auth.LoginThrottle{AccountLockAfter: 3, IPLockAfter: 100, LockDuration: time.Hour, Window: time.Hour})
+
+	challenge := passwordStep(t, h)
+	for i := 0; i < 3; i++ {
+		loginMFA(h, challenge, "000000")
+	}
+	if rr := loginMFA(h, challenge, totp(secret, time.Now().Add(30*time.Second))); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after repeated wrong codes, got %d", rr.Code)
+	}
+}
+
+func TestMFAManagementFailuresAreThrottled(t *testing.T) {
+	h := setupTokenTest(t)
+	session := login(t, h)
+	secret, _ := enrollMFA(t, h, session.Token)
+	usePolicy(t, auth.LoginThrottle{AccountLockAfter: 3, IPLockAfter: 100, LockDuration: time.Hour, Window: time.Hour})
+
+	// 認証コードを確かめる操作はどれもログインの失敗として数える
+	mfaCall(h, session.Token, "DELETE", "/me/mfa", map[string]string{"code": "000000"})
+	mfaCall(h, session.Token, "POST", "/me/mfa/recovery-codes", map[string]string{"code": "000000"})
+	if rr := mfaCall(h, session.Token, "DELETE", "/me/mfa", map[string]string{"code": "000000"}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code: expected 401, got %d", rr.Code)
+	}
+	if rr := mfaCall(h, session.Token, "DELETE", "/me/mfa", map[string]string{"code": totp(secret, time.Now().Add(30*time.Second))}); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after repeated wrong codes, got %d", rr.Code)
+	}
+	if rr := attempt(h, "a@example.com", "pass1234word", "10.0.0.1"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("login: expected the account to be locked, got %d", rr.Code)
+	}
+}
@@ -2,6 +2,10 @@ package auth
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"faq-search-ai/internal/middleware"
+	"log"
 	"net/http"
 	"strings"
 )
@@ -11,25 +15,130 @@ type contextKey string
 const (
 	UserIDContextKey   = contextKey("user_id")
 	UsernameContextKey = contextKey("username")
+	// APIKeyContextKey は API キーで認証したときだけ *APIKey が入る
+	APIKeyContextKey = contextKey("api_key")
+	// ClaimsContextKey は JWT で認証したときだけ *AccessClaims が入る
+	ClaimsContextKey = contextKey("claims")
 )
 
-func JWTAuthMiddleware(next http.Handler) http.Handler {
+// JWTAuthMiddleware は JWT で認証する。トークンの失効とセッションは repo で確認する
+func JWTAuthMiddleware(repo *Repository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+			claims, err := ParseAccessToken(tokenStr)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			// jti やセッションの無いトークンは失効させられないので受け付けない
+			if claims.TokenID == "" || claims.SessionID == "" {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			revoked, err := repo.IsRevoked(claims.TokenID)
+			if err != nil {
+				log.Printf("IsRevoked error: %v", err)
+				http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+				return
+			}
+			err = repo.TouchSession(claims.SessionID, claims.UserID, middleware.ClientIP(r))
+			if errors.Is(err, ErrSessionNotFound) {
+				http.Error(w, "Session has been revoked", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				log.Printf("TouchSession error: %v", err)
+				http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+				return
+			}
+
+			ctx := withUser(r.Context(), claims.UserID, claims.Username)
+			ctx = context.WithValue(ctx, ClaimsContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RejectImpersonation は管理者の代理ログインでは使わせない操作 (パスワードや二段階認証の変更など) を 403 にする。
+// JWTAuthMiddleware の内側で使う
+func RejectImpersonation(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		if claims, ok := r.Context().Value(ClaimsContextKey).(*AccessClaims); ok && claims.ImpersonatorID != 0 {
+			http.Error(w, "Forbidden: not allowed while impersonating", http.StatusForbidden)
 			return
 		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		userID, username, err := ParseJWT(tokenStr)
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
+// ScopeFor はリクエストに必要な API キーのスコープを返す
+type ScopeFor func(r *http.Request) string
 
-		ctx := context.WithValue(r.Context(), UserIDContextKey, userID)
-		ctx = context.WithValue(ctx, UsernameContextKey, username)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+// RequireScope はメソッドに関係なく scope を要求する
+func RequireScope(scope string) ScopeFor {
+	return func(*http.Request) string { return scope }
+}
+
+// ReadWriteScope は参照系のメソッドに read、それ以外に write を要求する
+func ReadWriteScope(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ScopeRead
+	}
+	return ScopeWrite
+}
+
+// APIKeyOrJWTMiddleware は API キーか JWT で認証し、JWTAuthMiddleware と同じコンテキストの値を設定する。
+// API キーは X-API-Key ヘッダーか Authorization: Bearer で送り、scope が返すスコープを持つ必要がある。
+// JWT はスコープの制限を受けない
+func APIKeyOrJWTMiddleware(db *sql.DB, scope ScopeFor) func(http.Handler) http.Handler {
+	repo := NewRepository(db)
+	return func(next http.Handler) http.Handler {
+		jwtAuth := JWTAuthMiddleware(repo)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(APIKeyHeader)
+			if bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); key == "" && isAPIKey(bearer) {
+				key = bearer
+			}
+			if key == "" {
+				jwtAuth.ServeHTTP(w, r)
+				return
+			}
+
+			apiKey, username, err := repo.AuthenticateAPIKey(key)
+			if errors.Is(err, ErrAPIKeyNotFound) {
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				log.Printf("AuthenticateAPIKey error: %v", err)
+				http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+				return
+			}
+			if required := scope(r); !apiKey.HasScope(required) {
+				http.Error(w, "Forbidden: API key requires "+required+" scope", http.StatusForbidden)
+				return
+			}
+
+			ctx := withUser(r.Context(), apiKey.UserID, username)
+			ctx = context.WithValue(ctx, APIKeyContextKey, apiKey)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func withUser(ctx context.Context, userID int64, username string) context.Context {
+	ctx = context.WithValue(ctx, UserIDContextKey, userID)
+	return context.WithValue(ctx, UsernameContextKey, username)
 }
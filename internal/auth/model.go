@@ -1,8 +1,41 @@
 package auth
 
+import "time"
+
+// ユーザーの役割。admin は /admin のエンドポイントを使える
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	ID       int64  `json:"id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Password string `json:"-" db:"password_hash"`
+	ID              int64      `json:"id"`
+	Email           string     `json:"email"`
+	Username        string     `json:"username"`
+	Password        string     `json:"-" db:"password_hash"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	Role            string     `json:"role"`
+	DisabledAt      *time.Time `json:"disabled_at,omitempty"`
+}
+
+// APIKey は機械クライアント用のキー。Key は作成時の応答でのみ設定する
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Key        string     `json:"key,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/config"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcFetchTimeout は IdP への 1 回のリクエストの上限
+const oidcFetchTimeout = 10 * time.Second
+
+var (
+	ErrOIDCProviderNotFound = errors.New("unknown identity provider")
+	ErrOIDCTokenInvalid     = errors.New("identity provider returned an invalid ID token")
+	ErrOIDCDomainNotAllowed = errors.New("email domain is not allowed for this provider")
+)
+
+// OIDCProvider は OpenID Connect の IdP。ディスカバリーと JWKS は初回に取得してキャッシュする
+type OIDCProvider struct {
+	config.OIDCProvider
+	Client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	jwks      map[string]verificationKey
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCIdentity は ID トークンから取り出したユーザー情報
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+func NewOIDCProvider(c config.OIDCProvider) *OIDCProvider {
+	// ディスカバリーの issuer と比べるため末尾の / を除いておく
+	c.Issuer = strings.TrimRight(c.Issuer, "/")
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDCProvider{OIDCProvider: c, Client: &http.Client{Timeout: oidcFetchTimeout}}
+}
+
+// AuthCodeURL は認可エンドポイントへのリダイレクト先。PKCE は S256 のみ使う
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange は認可コードを ID トークンと交換し、検証したユーザー情報を返す
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCIdentity, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, ErrOIDCTokenInvalid
+	}
+	return p.verifyIDToken(ctx, d, token.IDToken, nonce)
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, d *oidcDiscovery, raw, nonce string) (*OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.key(ctx, d, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, ErrAlgorithmMismatch
+		}
+		return key.key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCTokenInvalid, err)
+	}
+
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCTokenInvalid)
+	}
+	// 複数の aud があるときは azp が自分でなければならない
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.ClientID {
+			return nil, fmt.Errorf("%w: azp mismatch", ErrOIDCTokenInvalid)
+		}
+	}
+
+	id := &OIDCIdentity{}
+	id.Subject, _ = claims["sub"].(string)
+	if id.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrOIDCTokenInvalid)
+	}
+	id.Email, _ = claims["email"].(string)
+	id.Email = strings.ToLower(strings.TrimSpace(id.Email))
+	// email_verified を文字列で返す IdP もある
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+	for _, claim := range []string{"preferred_username", "name"} {
+		if name, _ := claims[claim].(string); name != "" {
+			id.Name = name
+			break
+		}
+	}
+
+	if len(p.AllowedDomains) > 0 && !p.domainAllowed(id) {
+		return nil, ErrOIDCDomainNotAllowed
+	}
+	return id, nil
+}
+
+func (p *OIDCProvider) domainAllowed(id *OIDCIdentity) bool {
+	at := strings.LastIndex(id.Email, "@")
+	if at < 0 || !id.EmailVerified {
+		return false
+	}
+	domain := id.Email[at+1:]
+	for _, allowed := range p.AllowedDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var d oidcDiscovery
+	if err := p.doJSON(req, &d); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if strings.TrimRight(d.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", d.Issuer, p.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("discovery: missing endpoints")
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// key は kid の検証鍵を返す。知らない kid なら IdP が鍵を更新した可能性があるので取り直す
+func (p *OIDCProvider) key(ctx context.Context, d *oidcDiscovery, kid string) (verificationKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := lookupKey(p.jwks, kid); ok {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return verificationKey{}, err
+	}
+	var set struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := p.doJSON(req, &set); err != nil {
+		return verificationKey{}, fmt.Errorf("jwks: %w", err)
+	}
+	p.jwks = map[string]verificationKey{}
+	for _, jwk := range set.Keys {
+		if key, ok := parseJWK(jwk); ok {
+			p.jwks[jwk.Kid] = key
+		}
+	}
+	if key, ok := lookupKey(p.jwks, kid); ok {
+		return key, nil
+	}
+	return verificationKey{}, ErrUnknownKey
+}
+
+// lookupKey は kid で探す。kid の無いトークンは鍵が 1 つのときだけ受け付ける
+func lookupKey(keys map[string]verificationKey, kid string) (verificationKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+// parseJWK は署名用の RSA と Ed25519 の鍵だけを読む
+func parseJWK(jwk JWK) (verificationKey, bool) {
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return verificationKey{}, false
+	}
+	switch jwk.Kty {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return verificationKey{}, false
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < minRSABits || (jwk.Alg != "" && jwk.Alg != jwt.SigningMethodRS256.Alg()) {
+			return verificationKey{}, false
+		}
+		return verificationKey{method: jwt.SigningMethodRS256, key: pub}, true
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return verificationKey{}, false
+		}
+		return verificationKey{method: jwt.SigningMethodEdDSA, key: ed25519.PublicKey(x)}, true
+	}
+	return verificationKey{}, false
+}
+
+func (p *OIDCProvider) doJSON(req *http.Request, v interface{}) error {
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d: %s", req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/config"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// oidcStateTTL は認可リクエストからコールバックまでの猶予
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	ErrOIDCStateInvalid  = errors.New("login request is invalid or expired")
+	ErrOIDCEmailRequired = errors.New("identity provider did not return an email address")
+	// ErrOIDCEmailInUse は未確認のメールアドレスが既存のユーザーと重なるとき。乗っ取りを防ぐため紐付けない
+	ErrOIDCEmailInUse = errors.New("email address is already registered; verify it with the identity provider to link accounts")
+	// ErrOIDCEmailUnverified は未確認のメールアドレスで新しいユーザーを作ろうとしたとき
+	ErrOIDCEmailUnverified = errors.New("email address is not verified by the identity provider")
+)
+
+type OIDCHandler struct {
+	Repo      *Repository
+	Providers map[string]*OIDCProvider
+}
+
+func NewOIDCHandler(db *sql.DB, providers []config.OIDCProvider) *OIDCHandler {
+	h := &OIDCHandler{Repo: NewRepository(db), Providers: map[string]*OIDCProvider{}}
+	for _, p := range providers {
+		h.Providers[p.Name] = NewOIDCProvider(p)
+	}
+	return h
+}
+
+// ListProviders は GET /auth/oidc で利用できるプロバイダーを一覧する
+func (h *OIDCHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(h.Providers))
+	for name := range h.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"providers": names})
+}
+
+// Login は GET /auth/oidc/{provider}/login で IdP の認可画面へリダイレクトする
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if p, ok := h.provider(w, r); ok {
+		h.login(w, r, p)
+	}
+}
+
+// Callback は GET /auth/oidc/{provider}/callback でコードを交換してログインし、フロントエンドへトークンを渡す
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	if p, ok := h.provider(w, r); ok {
+		h.callback(w, r, p)
+	}
+}
+
+// provider はパスの {provider} に対応するプロバイダーを返す。設定に無ければ 404 を返す
+func (h *OIDCHandler) provider(w http.ResponseWriter, r *http.Request) (*OIDCProvider, bool) {
+	p, ok := h.Providers[r.PathValue("provider")]
+	if !ok {
+		http.NotFound(w, r)
+	}
+	return p, ok
+}
+
+func (h *OIDCHandler) login(w http.ResponseWriter, r *http.Request, p *OIDCProvider) {
+	state, errState := newOpaqueToken()
+	nonce, errNonce := newOpaqueToken()
+	verifier, errVerifier := newOpaqueToken()
+	if errState != nil || errNonce != nil || errVerifier != nil {
+		http.Error(w, "could not start login", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Repo.saveOIDCState(p.Name, state, nonce, verifier); err != nil {
+		log.Printf("saveOIDCState error: %v", err)
+		http.Error(w, "could not start login", http.StatusInternalServerError)
+		return
+	}
+	target, err := p.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("OIDC %s discovery error: %v", p.Name, err)
+		http.Error(w, "identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (h *OIDCHandler) callback(w http.ResponseWriter, r *http.Request, p *OIDCProvider) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "login was cancelled or denied: "+e, http.StatusUnauthorized)
+		return
+	}
+	nonce, verifier, err := h.Repo.consumeOIDCState(p.Name, q.Get("state"))
+	if errors.Is(err, ErrOIDCStateInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("consumeOIDCState error: %v", err)
+		http.Error(w, "could not complete login", http.StatusInternalServerError)
+		return
+	}
+	if q.Get("code") == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	identity, err := p.Exchange(r.Context(), q.Get("code"), verifier, nonce)
+	if errors.Is(err, ErrOIDCDomainNotAllowed) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("OIDC %s exchange error: %v", p.Name, err)
+		http.Error(w, "could not verify identity", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.Repo.ProvisionOIDCUser(p.Name, identity)
+	switch {
+	case errors.Is(err, ErrOIDCEmailRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrOIDCEmailInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, ErrOIDCEmailUnverified):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		log.Printf("ProvisionOIDCUser error: %v", err)
+		http.Error(w, "could not complete login", http.StatusInternalServerError)
+		return
+	}
+	if user.DisabledAt != nil {
+		http.Error(w, ErrAccountDisabled.Error(), http.StatusForbidden)
+		return
+	}
+	if config.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		http.Error(w, "email address is not verified", http.StatusForbidden)
+		return
+	}
+
+	// IdP でのログインは二段階目の代わりにならない。有効なら POST /login/mfa で完了させる
+	mfa, err := h.Repo.GetMFAStatus(user.ID)
+	if err != nil {
+		log.Printf("GetMFAStatus error: %v", err)
+		http.Error(w, "could not complete login", http.StatusInternalServerError)
+		return
+	}
+	if mfa.Enabled {
+		token, err := h.Repo.CreateMFAChallenge(user.ID)
+		if err != nil {
+			log.Printf("CreateMFAChallenge error: %v", err)
+			http.Error(w, "could not complete login", http.StatusInternalServerError)
+			return
+		}
+		redirectWithFragment(w, r, url.Values{
+			"mfa_required": {"true"},
+			"mfa_token":    {token},
+			"expires_in":   {strconv.FormatInt(int64(MFAChallengeTTL.Seconds()), 10)},
+		})
+		return
+	}
+
+	pair, err := h.Repo.IssueTokens(user, ClientFrom(r))
+	if err != nil {
+		http.Error(w, "could not generate token", http.StatusInternalServerError)
+		return
+	}
+	auditLogin(h.Repo.DB, r, audit.ActionLogin, "oidc:"+p.Name, user, user.Email)
+	redirectWithFragment(w, r, url.Values{
+		"token":         {pair.Token},
+		"refresh_token": {pair.RefreshToken},
+		"token_type":    {pair.TokenType},
+		"expires_in":    {strconv.FormatInt(pair.ExpiresIn, 10)},
+	})
+}
+
+// redirectWithFragment はフロントエンドのコールバックへ戻す。トークンはサーバーのログに残らないようフラグメントで渡す
+func redirectWithFragment(w http.ResponseWriter, r *http.Request, fragment url.Values) {
+	http.Redirect(w, r, config.AppBaseURL+"/auth/callback#"+fragment.Encode(), http.StatusFound)
+}
+
+func (r *Repository) saveOIDCState(provider, state, nonce, verifier string) error {
+	now := time.Now()
+	if _, err := r.DB.Exec(`DELETE FROM oidc_states WHERE expires_at < ?`, now); err != nil {
+		return err
+	}
+	_, err := r.DB.Exec(`
+		INSERT INTO oidc_states (state, provider, nonce, code_verifier, expires_at)
+		VALUES (?, ?, ?, ?, ?)`, hashToken(state), provider, nonce, verifier, now.Add(oidcStateTTL))
+	return err
+}
+
+// consumeOIDCState は state を削除し、保存していた nonce と code_verifier を返す
+func (r *Repository) consumeOIDCState(provider, state string) (string, string, error) {
+	if state == "" {
+		return "", "", ErrOIDCStateInvalid
+	}
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	var nonce, verifier string
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+		SELECT nonce, code_verifier, expires_at FROM oidc_states
+		WHERE state = ? AND provider = ?`, hashToken(state), provider).Scan(&nonce, &verifier, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", ErrOIDCStateInvalid
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := tx.Exec(`DELETE FROM oidc_states WHERE state = ?`, hashToken(state)); err != nil {
+		return "", "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", "", err
+	}
+	if time.Now().After(expiresAt) {
+		return "", "", ErrOIDCStateInvalid
+	}
+	return nonce, verifier, nil
+}
+
+// ProvisionOIDCUser は IdP のユーザーに対応する users の行を返す。
+// 初回は確認済みのメールアドレスが一致するユーザーに紐付け、無ければパスワードなしのユーザーを作る
+func (r *Repository) ProvisionOIDCUser(provider string, id *OIDCIdentity) (*User, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var userID int64
+	err = tx.QueryRow(`SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?`, provider, id.Subject).Scan(&userID)
+	switch {
+	case err == nil:
+		if _, err := tx.Exec(`
+			UPDATE user_identities SET email = ?, last_login_at = ?
+			WHERE provider = ? AND subject = ?`, id.Email, now, provider, id.Subject); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		if userID, err = linkOrCreateUser(tx, id, now); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+			VALUES (?, ?, ?, ?, ?, ?)`, userID, provider, id.Subject, id.Email, now, now); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetUserByID(userID)
+}
+
+func linkOrCreateUser(tx *sql.Tx, id *OIDCIdentity, now time.Time) (int64, error) {
+	if id.Email == "" {
+		return 0, ErrOIDCEmailRequired
+	}
+	var userID int64
+	err := tx.QueryRow(`SELECT id FROM users WHERE lower(email) = ?`, id.Email).Scan(&userID)
+	if err == nil {
+		if !id.EmailVerified {
+			return 0, ErrOIDCEmailInUse
+		}
+		_, err := tx.Exec(`UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL`, now, userID)
+		return userID, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	// 他人のメールアドレスで登録されないよう、IdP が確認したアドレスでなければ作らない
+	if !id.EmailVerified {
+		return 0, ErrOIDCEmailUnverified
+	}
+
+	username := id.Name
+	if username == "" {
+		username, _, _ = strings.Cut(id.Email, "@")
+	}
+	// password_hash が空のユーザーはパスワードではログインできない
+	result, err := tx.Exec(`
+		INSERT INTO users (email, username, password_hash, email_verified_at)
+		VALUES (?, ?, '', ?)`, id.Email, username, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
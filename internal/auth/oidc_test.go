@@ -0,0 +1,333 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	mockClientID    = "faq-app"
+	mockSecret      = "s3cret"
+	mockRedirectURL = "http://app.test/auth/oidc/corp/callback"
+)
+
+// mockIdP は認可コードフローと PKCE を実装した最小限の IdP
+type mockIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu      sync.Mutex
+	pending map[string]url.Values // code → 認可リクエスト
+	// 次に発行する ID トークンのクレーム。tamper で上書きできる
+	claims jwt.MapClaims
+	tamper func(jwt.MapClaims)
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	idp := &mockIdP{key: key, pending: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	// ユーザーは常に同意したものとしてすぐにコールバックへ戻す
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != mockClientID || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+			http.Error(w, "invalid_request", http.StatusBadRequest)
+			return
+		}
+		code := "code-" + q.Get("state")[:8]
+		idp.mu.Lock()
+		idp.pending[code] = q
+		idp.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		r.ParseForm()
+		idp.mu.Lock()
+		req, ok := idp.pending[r.Form.Get("code")]
+		delete(idp.pending, r.Form.Get("code"))
+		idp.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		switch {
+		case user != mockClientID || pass != mockSecret:
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		case !ok || r.Form.Get("redirect_uri") != req.Get("redirect_uri"):
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		case base64.RawURLEncoding.EncodeToString(sum[:]) != req.Get("code_challenge"):
+			http.Error(w, `{"error":"invalid_grant","error_description":"PKCE verification failed"}`, http.StatusBadRequest)
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   idp.URL,
+			"aud":   mockClientID,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(5 * time.Minute).Unix(),
+			"nonce": req.Get("nonce"),
+		}
+		idp.mu.Lock()
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		if idp.tamper != nil {
+			idp.tamper(claims)
+		}
+		idp.mu.Unlock()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": signed})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *mockIdP) set(claims jwt.MapClaims, tamper func(jwt.MapClaims)) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.claims, idp.tamper = claims, tamper
+}
+
+func setupOIDC(t *testing.T, domains ...string) (*auth.OIDCHandler, *mockIdP) {
+	useTestKeys(t)
+	idp := newMockIdP(t)
+	h := auth.NewOIDCHandler(setupTestDB(t), []config.OIDCProvider{{
+		Name:           "corp",
+		Issuer:         idp.URL,
+		ClientID:       mockClientID,
+		ClientSecret:   mockSecret,
+		RedirectURL:    mockRedirectURL,
+		AllowedDomains: domains,
+	}})
+	return h, idp
+}
+
+func oidcRoutes(h *auth.OIDCHandler) http.Handler {
+	return routes(map[string]http.HandlerFunc{
+		"GET /auth/oidc":                     h.ListProviders,
+		"GET /auth/oidc/{provider}/login":    h.Login,
+		"GET /auth/oidc/{provider}/callback": h.Callback,
+	})
+}
+
+// startLogin は /login から IdP の認可までを進め、IdP が返すコールバックの URL を返す
+func startLogin(t *testing.T, h *auth.OIDCHandler) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	oidcRoutes(h).ServeHTTP(rr, httptest.NewRequest("GET", "/auth/oidc/corp/login", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("login: expected 302, got %d: %s", rr.Code, rr.Body)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: expected 302, got %d", resp.StatusCode)
+	}
+	return resp.Header.Get("Location")
+}
+
+func callback(h *auth.OIDCHandler, callbackURL string) *httptest.ResponseRecorder {
+	u, _ := url.Parse(callbackURL)
+	rr := httptest.NewRecorder()
+	oidcRoutes(h).ServeHTTP(rr, httptest.NewRequest("GET", u.RequestURI(), nil))
+	return rr
+}
+
+// loginAs は一連のフローを通してアクセストークンのユーザーIDを返す
+func loginAs(t *testing.T, h *auth.OIDCHandler) int64 {
+	t.Helper()
+	rr := callback(h, startLogin(t, h))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("callback: expected 302, got %d: %s", rr.Code, rr.Body)
+	}
+	_, fragment, _ := strings.Cut(rr.Header().Get("Location"), "#")
+	values, _ := url.ParseQuery(fragment)
+	if values.Get("refresh_token") == "" {
+		t.Fatalf("expected refresh token in %q", fragment)
+	}
+	userID, _, err := auth.ParseJWT(values.Get("token"))
+	if err != nil {
+		t.Fatalf("invalid access token: %v", err)
+	}
+	return userID
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	h, idp := setupOIDC(t)
+	idp.set(jwt.MapClaims{"sub": "emp-1", "email": "Taro@Corp.example", "email_verified": true, "name": "taro"}, nil)
+
+	first := loginAs(t, h)
+	second := loginAs(t, h)
+	if first != second {
+		t.Errorf("expected the same user on second login, got %d and %d", first, second)
+	}
+	user, err := h.Repo.GetUserByID(first)
+	if err != nil || user.Email != "taro@corp.example" || user.Username != "taro" || user.EmailVerifiedAt == nil {
+		t.Fatalf("unexpected provisioned user %+v (%v)", user, err)
+	}
+	// SSO ユーザーはパスワードではログインできない
+	if auth.CheckPasswordHash("", user.Password) {
+		t.Error("provisioned user should not have a usable password")
+	}
+}
+
+func TestOIDCLinksExistingAccount(t *testing.T) {
+	h, idp := setupOIDC(t)
+	h.Repo.CreateUser(&auth.User{Email: "hanako@corp.example", Username: "hanako", Password: "x"})
+
+	// 未確認のメールアドレスでは既存のアカウントに紐付けない
+	idp.set(jwt.MapClaims{"sub": "emp-2", "email": "hanako@corp.example", "email_verified": false}, nil)
+	if rr := callback(h, startLogin(t, h)); rr.Code != http.StatusConflict {
+		t.Fatalf("unverified email: expected 409, got %d", rr.Code)
+	}
+
+	idp.set(jwt.MapClaims{"sub": "emp-2", "email": "hanako@corp.example", "email_verified": true}, nil)
+	if userID := loginAs(t, h); userID != 1 {
+		t.Errorf("expected link to existing user 1, got %d", userID)
+	}
+}
+
+func TestOIDCRequiresVerifiedEmailForNewUsers(t *testing.T) {
+	h, idp := setupOIDC(t)
+
+	// 未確認のメールアドレスではユーザーを作らない
+	idp.set(jwt.MapClaims{"sub": "emp-4", "email": "saburo@corp.example", "email_verified": false}, nil)
+	if rr := callback(h, startLogin(t, h)); rr.Code != http.StatusForbidden {
+		t.Fatalf("unverified email: expected 403, got %d", rr.Code)
+	}
+	var users int
+	h.Repo.DB.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users)
+	if users != 0 {
+		t.Fatalf("expected no user to be created, got %d", users)
+	}
+
+	idp.set(jwt.MapClaims{"sub": "emp-4", "email": "saburo@corp.example", "email_verified": true}, nil)
+	if userID := loginAs(t, h); userID != 1 {
+		t.Errorf("expected user 1 once verified, got %d", userID)
+	}
+}
+
+func TestOIDCIssuerWithTrailingSlash(t *testing.T) {
+	useTestKeys(t)
+	idp := newMockIdP(t)
+	h := auth.NewOIDCHandler(setupTestDB(t), []config.OIDCProvider{{
+		Name:         "corp",
+		Issuer:       idp.URL + "/",
+		ClientID:     mockClientID,
+		ClientSecret: mockSecret,
+		RedirectURL:  mockRedirectURL,
+	}})
+	idp.set(jwt.MapClaims{"sub": "emp-5", "email": "shiro@corp.example", "email_verified": true}, nil)
+	if userID := loginAs(t, h); userID != 1 {
+		t.Errorf("expected user 1, got %d", userID)
+	}
+}
+
+func TestOIDCLoginRequiresMFA(t *testing.T) {
+	h, idp := setupOIDC(t)
+	h.Repo.CreateUser(&auth.User{Email: "hanako@corp.example", Username: "hanako", Password: "x"})
+	user, _ := h.Repo.GetUserByID(1)
+	secret, _, err := h.Repo.BeginMFAEnrollment(user)
+	if err != nil {
+		t.Fatalf("BeginMFAEnrollment failed: %v", err)
+	}
+	if _, err := h.Repo.VerifyMFAEnrollment(1, totp(secret, time.Now())); err != nil {
+		t.Fatalf("VerifyMFAEnrollment failed: %v", err)
+	}
+
+	// IdP でログインしても二段階目のトークンしか渡さない
+	idp.set(jwt.MapClaims{"sub": "emp-2", "email": "hanako@corp.example", "email_verified": true}, nil)
+	rr := callback(h, startLogin(t, h))
+	_, fragment, _ := strings.Cut(rr.Header().Get("Location"), "#")
+	values, _ := url.ParseQuery(fragment)
+	if rr.Code != http.StatusFound || values.Get("mfa_required") != "true" || values.Get("token") != "" || values.Get("refresh_token") != "" {
+		t.Fatalf("expected an MFA challenge without tokens, got %d %q", rr.Code, fragment)
+	}
+
+	rr = loginMFA(auth.NewAuthHandler(h.Repo.DB), values.Get("mfa_token"), totp(secret, time.Now().Add(30*time.Second)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("completing the challenge: expected 200, got %d", rr.Code)
+	}
+}
+
+func TestOIDCRejectsInvalidResponses(t *testing.T) {
+	h, idp := setupOIDC(t, "corp.example")
+	valid := jwt.MapClaims{"sub": "emp-3", "email": "jiro@corp.example", "email_verified": true}
+
+	cases := []struct {
+		name   string
+		claims jwt.MapClaims
+		tamper func(jwt.MapClaims)
+		want   int
+	}{
+		{"wrong audience", valid, func(c jwt.MapClaims) { c["aud"] = "other-app" }, http.StatusUnauthorized},
+		{"wrong issuer", valid, func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, http.StatusUnauthorized},
+		{"nonce mismatch", valid, func(c jwt.MapClaims) { c["nonce"] = "replayed" }, http.StatusUnauthorized},
+		{"expired", valid, func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, http.StatusUnauthorized},
+		{"domain not allowed", jwt.MapClaims{"sub": "x", "email": "x@gmail.example", "email_verified": true}, nil, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		idp.set(tc.claims, tc.tamper)
+		if rr := callback(h, startLogin(t, h)); rr.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, rr.Code)
+		}
+	}
+
+	// state は一度しか使えない
+	idp.set(valid, nil)
+	callbackURL := startLogin(t, h)
+	if rr := callback(h, callbackURL); rr.Code != http.StatusFound {
+		t.Fatalf("valid login: expected 302, got %d", rr.Code)
+	}
+	if rr := callback(h, callbackURL); rr.Code != http.StatusBadRequest {
+		t.Errorf("state reuse: expected 400, got %d", rr.Code)
+	}
+
+	// 別の認可リクエストのコードでは PKCE の検証に失敗する
+	first, _ := url.Parse(startLogin(t, h))
+	second, _ := url.Parse(startLogin(t, h))
+	swapped := second.Query()
+	swapped.Set("code", first.Query().Get("code"))
+	second.RawQuery = swapped.Encode()
+	if rr := callback(h, second.String()); rr.Code != http.StatusUnauthorized {
+		t.Errorf("mismatched PKCE: expected 401, got %d", rr.Code)
+	}
+}
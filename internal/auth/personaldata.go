@@ -0,0 +1,108 @@
+package auth
+
+import "time"
+
+// PersonalData はデータのエクスポートに含める認証まわりの記録
+type PersonalData struct {
+	Profile    Profile          `json:"profile"`
+	Identities []LinkedIdentity `json:"identities"`
+	APIKeys    []APIKey         `json:"api_keys"`
+	Sessions   []Session        `json:"sessions"`
+	MFA        MFAStatus        `json:"mfa"`
+}
+
+type Profile struct {
+	ID              int64      `json:"id"`
+	Email           string     `json:"email"`
+	Username        string     `json:"username"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// LinkedIdentity は OIDC のプロバイダーで紐付いているアカウント
+type LinkedIdentity struct {
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// GetPersonalData はユーザーの認証まわりの記録を集める。トークンやハッシュは含めない
+func (r *Repository) GetPersonalData(userID int64) (*PersonalData, error) {
+	data := &PersonalData{Identities: []LinkedIdentity{}}
+	p := &data.Profile
+	if err := r.DB.QueryRow(`
+		SELECT id, email, username, email_verified_at, created_at FROM users WHERE id = ?`, userID).
+		Scan(&p.ID, &p.Email, &p.Username, &p.EmailVerifiedAt, &p.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(`
+		SELECT provider, email, created_at, last_login_at FROM user_identities
+		WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id LinkedIdentity
+		if err := rows.Scan(&id.Provider, &id.Email, &id.CreatedAt, &id.LastLoginAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		data.Identities = append(data.Identities, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 失効や期限切れのものも含めて全てのセッションを返す
+	if data.Sessions, err = r.querySessions(`WHERE user_id = ? ORDER BY created_at`, userID); err != nil {
+		return nil, err
+	}
+	if data.APIKeys, err = r.ListAPIKeys(userID); err != nil {
+		return nil, err
+	}
+	mfa, err := r.GetMFAStatus(userID)
+	if err != nil {
+		return nil, err
+	}
+	data.MFA = *mfa
+	return data, nil
+}
+
+// DeleteUser はユーザーと認証まわりの記録を全て削除する。セッションが無くなるので発行済みのアクセストークンも使えなくなる
+func (r *Repository) DeleteUser(userID int64) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var email string
+	if err := tx.QueryRow(`SELECT email FROM users WHERE id = ?`, userID).Scan(&email); err != nil {
+		return err
+	}
+	if err := revokeUserSessions(tx, userID); err != nil {
+		return err
+	}
+
+	for _, stmt := range []string{
+		`DELETE FROM api_keys WHERE user_id = ?`,
+		`DELETE FROM refresh_tokens WHERE user_id = ?`,
+		`DELETE FROM sessions WHERE user_id = ?`,
+		`DELETE FROM user_tokens WHERE user_id = ?`,
+		`DELETE FROM user_identities WHERE user_id = ?`,
+		`DELETE FROM user_mfa WHERE user_id = ?`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = ?`,
+		`DELETE FROM users WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM login_failures WHERE key = ?`, AccountKey(email)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
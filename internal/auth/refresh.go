@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+	// ErrRefreshTokenReused は使用済みのトークンが再び使われたとき。漏洩とみなしてファミリーごと失効させる
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+)
+
+// TokenPair はログインとリフレッシュの応答。Token は従来どおりのアクセストークン
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// IssueTokens はログイン時に新しいセッションを作り、そのファミリーのトークンを発行する
+func (r *Repository) IssueTokens(user *User, client Client) (*TokenPair, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 期限切れのリフレッシュトークンとセッションはここで掃除する
+	now := time.Now()
+	for _, stmt := range []string{
+		`DELETE FROM refresh_tokens WHERE user_id = ? AND expires_at < ?`,
+		`DELETE FROM sessions WHERE user_id = ? AND expires_at < ?`,
+	} {
+		if _, err := tx.Exec(stmt, user.ID, now); err != nil {
+			return nil, err
+		}
+	}
+	sessionID := uuid.NewString()
+	if err := createSession(tx, sessionID, user.ID, client, 0, now.Add(RefreshTokenTTL)); err != nil {
+		return nil, err
+	}
+	pair, err := issueInFamily(tx, user.ID, user.Username, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return pair, tx.Commit()
+}
+
+// Refresh はリフレッシュトークンを使用済みにし、同じファミリーの新しいトークンを発行する。
+// セッションの最終利用日時と IP アドレスも更新する
+func (r *Repository) Refresh(plain string, client Client) (*TokenPair, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id, userID int64
+	var familyID, username string
+	var expiresAt time.Time
+	var usedAt, revokedAt *time.Time
+	err = tx.QueryRow(`
+		SELECT t.id, t.user_id, t.family_id, t.expires_at, t.used_at, t.revoked_at, u.username
+		FROM refresh_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ?`, hashToken(plain)).
+		Scan(&id, &userID, &familyID, &expiresAt, &usedAt, &revokedAt, &username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt != nil || time.Now().After(expiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if usedAt != nil {
+		if err := revokeSessions(tx, familyID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	result, err := tx.Exec(`UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+	now := time.Now()
+	result, err = tx.Exec(`
+		UPDATE sessions SET last_seen_at = ?, ip = ?, expires_at = ?
+		WHERE id = ? AND revoked_at IS NULL`, now, client.IP, now.Add(RefreshTokenTTL), familyID)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+	pair, err := issueInFamily(tx, userID, username, familyID)
+	if err != nil {
+		return nil, err
+	}
+	return pair, tx.Commit()
+}
+
+// Logout はアクセストークンとそのセッションを失効させる
+func (r *Repository) Logout(claims *AccessClaims) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if claims.TokenID != "" {
+		if err := revokeTokenID(tx, claims.TokenID, claims.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	if claims.SessionID != "" {
+		if err := revokeSessions(tx, claims.SessionID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ChangePassword はパスワードを更新し、ユーザーの全てのトークンを失効させる
+func (r *Repository) ChangePassword(userID int64, passwordHash string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := changePassword(tx, userID, passwordHash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func changePassword(tx *sql.Tx, userID int64, passwordHash string) error {
+	if _, err := tx.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, userID); err != nil {
+		return err
+	}
+	return revokeUserSessions(tx, userID)
+}
+
+// revokeUserSessions はユーザーの全てのセッション (代理ログインを含む) とそのリフレッシュトークンを失効させる
+func revokeUserSessions(tx *sql.Tx, userID int64) error {
+	now := time.Now()
+	for _, stmt := range []string{
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`,
+		`UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`,
+	} {
+		if _, err := tx.Exec(stmt, now, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsRevoked は jti が失効リストにあるかを返す
+func (r *Repository) IsRevoked(tokenID string) (bool, error) {
+	var exists int
+	err := r.DB.QueryRow(`SELECT 1 FROM revoked_tokens WHERE token_id = ? AND expires_at > ?`, tokenID, time.Now()).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func issueInFamily(tx *sql.Tx, userID int64, username, familyID string) (*TokenPair, error) {
+	access, _, err := generateAccessToken(userID, username, familyID)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if _, err := tx.Exec(`
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`, userID, familyID, hashToken(refresh), now, now.Add(RefreshTokenTTL)); err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		Token:        access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(AccessTokenTTL / time.Second),
+	}, nil
+}
+
+// revokeSessions はセッションとそのファミリーのリフレッシュトークンを失効させる。
+// 発行済みのアクセストークンは JWTAuthMiddleware がセッションを確認して拒否する
+func revokeSessions(tx *sql.Tx, ids ...string) error {
+	now := time.Now()
+	for _, id := range ids {
+		if _, err := tx.Exec(`UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`, now, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, now, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func revokeTokenID(tx *sql.Tx, id string, expiresAt time.Time) error {
+	if _, err := tx.Exec(`DELETE FROM revoked_tokens WHERE expires_at < ?`, time.Now()); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		INSERT INTO revoked_tokens (token_id, expires_at) VALUES (?, ?)
+		ON CONFLICT(token_id) DO UPDATE SET expires_at = MAX(expires_at, excluded.expires_at)`, id, expiresAt)
+	return err
+}
+
+// newOpaqueToken はリフレッシュトークンなどに使う推測できない文字列を返す
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,161 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"faq-search-ai/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func login(t *testing.T, h *auth.AuthHandler) auth.TokenPair {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"email": "a@example.com", "password": "pass1234word"})
+	rr := httptest.NewRecorder()
+	h.Login(rr, httptest.NewRequest("POST", "/login", bytes.NewBuffer(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login failed: %d", rr.Code)
+	}
+	var pair auth.TokenPair
+	json.NewDecoder(rr.Body).Decode(&pair)
+	if pair.Token == "" || pair.RefreshToken == "" {
+		t.Fatalf("expected token pair, got %+v", pair)
+	}
+	return pair
+}
+
+func refresh(h *auth.AuthHandler, token string) (*httptest.ResponseRecorder, auth.TokenPair) {
+	body, _ := json.Marshal(map[string]string{"refresh_token": token})
+	rr := httptest.NewRecorder()
+	h.Refresh(rr, httptest.NewRequest("POST", "/token/refresh", bytes.NewBuffer(body)))
+	var pair auth.TokenPair
+	if rr.Code == http.StatusOK {
+		json.NewDecoder(rr.Body).Decode(&pair)
+	}
+	return rr, pair
+}
+
+// authorized は access トークンで /me に到達できるかを返す
+func authorized(h *auth.AuthHandler, access string) bool {
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+	rr := httptest.NewRecorder()
+	auth.JWTAuthMiddleware(h.Repo)(http.HandlerFunc(h.Me)).ServeHTTP(rr, req)
+	return rr.Code == http.StatusOK
+}
+
+// useTestKeys はテストの間だけ HS256 の鍵でトークンを署名する
+func useTestKeys(t *testing.T) {
+	t.Helper()
+	m, err := auth.NewHMACKeyManager([]byte("test-secret"))
+	if err != nil {
+		t.Fatalf("failed to create key manager: %v", err)
+	}
+	auth.UseKeyManager(m)
+	t.Cleanup(func() { auth.UseKeyManager(nil) })
+}
+
+func setupTokenTest(t *testing.T) *auth.AuthHandler {
+	useTestKeys(t)
+	db := setupTestDB(t)
+
+	h := auth.NewAuthHandler(db)
+	h.Mailer = &captureMailer{}
+	body, _ := json.Marshal(map[string]string{"email": "a@example.com", "username": "testuser", "password": "pass1234word"})
+	rr := httptest.NewRecorder()
+	h.Signup(rr, httptest.NewRequest("POST", "/signup", bytes.NewBuffer(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("signup failed: %d", rr.Code)
+	}
+	return h
+}
+
+func TestRefreshRotationAndReuse(t *testing.T) {
+	h := setupTokenTest(t)
+	first := login(t, h)
+	other := login(t, h)
+
+	rr, second := refresh(h, first.RefreshToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d", rr.Code)
+	}
+	if second.RefreshToken == first.RefreshToken || !authorized(h, second.Token) {
+		t.Fatalf("expected a rotated, usable pair")
+	}
+
+	// 使用済みのトークンの再利用でファミリー全体が失効する
+	if rr, _ := refresh(h, first.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("reuse: expected 401, got %d", rr.Code)
+	}
+	if rr, _ := refresh(h, second.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("rotated token after reuse: expected 401, got %d", rr.Code)
+	}
+	if authorized(h, second.Token) || authorized(h, first.Token) {
+		t.Errorf("access tokens of the revoked family should be rejected")
+	}
+
+	// 別のログインは影響を受けない
+	if !authorized(h, other.Token) {
+		t.Errorf("other session should remain valid")
+	}
+	if rr, _ := refresh(h, other.RefreshToken); rr.Code != http.StatusOK {
+		t.Errorf("other session refresh: expected 200, got %d", rr.Code)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	h := setupTokenTest(t)
+	pair := login(t, h)
+
+	req := httptest.NewRequest("POST", "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.Token)
+	rr := httptest.NewRecorder()
+	auth.JWTAuthMiddleware(h.Repo)(http.HandlerFunc(h.Logout)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("logout: expected 204, got %d", rr.Code)
+	}
+	if authorized(h, pair.Token) {
+		t.Errorf("access token should be revoked after logout")
+	}
+	if rr, _ := refresh(h, pair.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: expected 401, got %d", rr.Code)
+	}
+}
+
+func TestChangePasswordRevokesTokens(t *testing.T) {
+	h := setupTokenTest(t)
+	a := login(t, h)
+	b := login(t, h)
+
+	change := func(current string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"current_password": current, "new_password": "newpass456"})
+		req := httptest.NewRequest("POST", "/me/password", bytes.NewBuffer(body))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		rr := httptest.NewRecorder()
+		h.ChangePassword(rr, req)
+		return rr
+	}
+	if rr := change("wrong"); rr.Code != http.StatusForbidden {
+		t.Fatalf("wrong current password: expected 403, got %d", rr.Code)
+	}
+	rr := change("pass1234word")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("change password: expected 200, got %d", rr.Code)
+	}
+	var fresh auth.TokenPair
+	json.NewDecoder(rr.Body).Decode(&fresh)
+
+	for _, old := range []auth.TokenPair{a, b} {
+		if authorized(h, old.Token) {
+			t.Errorf("old access token should be revoked")
+		}
+		if rr, _ := refresh(h, old.RefreshToken); rr.Code != http.StatusUnauthorized {
+			t.Errorf("old refresh token: expected 401, got %d", rr.Code)
+		}
+	}
+	if !authorized(h, fresh.Token) {
+		t.Errorf("token issued after the change should be valid")
+	}
+}
@@ -3,8 +3,13 @@ package auth
 import (
 	"database/sql"
 	"errors"
+
+	"github.com/mattn/go-sqlite3"
 )
 
+// ErrEmailTaken は users.email の UNIQUE 制約に違反したとき
+var ErrEmailTaken = errors.New("email address is already registered")
+
 type Repository struct {
 	DB *sql.DB
 }
@@ -14,20 +19,28 @@ func NewRepository(db *sql.DB) *Repository {
 }
 
 func (r *Repository) CreateUser(user *User) error {
-	_, err := r.DB.Exec(`
+	result, err := r.DB.Exec(`
 		INSERT INTO users (email, username, password_hash)
 		VALUES (?, ?, ?)`, user.Email, user.Username, user.Password)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	user.ID, err = result.LastInsertId()
 	return err
 }
 
+// GetUserByEmail は大文字小文字を区別せずに探す。正規化前に登録されたユーザーも見つけられるようにするため
 func (r *Repository) GetUserByEmail(email string) (*User, error) {
 	row := r.DB.QueryRow(
-		`SELECT id, email, username, password_hash
+		`SELECT id, email, username, password_hash, email_verified_at, role, disabled_at
 	    FROM users
-		WHERE email = ?`, email)
+		WHERE lower(email) = ?`, NormalizeEmail(email))
 
 	var user User
-	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password)
+	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.EmailVerifiedAt, &user.Role, &user.DisabledAt)
 	if err == sql.ErrNoRows {
 		return nil, errors.New("user not found")
 	}
@@ -36,12 +49,12 @@ func (r *Repository) GetUserByEmail(email string) (*User, error) {
 
 func (r *Repository) GetUserByID(userID int64) (*User, error) {
 	row := r.DB.QueryRow(`
-		SELECT id, email, username, password_hash
+		SELECT id, email, username, password_hash, email_verified_at, role, disabled_at
 		FROM users
 		WHERE id = ?`, userID)
 
 	var user User
-	if err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password); err != nil {
+	if err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.EmailVerifiedAt, &user.Role, &user.DisabledAt); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("user not found")
 		}
@@ -49,3 +62,15 @@ func (r *Repository) GetUserByID(userID int64) (*User, error) {
 	}
 	return &user, nil
 }
+
+// UpdatePasswordHash は同じパスワードのハッシュを作り直したものに置き換える。
+// パスワードの変更ではないのでトークンは失効させない。その間に変更されていれば何もしない
+func (r *Repository) UpdatePasswordHash(userID int64, oldHash, newHash string) error {
+	_, err := r.DB.Exec(`UPDATE users SET password_hash = ? WHERE id = ? AND password_hash = ?`, newHash, userID, oldHash)
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
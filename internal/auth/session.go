@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/middleware"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSessionNotFound はセッションが存在しないか、失効または期限切れのとき
+var ErrSessionNotFound = errors.New("session not found")
+
+// sessionTouchInterval より前に最終利用日時を更新していたら、リクエストのたびに更新し直す
+const sessionTouchInterval = time.Minute
+
+// Client はセッションに記録するログイン元
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// ClientFrom はリクエストの送信元を返す
+func ClientFrom(r *http.Request) Client {
+	return Client{IP: middleware.ClientIP(r), UserAgent: r.UserAgent()}
+}
+
+// Session はログインごとのセッション。IP は最後に使われたときの IP アドレス
+type Session struct {
+	ID             string     `json:"id"`
+	Device         string     `json:"device"`
+	IP             string     `json:"ip,omitempty"`
+	UserAgent      string     `json:"user_agent,omitempty"`
+	ImpersonatorID int64      `json:"impersonator_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastSeenAt     time.Time  `json:"last_seen_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	Current        bool       `json:"current,omitempty"`
+}
+
+func createSession(tx *sql.Tx, id string, userID int64, client Client, impersonatorID int64, expiresAt time.Time) error {
+	now := time.Now()
+	_, err := tx.Exec(`
+		INSERT INTO sessions (id, user_id, device, ip, user_agent, impersonator_id, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, userID, deviceName(client.UserAgent), client.IP, client.UserAgent, impersonatorID, now, now, expiresAt)
+	return err
+}
+
+// TouchSession はセッションが userID のもので有効かを確かめ、最終利用日時と IP アドレスを更新する。
+// 書き込みを減らすため、更新は sessionTouchInterval に1回にする
+func (r *Repository) TouchSession(id string, userID int64, ip string) error {
+	var owner int64
+	var lastSeenAt, expiresAt time.Time
+	var revokedAt *time.Time
+	err := r.DB.QueryRow(`SELECT user_id, last_seen_at, expires_at, revoked_at FROM sessions WHERE id = ?`, id).
+		Scan(&owner, &lastSeenAt, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if owner != userID || revokedAt != nil || now.After(expiresAt) {
+		return ErrSessionNotFound
+	}
+	if now.Sub(lastSeenAt) < sessionTouchInterval {
+		return nil
+	}
+	_, err = r.DB.Exec(`UPDATE sessions SET last_seen_at = ?, ip = ? WHERE id = ?`, now, ip, id)
+	return err
+}
+
+// ListSessions はユーザーの有効なセッションを最近使われた順に返す
+func (r *Repository) ListSessions(userID int64) ([]Session, error) {
+	return r.querySessions(`WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY last_seen_at DESC`, userID, time.Now())
+}
+
+func (r *Repository) querySessions(where string, args ...interface{}) ([]Session, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, device, ip, user_agent, impersonator_id, created_at, last_seen_at, expires_at, revoked_at
+		FROM sessions `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.Device, &s.IP, &s.UserAgent, &s.ImpersonatorID, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession はユーザーのセッションを1つ失効させる
+func (r *Repository) RevokeSession(userID int64, id string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(`SELECT 1 FROM sessions WHERE id = ? AND user_id = ? AND revoked_at IS NULL`, id, userID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := revokeSessions(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeOtherSessions は keep 以外のユーザーのセッションを全て失効させ、失効させた ID を返す
+func (r *Repository) RevokeOtherSessions(userID int64, keep string) ([]string, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM sessions WHERE user_id = ? AND id != ? AND revoked_at IS NULL`, userID, keep)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := revokeSessions(tx, ids...); err != nil {
+		return nil, err
+	}
+	return ids, tx.Commit()
+}
+
+// 上から順に User-Agent に含まれるかを調べる。Chrome 系のブラウザは Chrome と Safari の両方を名乗るので先に置く
+var (
+	uaBrowsers = [][2]string{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	uaPlatforms = [][2]string{
+		{"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Android", "Android"}, {"Windows", "Windows"},
+		{"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	}
+)
+
+// deviceName は User-Agent から "Chrome on macOS" のような表示名を作る
+func deviceName(userAgent string) string {
+	match := func(candidates [][2]string) string {
+		for _, c := range candidates {
+			if strings.Contains(userAgent, c[0]) {
+				return c[1]
+			}
+		}
+		return ""
+	}
+	browser, platform := match(uaBrowsers), match(uaPlatforms)
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+	return "Unknown device"
+}
+
+// ListSessions は GET /me/sessions で有効なセッションを一覧する。このリクエストのセッションは current が true
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(ClaimsContextKey).(*AccessClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sessions, err := h.Repo.ListSessions(claims.UserID)
+	if err != nil {
+		log.Printf("ListSessions error: %v", err)
+		http.Error(w, "Failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSession は DELETE /me/sessions/{id} でセッションを失効させ、監査ログに残す
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(ClaimsContextKey).(*AccessClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := r.PathValue("id")
+	err := h.Repo.RevokeSession(claims.UserID, id)
+	if errors.Is(err, ErrSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("RevokeSession error: %v", err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	h.auditSession(r, claims, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOtherSessions は DELETE /me/sessions でこのリクエスト以外のセッションを全て失効させる
+func (h *AuthHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(ClaimsContextKey).(*AccessClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ids, err := h.Repo.RevokeOtherSessions(claims.UserID, claims.SessionID)
+	if err != nil {
+		log.Printf("RevokeOtherSessions error: %v", err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	for _, id := range ids {
+		h.auditSession(r, claims, id)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"revoked": len(ids)})
+}
+
+func (h *AuthHandler) auditSession(r *http.Request, claims *AccessClaims, id string) {
+	details := map[string]string{}
+	if claims.ImpersonatorID != 0 {
+		details["impersonator_id"] = strconv.FormatInt(claims.ImpersonatorID, 10)
+	}
+	audit.Log(h.Repo.DB, r, audit.Event{
+		Action:     audit.ActionSessionRevoked,
+		ActorID:    claims.UserID,
+		TargetType: audit.TargetSession,
+		TargetID:   id,
+		Details:    details,
+	})
+}
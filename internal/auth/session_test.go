@@ -0,0 +1,134 @@
+package auth_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"faq-search-ai/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	macChrome    = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	iPhoneSafari = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+)
+
+func loginFrom(t *testing.T, h *auth.AuthHandler, userAgent string) auth.TokenPair {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"email": "a@example.com", "password": "pass1234word"})
+	req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	req.Header.Set("User-Agent", userAgent)
+	rr := httptest.NewRecorder()
+	h.Login(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login failed: %d", rr.Code)
+	}
+	var pair auth.TokenPair
+	json.NewDecoder(rr.Body).Decode(&pair)
+	return pair
+}
+
+func TestSessions(t *testing.T) {
+	h := setupTokenTest(t)
+	laptop := loginFrom(t, h, macChrome)
+	phone := loginFrom(t, h, iPhoneSafari)
+
+	call := func(token, method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		auth.JWTAuthMiddleware(h.Repo)(routes(map[string]http.HandlerFunc{
+			"GET /me/sessions":         h.ListSessions,
+			"DELETE /me/sessions":      h.RevokeOtherSessions,
+			"DELETE /me/sessions/{id}": h.RevokeSession,
+		})).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := call(laptop.Token, "GET", "/me/sessions")
+	var sessions []auth.Session
+	json.NewDecoder(rr.Body).Decode(&sessions)
+	if rr.Code != http.StatusOK || len(sessions) != 2 {
+		t.Fatalf("list: unexpected response %d %+v", rr.Code, sessions)
+	}
+	devices := map[string]auth.Session{}
+	for _, s := range sessions {
+		devices[s.Device] = s
+	}
+	mac, iphone := devices["Chrome on macOS"], devices["Safari on iOS"]
+	if !mac.Current || iphone.Current || iphone.ID == "" || mac.IP == "" || iphone.UserAgent != iPhoneSafari {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+	phoneClaims, _ := auth.ParseAccessToken(phone.Token)
+	if phoneClaims.SessionID != iphone.ID {
+		t.Errorf("expected sid %s, got %s", iphone.ID, phoneClaims.SessionID)
+	}
+
+	// 失効させたセッションのアクセストークンもリフレッシュトークンも使えない
+	if rr := call(laptop.Token, "DELETE", "/me/sessions/"+iphone.ID); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke: expected 204, got %d", rr.Code)
+	}
+	if authorized(h, phone.Token) {
+		t.Error("revoked session's access token still works")
+	}
+	if rr, _ := refresh(h, phone.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session's refresh: expected 401, got %d", rr.Code)
+	}
+	if rr := call(laptop.Token, "DELETE", "/me/sessions/"+iphone.ID); rr.Code != http.StatusNotFound {
+		t.Errorf("revoke twice: expected 404, got %d", rr.Code)
+	}
+
+	// リフレッシュしても同じセッションのまま
+	rr, refreshed := refresh(h, laptop.RefreshToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d", rr.Code)
+	}
+	if claims, _ := auth.ParseAccessToken(refreshed.Token); claims.SessionID != mac.ID {
+		t.Errorf("refresh changed the session: %s != %s", claims.SessionID, mac.ID)
+	}
+
+	// 他のセッションだけをまとめて失効させる
+	other := loginFrom(t, h, "curl/8.4.0")
+	rr = call(refreshed.Token, "DELETE", "/me/sessions")
+	var revoked map[string]int
+	json.NewDecoder(rr.Body).Decode(&revoked)
+	if rr.Code != http.StatusOK || revoked["revoked"] != 1 {
+		t.Fatalf("revoke others: unexpected response %d %v", rr.Code, revoked)
+	}
+	if authorized(h, other.Token) || !authorized(h, refreshed.Token) {
+		t.Error("only the other session should be revoked")
+	}
+
+	// セッションの無いトークンは受け付けない
+	m, _ := auth.NewHMACKeyManager([]byte("test-secret"))
+	token, _ := m.Sign(claims())
+	if authorized(h, token) {
+		t.Error("token without a session was accepted")
+	}
+}
+
+func TestImpersonationSessionIsVisible(t *testing.T) {
+	h := setupTokenTest(t)
+	if code, fields := signup(h, "b@example.com", "bob", "pass1234word"); code != http.StatusCreated {
+		t.Fatalf("signup failed: %d %v", code, fields)
+	}
+	h.Repo.SetUserRole(1, auth.RoleAdmin)
+	admin, _ := h.Repo.GetUserByID(1)
+	target, _ := h.Repo.GetUserByID(2)
+	imp, err := h.Repo.Impersonate(admin, target, auth.Client{IP: "10.0.0.1", UserAgent: macChrome})
+	if err != nil {
+		t.Fatalf("Impersonate failed: %v", err)
+	}
+
+	sessions, err := h.Repo.ListSessions(2)
+	if err != nil || len(sessions) != 1 || sessions[0].ImpersonatorID != 1 {
+		t.Fatalf("expected the impersonation session, got %+v (%v)", sessions, err)
+	}
+	if err := h.Repo.RevokeSession(2, sessions[0].ID); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	if authorized(h, imp.Token) {
+		t.Error("revoked impersonation token still works")
+	}
+}
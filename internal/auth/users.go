@@ -0,0 +1,455 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/audit"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrAccountDisabled = errors.New("account is disabled")
+	ErrInvalidRole     = errors.New("role must be user or admin")
+	// ErrSelfAdminAction は管理者が自分の役割や状態を変えようとしたとき。管理者が居なくならないようにする
+	ErrSelfAdminAction = errors.New("administrators cannot change their own account from the admin API")
+	// ErrCannotImpersonate は管理者や無効なアカウントに代理でログインしようとしたとき
+	ErrCannotImpersonate = errors.New("administrators and disabled accounts cannot be impersonated")
+)
+
+const (
+	DefaultUserPageSize = 50
+	MaxUserPageSize     = 200
+)
+
+// UserQuery は管理者向けのユーザー一覧の条件。Search はメールアドレスかユーザー名の部分一致
+type UserQuery struct {
+	Search string
+	Role   string
+	Status string // active, disabled
+	Limit  int
+	Offset int
+}
+
+// UserSummary は管理者向けのユーザーの情報
+type UserSummary struct {
+	User
+	CreatedAt  time.Time `json:"created_at"`
+	MFAEnabled bool      `json:"mfa_enabled"`
+	Usage      UserUsage `json:"usage"`
+}
+
+// UserUsage はユーザーごとの件数。Logins と FAQChanges は監査ログから数える
+type UserUsage struct {
+	FAQs       int `json:"faqs"`
+	APIKeys    int `json:"api_keys"`
+	Logins     int `json:"logins"`
+	FAQChanges int `json:"faq_changes"`
+}
+
+const userSummaryColumns = `
+	u.id, u.email, u.username, u.email_verified_at, u.role, u.disabled_at, u.created_at,
+	EXISTS (SELECT 1 FROM user_mfa m WHERE m.user_id = u.id AND m.enabled_at IS NOT NULL),
+	(SELECT COUNT(*) FROM faqs f WHERE f.user_id = u.id AND f.deleted_at IS NULL),
+	(SELECT COUNT(*) FROM api_keys k WHERE k.user_id = u.id AND k.revoked_at IS NULL),
+	(SELECT COUNT(*) FROM audit_log a WHERE a.actor_id = u.id AND a.action = 'auth.login'),
+	(SELECT COUNT(*) FROM audit_log a WHERE a.actor_id = u.id AND a.action LIKE 'faq.%')`
+
+func scanUserSummary(row interface{ Scan(...interface{}) error }) (*UserSummary, error) {
+	var s UserSummary
+	err := row.Scan(&s.ID, &s.Email, &s.Username, &s.EmailVerifiedAt, &s.Role, &s.DisabledAt, &s.CreatedAt,
+		&s.MFAEnabled, &s.Usage.FAQs, &s.Usage.APIKeys, &s.Usage.Logins, &s.Usage.FAQChanges)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListUsers は条件に合うユーザーを ID 順に返す。2つ目の値は条件に合う全件数
+func (r *Repository) ListUsers(q UserQuery) ([]UserSummary, int, error) {
+	conds := []string{"1 = 1"}
+	var args []interface{}
+	if s := strings.ToLower(strings.TrimSpace(q.Search)); s != "" {
+		conds = append(conds, "(instr(lower(u.email), ?) > 0 OR instr(lower(u.username), ?) > 0)")
+		args = append(args, s, s)
+	}
+	if q.Role != "" {
+		conds = append(conds, "u.role = ?")
+		args = append(args, q.Role)
+	}
+	switch q.Status {
+	case "active":
+		conds = append(conds, "u.disabled_at IS NULL")
+	case "disabled":
+		conds = append(conds, "u.disabled_at IS NOT NULL")
+	}
+	where := strings.Join(conds, " AND ")
+
+	var total int
+	if err := r.DB.QueryRow(`SELECT COUNT(*) FROM users u WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultUserPageSize
+	}
+	if q.Limit > MaxUserPageSize {
+		q.Limit = MaxUserPageSize
+	}
+	rows, err := r.DB.Query(`SELECT `+userSummaryColumns+` FROM users u WHERE `+where+` ORDER BY u.id LIMIT ? OFFSET ?`,
+		append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	users := []UserSummary{}
+	for rows.Next() {
+		s, err := scanUserSummary(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *s)
+	}
+	return users, total, rows.Err()
+}
+
+func (r *Repository) GetUserSummary(userID int64) (*UserSummary, error) {
+	s, err := scanUserSummary(r.DB.QueryRow(`SELECT `+userSummaryColumns+` FROM users u WHERE u.id = ?`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	return s, err
+}
+
+func (r *Repository) SetUserRole(userID int64, role string) error {
+	if role != RoleUser && role != RoleAdmin {
+		return ErrInvalidRole
+	}
+	return r.updateUser(`UPDATE users SET role = ? WHERE id = ?`, role, userID)
+}
+
+// SetUserDisabled はアカウントを無効または有効にする。無効にするときはログイン中のトークンを全て失効させる。
+// API キーは残すが、無効の間は認証に使えない
+func (r *Repository) SetUserDisabled(userID int64, disabled bool) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var disabledAt *time.Time
+	if disabled {
+		now := time.Now()
+		disabledAt = &now
+	}
+	result, err := tx.Exec(`UPDATE users SET disabled_at = ? WHERE id = ?`, disabledAt, userID)
+	if err := requireAffected(result, err); err != nil {
+		return err
+	}
+	if disabled {
+		if err := revokeUserSessions(tx, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ResetCredentials はパスワード、二段階認証、API キー、ログイン中のトークンを全て無効にする。
+// 乗っ取られたアカウントを取り戻すときに使い、本人にはパスワードの再設定から始めてもらう
+func (r *Repository) ResetCredentials(userID int64) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 空のハッシュとはどのパスワードも一致しない
+	result, err := tx.Exec(`UPDATE users SET password_hash = '' WHERE id = ?`, userID)
+	if err := requireAffected(result, err); err != nil {
+		return err
+	}
+	if err := revokeUserSessions(tx, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE api_keys SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, time.Now(), userID); err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		`DELETE FROM user_tokens WHERE user_id = ?`,
+		`DELETE FROM user_mfa WHERE user_id = ?`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PromoteAdmins は emails のユーザーを管理者にする。最初の管理者を用意するため起動時に使う
+func (r *Repository) PromoteAdmins(emails []string) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+	args := make([]interface{}, 0, len(emails)+1)
+	args = append(args, RoleAdmin)
+	for _, email := range emails {
+		args = append(args, NormalizeEmail(email))
+	}
+	result, err := r.DB.Exec(`UPDATE users SET role = ? WHERE role <> 'admin' AND lower(email) IN (?`+strings.Repeat(", ?", len(emails)-1)+`)`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ImpersonationToken は管理者が代理でログインするためのアクセストークン。リフレッシュはできない
+type ImpersonationToken struct {
+	Token     string `json:"token"`
+	TokenType string `json:"token_type"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// Impersonate は target として振る舞うアクセストークンを発行する。トークンには管理者の ID が入る。
+// トークンの有効期間だけのセッションを作るので、本人のセッション一覧にも表示され、本人が失効させられる
+func (r *Repository) Impersonate(admin, target *User, client Client) (*ImpersonationToken, error) {
+	if target.Role == RoleAdmin || target.DisabledAt != nil {
+		return nil, ErrCannotImpersonate
+	}
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sessionID := uuid.NewString()
+	if err := createSession(tx, sessionID, target.ID, client, admin.ID, time.Now().Add(AccessTokenTTL)); err != nil {
+		return nil, err
+	}
+	token, _, err := signAccessToken(target.ID, target.Username, sessionID, admin.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &ImpersonationToken{Token: token, TokenType: "Bearer", ExpiresIn: int64(AccessTokenTTL / time.Second)}, nil
+}
+
+func (r *Repository) updateUser(query string, args ...interface{}) error {
+	return requireAffected(r.DB.Exec(query, args...))
+}
+
+func requireAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// 管理者によるユーザーの管理。RequireAdmin の内側で使い、変更は監査ログに残す
+
+// targetUser はパスの {id} と操作する管理者の ID を返す。self が false なら自分自身への操作は 409 にする
+func targetUser(w http.ResponseWriter, r *http.Request, self bool) (adminID, userID int64, ok bool) {
+	adminID, ok = r.Context().Value(UserIDContextKey).(int64)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return 0, 0, false
+	}
+	if !self && userID == adminID {
+		http.Error(w, ErrSelfAdminAction.Error(), http.StatusConflict)
+		return 0, 0, false
+	}
+	return adminID, userID, true
+}
+
+// GetUser は GET /admin/users/{id} でユーザーの詳細と件数を返す
+func (h *AuthHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	_, userID, ok := targetUser(w, r, true)
+	if !ok {
+		return
+	}
+	summary, err := h.Repo.GetUserSummary(userID)
+	if errors.Is(err, ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("GetUserSummary error: %v", err)
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// UpdateUser は PATCH /admin/users/{id} {"role": "user"|"admin"} で役割を変更する
+func (h *AuthHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	adminID, userID, ok := targetUser(w, r, false)
+	if !ok {
+		return
+	}
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !h.writeUserError(w, "SetUserRole", h.Repo.SetUserRole(userID, req.Role)) {
+		return
+	}
+	h.auditUser(r, audit.ActionUserRoleChanged, adminID, userID, map[string]string{"role": req.Role})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisableUser は POST /admin/users/{id}/disable で無効にし、ログイン中のトークンを失効させる
+func (h *AuthHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, true)
+}
+
+// EnableUser は POST /admin/users/{id}/enable で有効に戻す
+func (h *AuthHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, false)
+}
+
+func (h *AuthHandler) setUserDisabled(w http.ResponseWriter, r *http.Request, disable bool) {
+	adminID, userID, ok := targetUser(w, r, false)
+	if !ok {
+		return
+	}
+	if !h.writeUserError(w, "SetUserDisabled", h.Repo.SetUserDisabled(userID, disable)) {
+		return
+	}
+	action := audit.ActionUserEnabled
+	if disable {
+		action = audit.ActionUserDisabled
+	}
+	h.auditUser(r, action, adminID, userID, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetUserCredentials は POST /admin/users/{id}/reset-credentials で認証情報を全て無効にし、
+// パスワードの再設定メールを送る
+func (h *AuthHandler) ResetUserCredentials(w http.ResponseWriter, r *http.Request) {
+	adminID, userID, ok := targetUser(w, r, false)
+	if !ok {
+		return
+	}
+	user, err := h.Repo.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if !h.writeUserError(w, "ResetCredentials", h.Repo.ResetCredentials(userID)) {
+		return
+	}
+	h.auditUser(r, audit.ActionUserCredentialsReset, adminID, userID, nil)
+	// 認証情報は既に無効なので、メールが送れなくても本人が再設定を依頼すればよい
+	if err := h.sendPasswordReset(user); err != nil {
+		log.Printf("sendPasswordReset error: %v", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ImpersonateUser は POST /admin/users/{id}/impersonate で代理でログインするためのアクセストークンを返す
+func (h *AuthHandler) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	adminID, userID, ok := targetUser(w, r, false)
+	if !ok {
+		return
+	}
+	admin, errAdmin := h.Repo.GetUserByID(adminID)
+	target, err := h.Repo.GetUserByID(userID)
+	if errAdmin != nil || err != nil {
+		http.Error(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	token, err := h.Repo.Impersonate(admin, target, ClientFrom(r))
+	if !h.writeUserError(w, "Impersonate", err) {
+		return
+	}
+	h.auditUser(r, audit.ActionUserImpersonated, adminID, userID, nil)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(token)
+}
+
+// ListUsers は GET /admin/users でユーザーを一覧する。q (メールアドレスかユーザー名), role, status=active|disabled, limit, offset
+func (h *AuthHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	q := UserQuery{Search: values.Get("q"), Role: values.Get("role"), Status: values.Get("status")}
+	if q.Role != "" && q.Role != RoleUser && q.Role != RoleAdmin {
+		http.Error(w, ErrInvalidRole.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Status != "" && q.Status != "active" && q.Status != "disabled" {
+		http.Error(w, "status must be active or disabled", http.StatusBadRequest)
+		return
+	}
+	for name, dst := range map[string]*int{"limit": &q.Limit, "offset": &q.Offset} {
+		if v := values.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, name+" must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			*dst = n
+		}
+	}
+
+	users, total, err := h.Repo.ListUsers(q)
+	if err != nil {
+		log.Printf("ListUsers error: %v", err)
+		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// writeUserError は err に応じた応答を書き、続けてよければ true を返す
+func (h *AuthHandler) writeUserError(w http.ResponseWriter, op string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidRole):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrCannotImpersonate):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("%s error: %v", op, err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+	}
+	return false
+}
+
+func (h *AuthHandler) auditUser(r *http.Request, action string, adminID, userID int64, details map[string]string) {
+	audit.Log(h.Repo.DB, r, audit.Event{
+		Action:     action,
+		ActorID:    adminID,
+		TargetType: audit.TargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Details:    details,
+	})
+}
@@ -0,0 +1,154 @@
+package auth_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminUserManagement(t *testing.T) {
+	h := setupTokenTest(t)
+	if code, fields := signup(h, "b@example.com", "bob", "pass1234word"); code != http.StatusCreated {
+		t.Fatalf("signup failed: %d %v", code, fields)
+	}
+	if n, err := h.Repo.PromoteAdmins([]string{"A@example.com"}); err != nil || n != 1 {
+		t.Fatalf("PromoteAdmins: n=%d err=%v", n, err)
+	}
+	admin := login(t, h)
+
+	adminAPI := auth.JWTAuthMiddleware(h.Repo)(h.RequireAdmin(routes(map[string]http.HandlerFunc{
+		"GET /admin/users":                         h.ListUsers,
+		"GET /admin/users/{id}":                    h.GetUser,
+		"PATCH /admin/users/{id}":                  h.UpdateUser,
+		"POST /admin/users/{id}/disable":           h.DisableUser,
+		"POST /admin/users/{id}/enable":            h.EnableUser,
+		"POST /admin/users/{id}/reset-credentials": h.ResetUserCredentials,
+		"POST /admin/users/{id}/impersonate":       h.ImpersonateUser,
+	})))
+	call := func(token, method, path string, body interface{}) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(b))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		adminAPI.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := call(admin.Token, "GET", "/admin/users?q=BOB", nil)
+	var users []auth.UserSummary
+	json.NewDecoder(rr.Body).Decode(&users)
+	if rr.Code != http.StatusOK || len(users) != 1 || users[0].Email != "b@example.com" || rr.Header().Get("X-Total-Count") != "1" {
+		t.Fatalf("search: unexpected response %d %+v", rr.Code, users)
+	}
+	rr = call(admin.Token, "GET", "/admin/users/1", nil)
+	var me auth.UserSummary
+	json.NewDecoder(rr.Body).Decode(&me)
+	if me.Role != auth.RoleAdmin || me.Usage.Logins != 1 {
+		t.Errorf("expected admin with 1 login, got %+v", me)
+	}
+
+	// 自分自身は変更できない
+	if rr := call(admin.Token, "POST", "/admin/users/1/disable", nil); rr.Code != http.StatusConflict {
+		t.Errorf("self disable: expected 409, got %d", rr.Code)
+	}
+
+	var bob auth.TokenPair
+	rr = attempt(h, "b@example.com", "pass1234word", "10.0.0.5")
+	json.NewDecoder(rr.Body).Decode(&bob)
+	if rr := call(bob.Token, "GET", "/admin/users", nil); rr.Code != http.StatusForbidden {
+		t.Errorf("non-admin: expected 403, got %d", rr.Code)
+	}
+
+	// 無効にするとログイン中のトークンも使えなくなる
+	if rr := call(admin.Token, "POST", "/admin/users/2/disable", nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("disable: expected 204, got %d", rr.Code)
+	}
+	if authorized(h, bob.Token) {
+		t.Error("disabled user's access token still works")
+	}
+	if rr, _ := refresh(h, bob.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("disabled user's refresh: expected 401, got %d", rr.Code)
+	}
+	if rr := attempt(h, "b@example.com", "pass1234word", "10.0.0.5"); rr.Code != http.StatusForbidden {
+		t.Errorf("disabled login: expected 403, got %d", rr.Code)
+	}
+	if rr := call(admin.Token, "GET", "/admin/users?status=disabled", nil); !strings.Contains(rr.Body.String(), "b@example.com") {
+		t.Errorf("expected bob in disabled users: %s", rr.Body)
+	}
+	if rr := call(admin.Token, "POST", "/admin/users/2/enable", nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("enable: expected 204, got %d", rr.Code)
+	}
+	if rr := attempt(h, "b@example.com", "pass1234word", "10.0.0.5"); rr.Code != http.StatusOK {
+		t.Errorf("enabled login: expected 200, got %d", rr.Code)
+	}
+
+	// 代理ログインのトークンは本人として使えるが、認証情報の変更や管理者の操作はできない
+	rr = call(admin.Token, "POST", "/admin/users/2/impersonate", nil)
+	var imp auth.ImpersonationToken
+	json.NewDecoder(rr.Body).Decode(&imp)
+	if rr.Code != http.StatusOK || imp.Token == "" {
+		t.Fatalf("impersonate: expected token, got %d", rr.Code)
+	}
+	claims, err := auth.ParseAccessToken(imp.Token)
+	if err != nil || claims.UserID != 2 || claims.ImpersonatorID != 1 {
+		t.Fatalf("unexpected impersonation claims %+v (%v)", claims, err)
+	}
+	if !authorized(h, imp.Token) {
+		t.Error("impersonation token rejected")
+	}
+	req := httptest.NewRequest("POST", "/me/password", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer "+imp.Token)
+	rr = httptest.NewRecorder()
+	auth.JWTAuthMiddleware(h.Repo)(auth.RejectImpersonation(http.HandlerFunc(h.ChangePassword))).ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("password change while impersonating: expected 403, got %d", rr.Code)
+	}
+
+	if rr := call(admin.Token, "PATCH", "/admin/users/2", map[string]string{"role": "owner"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid role: expected 400, got %d", rr.Code)
+	}
+	if rr := call(admin.Token, "PATCH", "/admin/users/2", map[string]string{"role": auth.RoleAdmin}); rr.Code != http.StatusNoContent {
+		t.Fatalf("promote: expected 204, got %d", rr.Code)
+	}
+	if rr := call(admin.Token, "POST", "/admin/users/2/impersonate", nil); rr.Code != http.StatusConflict {
+		t.Errorf("impersonate admin: expected 409, got %d", rr.Code)
+	}
+	call(admin.Token, "PATCH", "/admin/users/2", map[string]string{"role": auth.RoleUser})
+
+	// 認証情報のリセット後はパスワードの再設定からやり直す
+	mailer := h.Mailer.(*captureMailer)
+	sent := len(mailer.sent)
+	if rr := call(admin.Token, "POST", "/admin/users/2/reset-credentials", nil); rr.Code != http.StatusAccepted {
+		t.Fatalf("reset: expected 202, got %d", rr.Code)
+	}
+	if rr := attempt(h, "b@example.com", "pass1234word", "10.0.0.5"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("login after reset: expected 401, got %d", rr.Code)
+	}
+	if len(mailer.sent) != sent+1 || mailer.sent[sent].To != "b@example.com" {
+		t.Fatalf("expected a password reset mail to bob")
+	}
+	if rr := post(h.ResetPassword, "/password/reset", map[string]string{"token": mailer.tokenFrom(t), "new_password": "brand-new-secret"}); rr.Code != http.StatusNoContent {
+		t.Errorf("password reset: expected 204, got %d", rr.Code)
+	}
+
+	if rr := call(admin.Token, "GET", "/admin/users/99", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("missing user: expected 404, got %d", rr.Code)
+	}
+
+	var actions []string
+	audit.Each(h.Repo.DB, audit.Filter{TargetType: audit.TargetUser, ActorID: 1}, func(e audit.Event) error {
+		if strings.HasPrefix(e.Action, "user.") {
+			actions = append(actions, e.Action)
+		}
+		return nil
+	})
+	want := "user.disable,user.enable,user.impersonate,user.role,user.role,user.reset_credentials"
+	if strings.Join(actions, ",") != want {
+		t.Errorf("expected audited actions %s, got %v", want, actions)
+	}
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// user_tokens の用途
+const (
+	purposeVerifyEmail   = "verify_email"
+	purposeResetPassword = "reset_password"
+)
+
+// メール確認とパスワード再設定のリンクの有効期間
+var (
+	EmailVerificationTTL = 24 * time.Hour
+	PasswordResetTTL     = time.Hour
+)
+
+var ErrInvalidUserToken = errors.New("token is invalid, expired or already used")
+
+// CreateEmailVerification はメール確認用のトークンを発行する
+func (r *Repository) CreateEmailVerification(userID int64) (string, error) {
+	return r.createUserToken(userID, purposeVerifyEmail, EmailVerificationTTL)
+}
+
+// VerifyEmail はトークンを使用済みにし、メールアドレスを確認済みにする
+func (r *Repository) VerifyEmail(plain string) (int64, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, purposeVerifyEmail, plain)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL`, time.Now(), userID); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// CreatePasswordReset はパスワード再設定用のトークンを発行する
+func (r *Repository) CreatePasswordReset(userID int64) (string, error) {
+	return r.createUserToken(userID, purposeResetPassword, PasswordResetTTL)
+}
+
+// ResetPassword はトークンを使用済みにしてパスワードを更新し、ユーザーの全てのトークンを失効させる。
+// 再設定のメールを受け取れたのでメールアドレスも確認済みにする
+func (r *Repository) ResetPassword(plain, passwordHash string) (int64, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, purposeResetPassword, plain)
+	if err != nil {
+		return 0, err
+	}
+	if err := changePassword(tx, userID, passwordHash); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL`, time.Now(), userID); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// createUserToken は新しいトークンを発行し、同じ用途の未使用のトークンを無効にする
+func (r *Repository) createUserToken(userID int64, purpose string, ttl time.Duration) (string, error) {
+	plain, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.Exec(`
+		UPDATE user_tokens SET used_at = ?
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL`, now, userID, purpose); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO user_tokens (user_id, purpose, token_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`, userID, purpose, hashToken(plain), now, now.Add(ttl)); err != nil {
+		return "", err
+	}
+	return plain, tx.Commit()
+}
+
+// consumeUserToken は有効なトークンを使用済みにしてユーザーIDを返す
+func consumeUserToken(tx *sql.Tx, purpose, plain string) (int64, error) {
+	var id, userID int64
+	var expiresAt time.Time
+	err := tx.QueryRow(`
+		SELECT id, user_id, expires_at FROM user_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL`, hashToken(plain), purpose).
+		Scan(&id, &userID, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidUserToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	if time.Now().After(expiresAt) {
+		return 0, ErrInvalidUserToken
+	}
+	result, err := tx.Exec(`UPDATE user_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return 0, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return 0, ErrInvalidUserToken
+	}
+	return userID, nil
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// パスワードの長さの制限。上限はハッシュの計算で負荷をかけられないようにするため
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 128
+	maxUsernameLength = 50
+	maxEmailLength    = 254
+)
+
+//go:embed breached_passwords.txt
+var breachedPasswordList string
+
+// breachedPasswords は漏洩した一覧に含まれるパスワード (小文字)
+var breachedPasswords = func() map[string]struct{} {
+	set := map[string]struct{}{}
+	scanner := bufio.NewScanner(strings.NewReader(breachedPasswordList))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			set[line] = struct{}{}
+		}
+	}
+	return set
+}()
+
+// ValidationError はフィールドごとのエラーメッセージ
+type ValidationError map[string]string
+
+func (e ValidationError) Error() string {
+	fields := make([]string, 0, len(e))
+	for field, msg := range e {
+		fields = append(fields, field+": "+msg)
+	}
+	sort.Strings(fields)
+	return "validation failed: " + strings.Join(fields, ", ")
+}
+
+// writeValidationError は {"error": ..., "fields": {...}} を返す
+func writeValidationError(w http.ResponseWriter, status int, fields ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "validation failed",
+		"fields": fields,
+	})
+}
+
+// NormalizeEmail は前後の空白を除いて小文字にする。登録とログインの照合はこの形で行う
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateEmail は正規化済みのメールアドレスを検証する。表示名付きの形式は受け付けない
+func validateEmail(email string) string {
+	if email == "" {
+		return "is required"
+	}
+	if len(email) > maxEmailLength {
+		return "is too long"
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "is not a valid email address"
+	}
+	return ""
+}
+
+// ValidatePassword はパスワードの方針に合わないときに理由を返す。
+// メールアドレスやユーザー名と同じものも推測されやすいので拒否する
+func ValidatePassword(password, email, username string) string {
+	n := utf8.RuneCountInString(password)
+	switch {
+	case n == 0:
+		return "is required"
+	case n < MinPasswordLength:
+		return fmt.Sprintf("must be at least %d characters", MinPasswordLength)
+	case n > MaxPasswordLength:
+		return fmt.Sprintf("must be at most %d characters", MaxPasswordLength)
+	}
+	lower := strings.ToLower(password)
+	if _, ok := breachedPasswords[lower]; ok {
+		return "is too common and has appeared in data breaches"
+	}
+	local, _, _ := strings.Cut(email, "@")
+	for _, personal := range []string{email, local, strings.ToLower(username)} {
+		if personal != "" && lower == personal {
+			return "must not match your email address or username"
+		}
+	}
+	return ""
+}
+
+// validateSignup は入力を正規化し、問題のあるフィールドを返す
+func validateSignup(req *signupRequest) ValidationError {
+	errs := ValidationError{}
+	req.Email = NormalizeEmail(req.Email)
+	req.Username = strings.TrimSpace(req.Username)
+
+	if msg := validateEmail(req.Email); msg != "" {
+		errs["email"] = msg
+	}
+	switch {
+	case req.Username == "":
+		errs["username"] = "is required"
+	case utf8.RuneCountInString(req.Username) > maxUsernameLength:
+		errs["username"] = fmt.Sprintf("must be at most %d characters", maxUsernameLength)
+	}
+	if msg := ValidatePassword(req.Password, req.Email, req.Username); msg != "" {
+		errs["password"] = msg
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
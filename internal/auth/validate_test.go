@@ -0,0 +1,130 @@
+package auth_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func signup(h *auth.AuthHandler, email, username, password string) (int, map[string]string) {
+	rr := post(h.Signup, "/signup", map[string]string{"email": email, "username": username, "password": password})
+	var resp struct {
+		Fields map[string]string `json:"fields"`
+	}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	return rr.Code, resp.Fields
+}
+
+func TestSignupValidation(t *testing.T) {
+	h := setupTokenTest(t)
+
+	cases := []struct {
+		name, email, username, password string
+		fields                          []string
+	}{
+		{"empty", "", "", "", []string{"email", "username", "password"}},
+		{"malformed email", "not-an-email", "bob", "pass1234word", []string{"email"}},
+		{"display name", "Bob <bob@example.com>", "bob", "pass1234word", []string{"email"}},
+		{"no domain dot", "bob@localhost", "bob", "pass1234word", []string{"email"}},
+		{"short password", "bob@example.com", "bob", "abc123", []string{"password"}},
+		{"breached password", "bob@example.com", "bob", "Password123", []string{"password"}},
+		{"password is username", "bob@example.com", "bobsmith99", "BobSmith99", []string{"password"}},
+	}
+	for _, tc := range cases {
+		code, fields := signup(h, tc.email, tc.username, tc.password)
+		if code != http.StatusBadRequest || len(fields) != len(tc.fields) {
+			t.Errorf("%s: expected 400 with %v, got %d %v", tc.name, tc.fields, code, fields)
+			continue
+		}
+		for _, f := range tc.fields {
+			if fields[f] == "" {
+				t.Errorf("%s: expected an error for %s, got %v", tc.name, f, fields)
+			}
+		}
+	}
+}
+
+func TestSignupNormalizesEmailAndRejectsDuplicates(t *testing.T) {
+	h := setupTokenTest(t)
+
+	if code, fields := signup(h, "  Bob@Example.COM ", " bob ", "pass1234word"); code != http.StatusCreated {
+		t.Fatalf("signup: expected 201, got %d %v", code, fields)
+	}
+	user, err := h.Repo.GetUserByEmail("bob@example.com")
+	if err != nil || user.Email != "bob@example.com" || user.Username != "bob" {
+		t.Fatalf("expected normalized user, got %+v (%v)", user, err)
+	}
+
+	code, fields := signup(h, "BOB@example.com", "bob2", "another-pass-99")
+	if code != http.StatusConflict || fields["email"] == "" {
+		t.Errorf("duplicate: expected 409 with an email error, got %d %v", code, fields)
+	}
+
+	// ログインでも大文字小文字を区別しない
+	if rr := attempt(h, "Bob@example.com", "pass1234word", "10.0.0.1"); rr.Code != http.StatusOK {
+		t.Errorf("login with different case: expected 200, got %d", rr.Code)
+	}
+}
+
+func TestMigrateNormalizesLegacyEmails(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	// 正規化を入れる前の、大文字小文字を区別する UNIQUE だけの状態
+	if _, err := db.Exec(`CREATE TABLE users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		email TEXT NOT NULL UNIQUE,
+		username TEXT NOT NULL,
+		password_hash TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`INSERT INTO users (email, username, password_hash) VALUES ('Foo@Example.com', 'foo', 'x'), ('foo@example.com', 'foo2', 'x'), ('Bar@Example.com', 'bar', 'x')`)
+
+	// どちらを残すかは決められないので、アドレスを変えずに起動を止める
+	err = config.Migrate(db)
+	if err == nil || !strings.Contains(err.Error(), "foo@example.com (user ids 1, 2)") {
+		t.Fatalf("expected the conflicting users to be reported, got %v", err)
+	}
+	var email string
+	if db.QueryRow(`SELECT email FROM users WHERE id = 2`).Scan(&email); email != "foo@example.com" {
+		t.Errorf("conflicting email was changed to %q", email)
+	}
+
+	db.Exec(`UPDATE users SET email = 'foo2@example.com' WHERE id = 2`)
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	repo := auth.NewRepository(db)
+	user, err := repo.GetUserByEmail("BAR@example.com")
+	if err != nil || user.ID != 3 || user.Email != "bar@example.com" {
+		t.Fatalf("expected a normalized email, got %+v (%v)", user, err)
+	}
+	if err := repo.CreateUser(&auth.User{Email: "fOO@example.com", Username: "foo3", Password: "x"}); !errors.Is(err, auth.ErrEmailTaken) {
+		t.Errorf("expected ErrEmailTaken regardless of case, got %v", err)
+	}
+}
+
+func TestPasswordPolicyOnReset(t *testing.T) {
+	h := setupTokenTest(t)
+	mailer := h.Mailer.(*captureMailer)
+	forgot(h, "a@example.com")
+	token := mailer.tokenFrom(t)
+
+	if rr := post(h.ResetPassword, "/password/reset", map[string]string{"token": token, "new_password": "qwerty123"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("breached password: expected 400, got %d", rr.Code)
+	}
+	// 方針に合わないパスワードではトークンを消費しない
+	if rr := post(h.ResetPassword, "/password/reset", map[string]string{"token": token, "new_password": "a-much-better-one"}); rr.Code != http.StatusNoContent {
+		t.Errorf("valid password: expected 204, got %d", rr.Code)
+	}
+}
@@ -2,7 +2,11 @@ package config
 
 import (
 	"log"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,8 +15,85 @@ var (
 	JWTSecret string
 	Port      string
 	QdrantURL string
+
+	// JWTSigningKey is the path of a PEM RSA or Ed25519 private key used to sign
+	// tokens. When empty, tokens are signed with JWTSecret using HS256.
+	JWTSigningKey string
+	// JWTVerificationKeys are PEM keys of retired signing keys that are still
+	// accepted while tokens they signed remain valid.
+	JWTVerificationKeys []string
+
+	// EmbeddingModel is the model used to embed FAQs and questions.
+	EmbeddingModel string
+	// EmbeddingDimension overrides the vector size for models we don't know about.
+	EmbeddingDimension int
+	// EmbeddingMigrate allows startup to build a new collection when the
+	// configured model differs from the one currently serving.
+	EmbeddingMigrate bool
+
+	// RequireReview forces FAQs through in-review and approval by someone other
+	// than the submitter before they are published.
+	RequireReview bool
+
+	// TrashRetention is how long deleted FAQs stay restorable before being purged.
+	TrashRetention time.Duration
+
+	// AccessTokenTTL is the lifetime of JWT access tokens.
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is how long a refresh token can be exchanged for a new pair.
+	RefreshTokenTTL time.Duration
+
+	// PasswordHashMemory (KiB), PasswordHashIterations and PasswordHashParallelism
+	// are the argon2id parameters for new password hashes. Zero keeps the default.
+	PasswordHashMemory      uint32
+	PasswordHashIterations  uint32
+	PasswordHashParallelism uint8
+
+	// AppBaseURL is the frontend origin used for links in emails.
+	AppBaseURL string
+	// RequireEmailVerification refuses logins until the address is verified.
+	RequireEmailVerification bool
+
+	// SMTPAddr is the host:port of the SMTP server. When empty, emails are
+	// written to MailDir (or the log) instead of being sent.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	MailDir      string
+
+	// OIDCProviders are the identity providers users can sign in with.
+	OIDCProviders []OIDCProvider
+
+	// AccountDeletionGrace is how long a requested account deletion can be
+	// cancelled before the user and their FAQs are removed.
+	AccountDeletionGrace time.Duration
+
+	// AdminEmails are promoted to the admin role at startup so that the first
+	// administrator can be set up. Further roles are managed via /admin/users.
+	AdminEmails []string
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For. Only enable
+	// it behind a reverse proxy.
+	TrustProxyHeaders bool
+	// TrustedProxies are the proxies in front of the server besides the one
+	// connecting to it. X-Forwarded-For entries added by them are skipped when
+	// looking for the client IP.
+	TrustedProxies []*net.IPNet
 )
 
+// OIDCProvider is configured with OIDC_PROVIDERS=corp,... and, for each name,
+// OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL and optionally
+// _SCOPES (space separated) and _ALLOWED_DOMAINS (comma separated).
+type OIDCProvider struct {
+	Name           string
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string
+	Scopes         []string
+	AllowedDomains []string
+}
+
 func LoadEnv() {
 	err := godotenv.Load()
 	if err != nil {
@@ -23,7 +104,146 @@ func LoadEnv() {
 	Port = os.Getenv("PORT")
 	QdrantURL = os.Getenv("QDRANT_URL")
 
-	if JWTSecret == "" || Port == "" {
+	JWTSigningKey = os.Getenv("JWT_SIGNING_KEY")
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFICATION_KEYS"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			JWTVerificationKeys = append(JWTVerificationKeys, path)
+		}
+	}
+
+	EmbeddingModel = os.Getenv("EMBEDDING_MODEL")
+	if EmbeddingModel == "" {
+		EmbeddingModel = "text-embedding-ada-002"
+	}
+	if v := os.Getenv("EMBEDDING_DIMENSION"); v != "" {
+		EmbeddingDimension, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid EMBEDDING_DIMENSION: %v", err)
+		}
+	}
+	EmbeddingMigrate = os.Getenv("EMBEDDING_MIGRATE") == "true"
+
+	RequireReview = os.Getenv("FAQ_REQUIRE_REVIEW") == "true"
+
+	TrashRetention = 30 * 24 * time.Hour
+	if v := os.Getenv("TRASH_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Fatalf("Invalid TRASH_RETENTION_DAYS: %q", v)
+		}
+		TrashRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	AccessTokenTTL = 15 * time.Minute
+	if v := os.Getenv("ACCESS_TOKEN_TTL_MINUTES"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes <= 0 {
+			log.Fatalf("Invalid ACCESS_TOKEN_TTL_MINUTES: %q", v)
+		}
+		AccessTokenTTL = time.Duration(minutes) * time.Minute
+	}
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	if v := os.Getenv("REFRESH_TOKEN_TTL_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 {
+			log.Fatalf("Invalid REFRESH_TOKEN_TTL_DAYS: %q", v)
+		}
+		RefreshTokenTTL = time.Duration(days) * 24 * time.Hour
+	}
+
+	PasswordHashMemory = uint32(parseUint("PASSWORD_HASH_MEMORY_KIB", 32))
+	PasswordHashIterations = uint32(parseUint("PASSWORD_HASH_ITERATIONS", 32))
+	PasswordHashParallelism = uint8(parseUint("PASSWORD_HASH_PARALLELISM", 8))
+
+	AppBaseURL = strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if AppBaseURL == "" {
+		AppBaseURL = "http://localhost:3000"
+	}
+	RequireEmailVerification = os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+
+	SMTPAddr = os.Getenv("SMTP_ADDR")
+	SMTPUsername = os.Getenv("SMTP_USERNAME")
+	SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	MailFrom = os.Getenv("MAIL_FROM")
+	if MailFrom == "" {
+		MailFrom = "no-reply@localhost"
+	}
+	MailDir = os.Getenv("MAIL_DIR")
+
+	AccountDeletionGrace = 14 * 24 * time.Hour
+	if v := os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Fatalf("Invalid ACCOUNT_DELETION_GRACE_DAYS: %q", v)
+		}
+		AccountDeletionGrace = time.Duration(days) * 24 * time.Hour
+	}
+
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			AdminEmails = append(AdminEmails, email)
+		}
+	}
+	TrustProxyHeaders = os.Getenv("TRUST_PROXY_HEADERS") == "true"
+	for _, v := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES entry: %q", v)
+		}
+		TrustedProxies = append(TrustedProxies, network)
+	}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			OIDCProviders = append(OIDCProviders, loadOIDCProvider(name))
+		}
+	}
+
+	if (JWTSecret == "" && JWTSigningKey == "") || Port == "" {
 		log.Fatal("Missing required environment variables")
 	}
 }
+
+// parseUint reads a positive integer from the environment, or 0 when unset.
+func parseUint(name string, bits int) uint64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.ParseUint(v, 10, bits)
+	if err != nil || n == 0 {
+		log.Fatalf("Invalid %s: %q", name, v)
+	}
+	return n
+}
+
+func loadOIDCProvider(name string) OIDCProvider {
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	p := OIDCProvider{
+		Name:         strings.ToLower(name),
+		Issuer:       strings.TrimRight(os.Getenv(prefix+"ISSUER"), "/"),
+		ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+		ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+		RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+	}
+	for _, domain := range strings.Split(os.Getenv(prefix+"ALLOWED_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			p.AllowedDomains = append(p.AllowedDomains, domain)
+		}
+	}
+	if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+		log.Fatalf("OIDC provider %q needs %sISSUER, %sCLIENT_ID and %sREDIRECT_URL", name, prefix, prefix, prefix)
+	}
+	return p
+}
@@ -2,8 +2,11 @@ package config
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -13,6 +16,339 @@ var (
 	once sync.Once
 )
 
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		email TEXT NOT NULL UNIQUE,
+		username TEXT NOT NULL,
+		password_hash TEXT NOT NULL,
+		email_verified_at DATETIME,
+		role TEXT NOT NULL DEFAULT 'user',
+		disabled_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+
+	// FAQを共有する単位。ユーザーごとに個人用のワークスペースが1つある
+	`CREATE TABLE IF NOT EXISTS workspaces (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		personal INTEGER NOT NULL DEFAULT 0,
+		created_by INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (created_by) REFERENCES users(id)
+	);`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_workspaces_personal ON workspaces(created_by) WHERE personal = 1;`,
+
+	`CREATE TABLE IF NOT EXISTS workspace_members (
+		workspace_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (workspace_id, user_id),
+		FOREIGN KEY (workspace_id) REFERENCES workspaces(id),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_workspace_members_user ON workspace_members(user_id);`,
+
+	// 招待。トークンはハッシュだけを保存する
+	`CREATE TABLE IF NOT EXISTS workspace_invitations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		workspace_id INTEGER NOT NULL,
+		email TEXT NOT NULL,
+		role TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		invited_by INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		accepted_by INTEGER,
+		accepted_at DATETIME,
+		FOREIGN KEY (workspace_id) REFERENCES workspaces(id)
+	);`,
+
+	// 機械クライアント用の API キー。キー自体は保存せずハッシュのみ持つ
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		revoked_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);`,
+
+	// ローテーションするリフレッシュトークン。同じログインから続くものは family_id が同じ
+	`CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		family_id TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		revoked_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);`,
+	`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id);`,
+
+	// 期限前に失効させたアクセストークン。token_id は jti
+	`CREATE TABLE IF NOT EXISTS revoked_tokens (
+		token_id TEXT PRIMARY KEY,
+		expires_at DATETIME NOT NULL
+	);`,
+
+	// ログインごとのセッション。id はリフレッシュトークンの family_id と同じで、アクセストークンの sid に入る。
+	// impersonator_id は管理者の代理ログインのときの管理者のユーザー ID
+	`CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		device TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		impersonator_id INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		last_seen_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);`,
+	// セッションの導入前からのログインは、有効なリフレッシュトークンのファミリーからセッションを作って引き継ぐ
+	`INSERT OR IGNORE INTO sessions (id, user_id, created_at, last_seen_at, expires_at)
+		SELECT family_id, user_id, MIN(created_at), MAX(created_at), MAX(expires_at)
+		FROM refresh_tokens WHERE revoked_at IS NULL GROUP BY family_id;`,
+
+	// メール確認、パスワード再設定、二段階認証のログインに使う一度きりのトークン
+	`CREATE TABLE IF NOT EXISTS user_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		purpose TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_user_tokens_user ON user_tokens(user_id, purpose);`,
+
+	// OIDC でログインしたユーザーと users の対応。provider と subject で一意
+	`CREATE TABLE IF NOT EXISTS user_identities (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_login_at DATETIME,
+		UNIQUE (provider, subject),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);`,
+
+	// 認可リクエストごとの state。コールバックで一度だけ使う
+	`CREATE TABLE IF NOT EXISTS oidc_states (
+		state TEXT PRIMARY KEY,
+		provider TEXT NOT NULL,
+		nonce TEXT NOT NULL,
+		code_verifier TEXT NOT NULL,
+		expires_at DATETIME NOT NULL
+	);`,
+
+	// ログイン失敗の記録。key は "account:<email>" か "ip:<address>"
+	`CREATE TABLE IF NOT EXISTS login_failures (
+		key TEXT PRIMARY KEY,
+		failures INTEGER NOT NULL,
+		last_failure_at DATETIME NOT NULL,
+		locked_until DATETIME
+	);`,
+
+	// TOTP の二段階認証。enabled_at が NULL の間は登録途中で、ログインには使わない。
+	// last_used_step は同じコードの再利用を防ぐため最後に受け付けた時間枠
+	`CREATE TABLE IF NOT EXISTS user_mfa (
+		user_id INTEGER PRIMARY KEY,
+		secret TEXT NOT NULL,
+		enabled_at DATETIME,
+		last_used_step INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`,
+	// 認証アプリを失くしたときのリカバリーコード。ハッシュだけを保存する
+	`CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL UNIQUE,
+		used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);`,
+
+	// 退会の予約。scheduled_at を過ぎるとユーザーとFAQを削除する。それまでは取り消せる
+	`CREATE TABLE IF NOT EXISTS account_deletions (
+		user_id INTEGER PRIMARY KEY,
+		requested_at DATETIME NOT NULL,
+		scheduled_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`,
+
+	// 監査ログ。追記のみで、更新と削除はトリガーで拒否する。ユーザーを削除しても actor_id は残す
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		action TEXT NOT NULL,
+		actor_id INTEGER NOT NULL DEFAULT 0,
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		target_type TEXT NOT NULL DEFAULT '',
+		target_id TEXT NOT NULL DEFAULT '',
+		workspace_id INTEGER NOT NULL DEFAULT 0,
+		details TEXT NOT NULL DEFAULT '{}'
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action, id);`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_id, id);`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id, id);`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;`,
+
+	// FAQをまとめるナレッジベース。/faqs/ask はこの単位で検索できる。user_id は作成者
+	`CREATE TABLE IF NOT EXISTS knowledge_bases (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		workspace_id INTEGER NOT NULL DEFAULT 0,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`,
+	// workspace_id が0の行は起動時の割り当て待ち
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_knowledge_bases_workspace_name ON knowledge_bases(workspace_id, name) WHERE workspace_id <> 0;`,
+
+	`CREATE TABLE IF NOT EXISTS faqs (
+		id TEXT PRIMARY KEY,
+		workspace_id INTEGER NOT NULL DEFAULT 0,
+		user_id INTEGER NOT NULL,
+		knowledge_base_id INTEGER NOT NULL DEFAULT 0,
+		question TEXT NOT NULL,
+		answer TEXT NOT NULL,
+		category TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'published',
+		version INTEGER NOT NULL DEFAULT 1,
+		submitted_by INTEGER,
+		reviewed_by INTEGER,
+		reviewed_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		deleted_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`,
+
+	// 一覧はワークスペース単位で絞り込んでから並び替える
+	`DROP INDEX IF EXISTS idx_faqs_user_created;`,
+	`DROP INDEX IF EXISTS idx_faqs_user_updated;`,
+	`DROP INDEX IF EXISTS idx_faqs_user_question;`,
+	`DROP INDEX IF EXISTS idx_faqs_user_category;`,
+	`CREATE INDEX IF NOT EXISTS idx_faqs_workspace_created ON faqs(workspace_id, created_at, id);`,
+	`CREATE INDEX IF NOT EXISTS idx_faqs_workspace_updated ON faqs(workspace_id, updated_at, id);`,
+	`CREATE INDEX IF NOT EXISTS idx_faqs_workspace_question ON faqs(workspace_id, question, id);`,
+	`CREATE INDEX IF NOT EXISTS idx_faqs_workspace_category ON faqs(workspace_id, category);`,
+	`CREATE INDEX IF NOT EXISTS idx_faqs_knowledge_base ON faqs(knowledge_base_id);`,
+
+	`CREATE TABLE IF NOT EXISTS faq_tags (
+		faq_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (faq_id, tag),
+		FOREIGN KEY (faq_id) REFERENCES faqs(id)
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_faq_tags_tag ON faq_tags(tag);`,
+
+	// 公開中のFAQに対する編集中の内容。承認されるまで公開版には反映しない
+	`CREATE TABLE IF NOT EXISTS faq_drafts (
+		faq_id TEXT PRIMARY KEY,
+		author_id INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		question TEXT NOT NULL,
+		answer TEXT NOT NULL,
+		category TEXT NOT NULL DEFAULT '',
+		tags TEXT NOT NULL DEFAULT '[]',
+		submitted_by INTEGER,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (faq_id) REFERENCES faqs(id)
+	);`,
+
+	// 質問・回答の全文検索用インデックス。faqs の rowid は VACUUM で振り直されることがあるので、FAQのIDを持たせる
+	`CREATE VIRTUAL TABLE IF NOT EXISTS faqs_fts USING fts4(faq_id, question, answer, notindexed=faq_id, tokenize=unicode61);`,
+
+	// 作り直しが必要な索引の作成方式のバージョン
+	`CREATE TABLE IF NOT EXISTS index_versions (
+		name TEXT PRIMARY KEY,
+		version INTEGER NOT NULL
+	);`,
+
+	// FAQの変更履歴。各行は変更後の内容のスナップショット
+	`CREATE TABLE IF NOT EXISTS faq_revisions (
+		faq_id TEXT NOT NULL,
+		revision INTEGER NOT NULL,
+		author_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		question TEXT NOT NULL,
+		answer TEXT NOT NULL,
+		category TEXT NOT NULL DEFAULT '',
+		tags TEXT NOT NULL DEFAULT '[]',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (faq_id, revision),
+		FOREIGN KEY (faq_id) REFERENCES faqs(id)
+	);`,
+
+	// Qdrant コレクションと埋め込みモデルの対応表
+	`CREATE TABLE IF NOT EXISTS vector_collections (
+		name TEXT PRIMARY KEY,
+		model TEXT NOT NULL,
+		dimension INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		activated_at DATETIME
+	);`,
+}
+
+// 既存DBに後から追加したカラム
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"faqs", "category", "TEXT NOT NULL DEFAULT ''"},
+	{"faqs", "deleted_at", "DATETIME"},
+	// 既存のFAQは公開済みとして扱う
+	{"faqs", "status", "TEXT NOT NULL DEFAULT 'published'"},
+	{"faqs", "submitted_by", "INTEGER"},
+	{"faqs", "reviewed_by", "INTEGER"},
+	{"faqs", "reviewed_at", "DATETIME"},
+	{"faqs", "version", "INTEGER NOT NULL DEFAULT 1"},
+	// 0 はナレッジベース導入前のFAQ。起動時に既定のナレッジベースへ割り当てる
+	{"faqs", "knowledge_base_id", "INTEGER NOT NULL DEFAULT 0"},
+	// 0 はワークスペース導入前の行。起動時に作成者の個人用ワークスペースへ割り当てる
+	{"faqs", "workspace_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"knowledge_bases", "workspace_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"users", "email_verified_at", "DATETIME"},
+	{"users", "role", "TEXT NOT NULL DEFAULT 'user'"},
+	{"users", "disabled_at", "DATETIME"},
+}
+
+// 中身を作り直せるテーブル。カラムが足りなければ削除し、schema で作り直す
+var rebuiltTables = []struct {
+	table, column string
+}{
+	{"faqs_fts", "faq_id"},
+}
+
 func InitDB() (*sql.DB, error) {
 	var err error
 	once.Do(func() {
@@ -30,32 +366,164 @@ func InitDB() (*sql.DB, error) {
 			return
 		}
 
-		createUsersTable := `
-		CREATE TABLE IF NOT EXISTS users (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			email TEXT NOT NULL UNIQUE,
-			username TEXT NOT NULL,
-			password_hash TEXT NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`
-
-		createFaqTable := `
-		CREATE TABLE IF NOT EXISTS faqs (
-			id TEXT PRIMARY KEY,
-			user_id INTEGER NOT NULL,
-			question TEXT NOT NULL,
-			answer TEXT NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (user_id) REFERENCES users(id)
-		);`
-
-		if _, err = DB.Exec(createUsersTable); err != nil {
-			return
-		}
-		if _, err = DB.Exec(createFaqTable); err != nil {
-			return
-		}
+		err = Migrate(DB)
 	})
 	return DB, err
 }
+
+// Migrate creates missing tables and adds columns introduced after a database was created.
+func Migrate(db *sql.DB) error {
+	for _, t := range rebuiltTables {
+		exists, found, err := hasColumn(db, t.table, t.column)
+		if err != nil {
+			return err
+		}
+		if exists && !found {
+			if _, err := db.Exec("DROP TABLE " + t.table); err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range addedColumns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if err := normalizeUserEmails(db); err != nil {
+		return err
+	}
+	return normalizeFAQTimestamps(db)
+}
+
+// normalizeFAQTimestamps はローカル時刻や CURRENT_TIMESTAMP の書式で保存された FAQ の日時を
+// ドライバーが書き出す UTC の書式にそろえる。一覧のカーソルは列の値をそのまま比較するため、
+// 書式が混ざっていると文字列としての並びが時刻順にならない
+func normalizeFAQTimestamps(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, created_at, updated_at FROM faqs WHERE created_at NOT LIKE '%+00:00' OR updated_at NOT LIKE '%+00:00'`)
+	if err != nil {
+		return err
+	}
+	type stamps struct {
+		id                   string
+		createdAt, updatedAt interface{}
+	}
+	var pending []stamps
+	for rows.Next() {
+		var s stamps
+		if err := rows.Scan(&s.id, &s.createdAt, &s.updatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, s := range pending {
+		// 日時として読めない値は触らない
+		for column, value := range map[string]interface{}{"created_at": s.createdAt, "updated_at": s.updatedAt} {
+			if t, ok := value.(time.Time); ok {
+				if _, err := tx.Exec(`UPDATE faqs SET `+column+` = ? WHERE id = ?`, t.UTC(), s.id); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// normalizeUserEmails は正規化前に登録されたメールアドレスを小文字にそろえ、
+// 大文字小文字を区別しない UNIQUE インデックスを作る。
+// 大文字小文字だけが違う重複があれば、どのアカウントを残すかは自動で決めずに起動を止めて該当する行を知らせる
+func normalizeUserEmails(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT lower(email), group_concat(id, ', ') FROM users
+		GROUP BY lower(email) HAVING COUNT(*) > 1 ORDER BY lower(email)`)
+	if err != nil {
+		return err
+	}
+	var conflicts []string
+	for rows.Next() {
+		var email, ids string
+		if err := rows.Scan(&email, &ids); err != nil {
+			rows.Close()
+			return err
+		}
+		conflicts = append(conflicts, fmt.Sprintf("%s (user ids %s)", email, ids))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("users differ only by email case; change or merge them before starting: %s", strings.Join(conflicts, "; "))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE users SET email = lower(email) WHERE email <> lower(email)`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users(lower(email))`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	tableExists, found, err := hasColumn(db, table, column)
+	if err != nil {
+		return err
+	}
+	// テーブル自体が未作成なら CREATE TABLE 側で作られる
+	if !tableExists || found {
+		return nil
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// hasColumn はテーブルが存在するかと、column を持つかを返す
+func hasColumn(db *sql.DB, table, column string) (bool, bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, false, err
+	}
+	defer rows.Close()
+
+	found := false
+	tableExists := false
+	for rows.Next() {
+		tableExists = true
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, false, err
+		}
+		if name == column {
+			found = true
+		}
+	}
+	return tableExists, found, rows.Err()
+}
@@ -0,0 +1,126 @@
+package faq
+
+import (
+	"database/sql"
+	"faq-search-ai/internal/model"
+	"faq-search-ai/internal/vector"
+	"fmt"
+	"strings"
+)
+
+// GetFAQsByAuthor はユーザーが作成したFAQを、ゴミ箱内のものも含めて作成順に返す
+func GetFAQsByAuthor(db *sql.DB, userID int64) ([]model.FAQ, error) {
+	rows, err := db.Query(`
+		SELECT id, workspace_id, user_id, knowledge_base_id, question, answer, category, status, version, created_at, updated_at, deleted_at
+		FROM faqs WHERE user_id = ? ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	faqs := []model.FAQ{}
+	for rows.Next() {
+		var f model.FAQ
+		if err := rows.Scan(&f.ID, &f.WorkspaceID, &f.UserID, &f.KnowledgeBaseID, &f.Question, &f.Answer, &f.Category, &f.Status, &f.Version, &f.CreatedAt, &f.UpdatedAt, &f.DeletedAt); err != nil {
+			return nil, err
+		}
+		faqs = append(faqs, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := loadTags(db, faqs); err != nil {
+		return nil, err
+	}
+	return faqs, nil
+}
+
+// GetRevisionsByAuthor はユーザーが行った変更の履歴を古い順に返す
+func GetRevisionsByAuthor(db *sql.DB, userID int64) ([]model.FAQRevision, error) {
+	rows, err := db.Query(`
+		SELECT faq_id, revision, author_id, action, question, answer, category, tags, created_at
+		FROM faq_revisions WHERE author_id = ? ORDER BY created_at, faq_id, revision`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []model.FAQRevision{}
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *rev)
+	}
+	return revisions, rows.Err()
+}
+
+// PurgeUserFAQs は退会するユーザーのFAQを完全に削除し、件数を返す。
+// 削除するのは一緒に削除するワークスペース (workspaceIDs) の全てのFAQとナレッジベースと、割り当て前のユーザーのFAQだけ。
+// 他のメンバーがいるワークスペースのFAQとナレッジベースはチームのものなので残し、作成者をそのワークスペースのオーナーに付け替える。
+// 他人のFAQへの編集中の内容は削除する。Qdrant から先に削除するので、途中で失敗してもやり直せる
+func PurgeUserFAQs(db *sql.DB, userID int64, workspaceIDs []int64) (int, error) {
+	where, args := "(workspace_id = 0 AND user_id = ?)", []interface{}{userID}
+	if len(workspaceIDs) > 0 {
+		where += " OR workspace_id IN (" + strings.TrimSuffix(strings.Repeat("?,", len(workspaceIDs)), ",") + ")"
+		for _, id := range workspaceIDs {
+			args = append(args, id)
+		}
+	}
+
+	rows, err := db.Query(`SELECT id FROM faqs WHERE `+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := vector.DeletePointsFromQdrant(ids); err != nil {
+		return 0, fmt.Errorf("failed to delete from Qdrant: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	for _, id := range ids {
+		if _, err := purgeFAQ(tx, id, ""); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM faq_drafts WHERE author_id = ?`, userID); err != nil {
+		return 0, err
+	}
+	for _, id := range workspaceIDs {
+		if _, err := tx.Exec(`DELETE FROM knowledge_bases WHERE workspace_id = ?`, id); err != nil {
+			return 0, err
+		}
+	}
+	// オーナーが見つからなければ作成者を空 (0) にする
+	for _, table := range []string{"faqs", "knowledge_bases"} {
+		if _, err := tx.Exec(`
+			UPDATE `+table+` SET user_id = COALESCE((
+				SELECT m.user_id FROM workspace_members m
+				WHERE m.workspace_id = `+table+`.workspace_id AND m.user_id <> ? AND m.role = ?
+				ORDER BY m.created_at, m.user_id LIMIT 1), 0)
+			WHERE user_id = ?`, userID, model.RoleOwner, userID); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
@@ -0,0 +1,42 @@
+package faq
+
+import (
+	"database/sql"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/workspace"
+	"net/http"
+	"strconv"
+)
+
+// auditFAQ はFAQの変更を監査ログに残す
+func auditFAQ(db *sql.DB, r *http.Request, scope workspace.Scope, action, id string, details map[string]string) {
+	auditWorkspace(db, r, scope, action, audit.TargetFAQ, id, details)
+}
+
+// auditKnowledgeBase はナレッジベースの変更を監査ログに残す
+func auditKnowledgeBase(db *sql.DB, r *http.Request, scope workspace.Scope, action string, id int64, details map[string]string) {
+	auditWorkspace(db, r, scope, action, audit.TargetKnowledgeBase, strconv.FormatInt(id, 10), details)
+}
+
+// auditWorkspace はワークスペース内の変更を監査ログに残す。API キーで操作したときはキーの ID を、
+// 管理者が代理でログインしているときは管理者の ID も残す
+func auditWorkspace(db *sql.DB, r *http.Request, scope workspace.Scope, action, targetType, id string, details map[string]string) {
+	if details == nil {
+		details = map[string]string{}
+	}
+	if key, ok := r.Context().Value(auth.APIKeyContextKey).(*auth.APIKey); ok {
+		details["api_key_id"] = strconv.FormatInt(key.ID, 10)
+	}
+	if claims, ok := r.Context().Value(auth.ClaimsContextKey).(*auth.AccessClaims); ok && claims.ImpersonatorID != 0 {
+		details["impersonator_id"] = strconv.FormatInt(claims.ImpersonatorID, 10)
+	}
+	audit.Log(db, r, audit.Event{
+		Action:      action,
+		ActorID:     scope.UserID,
+		TargetType:  targetType,
+		TargetID:    id,
+		WorkspaceID: scope.WorkspaceID,
+		Details:     details,
+	})
+}
@@ -0,0 +1,121 @@
+package faq
+
+import (
+	"faq-search-ai/internal/model"
+	"strings"
+)
+
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffOp は行単位の差分の1要素
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type ValueChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type TagsChange struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// RevisionDiff は2つのリビジョン間の差分
+type RevisionDiff struct {
+	From     int          `json:"from"`
+	To       int          `json:"to"`
+	Question []DiffOp     `json:"question"`
+	Answer   []DiffOp     `json:"answer"`
+	Category *ValueChange `json:"category,omitempty"`
+	Tags     TagsChange   `json:"tags"`
+}
+
+func DiffRevisions(from, to *model.FAQRevision) RevisionDiff {
+	d := RevisionDiff{
+		From:     from.Revision,
+		To:       to.Revision,
+		Question: diffLines(from.Question, to.Question),
+		Answer:   diffLines(from.Answer, to.Answer),
+		Tags:     diffTags(from.Tags, to.Tags),
+	}
+	if from.Category != to.Category {
+		d.Category = &ValueChange{From: from.Category, To: to.Category}
+	}
+	return d
+}
+
+// diffLines は最長共通部分列で行単位の差分を求める
+func diffLines(a, b string) []DiffOp {
+	x := strings.Split(a, "\n")
+	y := strings.Split(b, "\n")
+
+	// lcs[i][j] は x[i:] と y[j:] の最長共通部分列の長さ
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := []DiffOp{}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			ops = append(ops, DiffOp{Op: DiffEqual, Text: x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, DiffOp{Op: DiffDelete, Text: x[i]})
+			i++
+		default:
+			ops = append(ops, DiffOp{Op: DiffInsert, Text: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		ops = append(ops, DiffOp{Op: DiffDelete, Text: x[i]})
+	}
+	for ; j < len(y); j++ {
+		ops = append(ops, DiffOp{Op: DiffInsert, Text: y[j]})
+	}
+	return ops
+}
+
+func diffTags(from, to []string) TagsChange {
+	inFrom := make(map[string]bool, len(from))
+	for _, t := range from {
+		inFrom[t] = true
+	}
+	inTo := make(map[string]bool, len(to))
+	for _, t := range to {
+		inTo[t] = true
+	}
+
+	c := TagsChange{Added: []string{}, Removed: []string{}}
+	for _, t := range to {
+		if !inFrom[t] {
+			c.Added = append(c.Added, t)
+		}
+	}
+	for _, t := range from {
+		if !inTo[t] {
+			c.Removed = append(c.Removed, t)
+		}
+	}
+	return c
+}
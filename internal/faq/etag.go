@@ -0,0 +1,38 @@
+package faq
+
+import (
+	"faq-search-ai/internal/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETag はFAQのバージョンから強いエンティティタグを作る
+func ETag(f *model.FAQ) string {
+	return `"` + strconv.FormatInt(f.Version, 10) + `"`
+}
+
+// etagMatches は If-Match / If-None-Match の値に f のタグが含まれるかを返す。
+// バージョンは内容と1対1なので弱いタグ (W/) も同じものとして比較する
+func etagMatches(header string, f *model.FAQ) bool {
+	want := ETag(f)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == want {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch は If-Match があれば現在のバージョンと比較し、
+// 一致しなければ 412 を返して false を返す
+func checkIfMatch(w http.ResponseWriter, r *http.Request, current *model.FAQ) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || etagMatches(ifMatch, current) {
+		return true
+	}
+	w.Header().Set("ETag", ETag(current))
+	http.Error(w, "FAQ was modified; fetch it again and retry", http.StatusPreconditionFailed)
+	return false
+}
@@ -0,0 +1,113 @@
+package faq_test
+
+import (
+	"context"
+	"encoding/json"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/faq"
+	"faq-search-ai/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleUpdateFAQ_PatchWithETag(t *testing.T) {
+	db := setupTestDB(t)
+
+	f := model.FAQ{ID: "faq-1", UserID: 1, Question: "Q1", Answer: "A1", Category: "billing", Tags: []string{"plan"}}
+	if err := faq.CreateFAQ(db, &f); err != nil {
+		t.Fatalf("failed to create faq: %v", err)
+	}
+	// updated_at が進むことを確かめるため作成日時を過去にずらす
+	db.Exec(`UPDATE faqs SET updated_at = ? WHERE id = 'faq-1'`, time.Now().Add(-time.Hour))
+
+	do := func(method, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/faqs/faq-1", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		routes(db).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("GET", "", nil)
+	etag := rr.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("expected ETag \"1\", got %q", etag)
+	}
+	if rr := do("GET", "", map[string]string{"If-None-Match": etag}); rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rr.Code)
+	}
+
+	if rr := do("PATCH", `{"answer":"A2"}`, nil); rr.Code != http.StatusPreconditionRequired {
+		t.Errorf("expected 428 without If-Match, got %d", rr.Code)
+	}
+
+	rr = do("PATCH", `{"answer":"A2"}`, map[string]string{"If-Match": etag})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var got model.FAQ
+	json.NewDecoder(rr.Body).Decode(&got)
+	// 送っていない項目はそのまま
+	if got.Question != "Q1" || got.Answer != "A2" || got.Category != "billing" || len(got.Tags) != 1 {
+		t.Errorf("expected partial update, got %+v", got)
+	}
+	if rr.Header().Get("ETag") != `"2"` || got.Version != 2 {
+		t.Errorf("expected version 2, got ETag %q version %d", rr.Header().Get("ETag"), got.Version)
+	}
+	if time.Since(got.UpdatedAt) > time.Minute {
+		t.Errorf("expected updated_at to be refreshed, got %v", got.UpdatedAt)
+	}
+
+	// 古いタグでの更新は他の編集を上書きしない
+	rr = do("PATCH", `{"question":"stale"}`, map[string]string{"If-Match": etag})
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for stale ETag, got %d", rr.Code)
+	}
+	if rr := do("PUT", `{"question":"stale","answer":"stale"}`, map[string]string{"If-Match": etag}); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for stale PUT, got %d", rr.Code)
+	}
+	current, _ := faq.GetFAQByID(db, "faq-1", 1)
+	if current.Question != "Q1" {
+		t.Errorf("expected stale update to be rejected, got %q", current.Question)
+	}
+
+	if rr := do("PATCH", `{"question":""}`, map[string]string{"If-Match": `"2"`}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for empty question, got %d", rr.Code)
+	}
+
+	// 成功した更新だけが監査ログに残る
+	events, err := audit.List(db, audit.Filter{Actions: []string{audit.ActionFAQUpdated}, TargetID: "faq-1"}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].ActorID != 1 || events[0].Details["version"] != "2" {
+		t.Errorf("expected one audited update, got %+v", events)
+	}
+}
+
+func TestUpdateFAQ_VersionConflict(t *testing.T) {
+	db := setupTestDB(t)
+
+	f := model.FAQ{ID: "faq-1", UserID: 1, Question: "Q1", Answer: "A1"}
+	if err := faq.CreateFAQ(db, &f); err != nil {
+		t.Fatalf("failed to create faq: %v", err)
+	}
+
+	a, _ := faq.GetFAQByID(db, "faq-1", 1)
+	b, _ := faq.GetFAQByID(db, "faq-1", 1)
+	a.Answer = "from a"
+	if err := faq.UpdateFAQ(db, a, 1); err != nil {
+		t.Fatalf("first update failed: %v", err)
+	}
+	b.Answer = "from b"
+	if err := faq.UpdateFAQ(db, b, 1); err != faq.ErrVersionConflict {
+		t.Errorf("expected ErrVersionConflict, got %v", err)
+	}
+}
@@ -3,129 +3,806 @@ package faq
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
-	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/config"
 	"faq-search-ai/internal/llm"
 	"faq-search-ai/internal/model"
 	"faq-search-ai/internal/vector"
+	"faq-search-ai/internal/workspace"
 )
 
-func HandleFAQListOrCreate(db *sql.DB) http.HandlerFunc {
+// HandleListFAQs は GET /faqs でFAQを一覧する。
+// 本文は従来どおりFAQの配列。件数と次ページのカーソルはヘッダーで返す
+func HandleListFAQs(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value(auth.UserIDContextKey).(int64)
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleViewer)
 		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		switch r.Method {
-		case http.MethodGet:
-			faqs, err := GetFAQsByUser(db, userID)
-			if err != nil {
-				http.Error(w, "Failed to fetch FAQs", http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(faqs)
+		q, err := ParseListQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page, err := ListFAQs(db, scope.WorkspaceID, q)
+		if errors.Is(err, ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch FAQs", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+		if page.NextCursor != "" {
+			next := r.URL.Query()
+			next.Set("cursor", page.NextCursor)
+			w.Header().Set("X-Next-Cursor", page.NextCursor)
+			w.Header().Add("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page.Items)
+	}
+}
 
-		case http.MethodPost:
-			var input struct {
-				Question string `json:"question"`
-				Answer   string `json:"answer"`
+// HandleCreateFAQ は POST /faqs でFAQを作成する
+func HandleCreateFAQ(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			KnowledgeBaseID int64    `json:"knowledge_base_id"`
+			Question        string   `json:"question"`
+			Answer          string   `json:"answer"`
+			Category        string   `json:"category"`
+			Tags            []string `json:"tags"`
+			Status          string   `json:"status"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if input.Question == "" || input.Answer == "" {
+			http.Error(w, "Question and Answer are required", http.StatusBadRequest)
+			return
+		}
+		// 省略時はレビュー不要なら公開、必要なら下書きにする
+		if input.Status == "" {
+			input.Status = model.StatusPublished
+			if config.RequireReview {
+				input.Status = model.StatusDraft
 			}
-			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		}
+		switch input.Status {
+		case model.StatusDraft:
+		case model.StatusPublished:
+			if config.RequireReview {
+				http.Error(w, "Review is required before publishing", http.StatusConflict)
 				return
 			}
-			if input.Question == "" || input.Answer == "" {
-				http.Error(w, "Question and Answer are required", http.StatusBadRequest)
+		default:
+			http.Error(w, "Status must be draft or published", http.StatusBadRequest)
+			return
+		}
+		if input.KnowledgeBaseID != 0 && !knowledgeBaseExists(db, w, input.KnowledgeBaseID, scope.WorkspaceID) {
+			return
+		}
+
+		f := &model.FAQ{
+			WorkspaceID:     scope.WorkspaceID,
+			UserID:          scope.UserID,
+			KnowledgeBaseID: input.KnowledgeBaseID,
+			Question:        input.Question,
+			Answer:          input.Answer,
+			Category:        strings.TrimSpace(input.Category),
+			Tags:            NormalizeTags(input.Tags),
+			Status:          input.Status,
+		}
+		if err := CreateFAQWithVector(db, f); err != nil {
+			log.Printf("CreateFAQWithVector error: %v", err)
+			http.Error(w, "Failed to create FAQ", http.StatusInternalServerError)
+			return
+		}
+		auditFAQ(db, r, scope, audit.ActionFAQCreated, f.ID, map[string]string{"status": f.Status})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(f)
+	}
+}
+
+// HandleGetFAQ は GET /faqs/{id} でFAQを返す。If-None-Match が ETag と一致すれば 304 を返す
+func HandleGetFAQ(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleViewer)
+		if !ok {
+			return
+		}
+		faq, err := GetFAQByID(db, r.PathValue("id"), scope.WorkspaceID)
+		if err != nil || faq == nil {
+			http.Error(w, "FAQ not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", ETag(faq))
+		if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, faq) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(faq)
+	}
+}
+
+// HandleDeleteFAQ は DELETE /faqs/{id} でFAQをゴミ箱へ移す
+func HandleDeleteFAQ(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
+			return
+		}
+		id := r.PathValue("id")
+		if err := DeleteFAQ(db, id, scope.WorkspaceID); err != nil {
+			if errors.Is(err, ErrFAQNotFound) {
+				http.Error(w, "FAQ not found", http.StatusNotFound)
 				return
 			}
+			http.Error(w, "Failed to delete FAQ", http.StatusInternalServerError)
+			return
+		}
+		auditFAQ(db, r, scope, audit.ActionFAQDeleted, id, nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleUpdateFAQ は PUT / PATCH /faqs/{id} を処理する。
+// PUT は全項目の置き換え、PATCH は送られた項目だけを変更する。
+// PATCH は他の編集を上書きしないよう If-Match を必須とし、食い違えば 412 を返す
+func HandleUpdateFAQ(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
+			return
+		}
+		handleUpdate(db, w, r, r.PathValue("id"), scope)
+	}
+}
+
+func handleUpdate(db *sql.DB, w http.ResponseWriter, r *http.Request, id string, scope workspace.Scope) {
+	if r.Method == http.MethodPatch && r.Header.Get("If-Match") == "" {
+		http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+		return
+	}
+
+	current, err := GetFAQByID(db, id, scope.WorkspaceID)
+	if err != nil {
+		http.Error(w, "Failed to fetch FAQ", http.StatusInternalServerError)
+		return
+	}
+	if current == nil {
+		http.Error(w, "FAQ not found", http.StatusNotFound)
+		return
+	}
+	if !checkIfMatch(w, r, current) {
+		return
+	}
+	// レビュー必須の場合、公開版は下書き経由でしか変更できない
+	if config.RequireReview && current.Status == model.StatusPublished {
+		http.Error(w, "Published FAQs are edited via /faqs/{id}/draft", http.StatusConflict)
+		return
+	}
+
+	updated := *current
+	if r.Method == http.MethodPatch {
+		var patch struct {
+			KnowledgeBaseID *int64    `json:"knowledge_base_id"`
+			Question        *string   `json:"question"`
+			Answer          *string   `json:"answer"`
+			Category        *string   `json:"category"`
+			Tags            *[]string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if patch.KnowledgeBaseID != nil {
+			updated.KnowledgeBaseID = *patch.KnowledgeBaseID
+		}
+		if patch.Question != nil {
+			updated.Question = *patch.Question
+		}
+		if patch.Answer != nil {
+			updated.Answer = *patch.Answer
+		}
+		if patch.Category != nil {
+			updated.Category = *patch.Category
+		}
+		if patch.Tags != nil {
+			updated.Tags = *patch.Tags
+		}
+		if strings.TrimSpace(updated.Question) == "" || strings.TrimSpace(updated.Answer) == "" {
+			http.Error(w, "Question and Answer cannot be empty", http.StatusBadRequest)
+			return
+		}
+	} else {
+		var body model.FAQ
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if body.KnowledgeBaseID != 0 {
+			updated.KnowledgeBaseID = body.KnowledgeBaseID
+		}
+		updated.Question = body.Question
+		updated.Answer = body.Answer
+		updated.Category = body.Category
+		updated.Tags = body.Tags
+	}
+	updated.Category = strings.TrimSpace(updated.Category)
+	updated.Tags = NormalizeTags(updated.Tags)
+	if updated.KnowledgeBaseID != current.KnowledgeBaseID && !knowledgeBaseExists(db, w, updated.KnowledgeBaseID, scope.WorkspaceID) {
+		return
+	}
+
+	// If-Match がなければ読み込んだ時点のバージョンとの比較だけを行う
+	err = UpdateFAQ(db, &updated, scope.UserID)
+	if errors.Is(err, ErrVersionConflict) {
+		http.Error(w, "FAQ was modified; fetch it again and retry", http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		log.Printf("UpdateFAQ error: %v", err)
+		http.Error(w, "Failed to update FAQ", http.StatusInternalServerError)
+		return
+	}
+	auditFAQ(db, r, scope, audit.ActionFAQUpdated, id, map[string]string{"version": strconv.FormatInt(updated.Version, 10)})
+
+	w.Header().Set("ETag", ETag(&updated))
+	if r.Method == http.MethodPut {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// HandleSearchFAQ は GET /faqs/search?q=... でキーワード検索する。
+// 埋め込みやLLMを使わないので管理画面の検索や絞り込みに使える。
+// 結果はスコア順でページングもしないため、一覧用の sort / order / cursor は受け付けない
+func HandleSearchFAQ(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleViewer)
+		if !ok {
+			return
+		}
 
-			if err := CreateFAQWithVector(db, userID, input.Question, input.Answer); err != nil {
-				log.Printf("CreateFAQWithVector error: %v", err)
-				http.Error(w, "Failed to create FAQ", http.StatusInternalServerError)
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			http.Error(w, "q is required", http.StatusBadRequest)
+			return
+		}
+		for _, name := range []string{"sort", "order", "cursor"} {
+			if r.URL.Query().Has(name) {
+				http.Error(w, name+" is not supported by search; results are ordered by score", http.StatusBadRequest)
 				return
 			}
-			w.WriteHeader(http.StatusCreated)
+		}
+		lq, err := ParseListQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		hits, err := SearchFAQs(db, scope.WorkspaceID, q, lq.ListFilter, lq.Limit)
+		if err != nil {
+			log.Printf("SearchFAQs error: %v", err)
+			http.Error(w, "Search failed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(hits)
+	}
+}
+
+// faqFromPath はパスの {id} のFAQを返す。見つからなければエラーを書き込んで false を返す
+func faqFromPath(db *sql.DB, w http.ResponseWriter, r *http.Request, scope workspace.Scope) (*model.FAQ, bool) {
+	f, err := GetFAQByID(db, r.PathValue("id"), scope.WorkspaceID)
+	if err != nil {
+		http.Error(w, "Failed to fetch FAQ", http.StatusInternalServerError)
+		return nil, false
+	}
+	if f == nil {
+		http.Error(w, "FAQ not found", http.StatusNotFound)
+		return nil, false
+	}
+	return f, true
+}
+
+// HandleGetDraft は GET /faqs/{id}/draft で公開中のFAQに対する編集中の下書きを返す
+func HandleGetDraft(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleViewer)
+		if !ok {
+			return
+		}
+		f, ok := faqFromPath(db, w, r, scope)
+		if !ok {
+			return
+		}
+		d, err := GetPendingDraft(db, f.ID)
+		if err != nil {
+			http.Error(w, "Failed to fetch draft", http.StatusInternalServerError)
+			return
+		}
+		if d == nil {
+			http.Error(w, "Draft not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d)
+	}
+}
+
+// HandleSaveDraft は PUT /faqs/{id}/draft で下書きを保存する。公開版はそのまま
+func HandleSaveDraft(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
+			return
+		}
+		f, ok := faqFromPath(db, w, r, scope)
+		if !ok {
+			return
+		}
+		var d model.FAQDraft
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
 		}
+		if d.Question == "" || d.Answer == "" {
+			http.Error(w, "Question and Answer are required", http.StatusBadRequest)
+			return
+		}
+		d.AuthorID = scope.UserID
+		d.Category = strings.TrimSpace(d.Category)
+		d.Tags = NormalizeTags(d.Tags)
+
+		err := SavePendingDraft(db, f, &d)
+		if errors.Is(err, ErrNotPublished) {
+			http.Error(w, "Only published FAQs have a pending draft; edit the FAQ directly", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to save draft", http.StatusInternalServerError)
+			return
+		}
+		auditFAQ(db, r, scope, audit.ActionFAQDraftSaved, f.ID, nil)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d)
 	}
 }
 
-func HandleFAQDetail(db *sql.DB) http.HandlerFunc {
+// HandleDeleteDraft は DELETE /faqs/{id}/draft で下書きを破棄する
+func HandleDeleteDraft(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value(auth.UserIDContextKey).(int64)
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
+			return
+		}
+		f, ok := faqFromPath(db, w, r, scope)
 		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if err := DeletePendingDraft(db, f.ID); err != nil {
+			http.Error(w, "Failed to delete draft", http.StatusInternalServerError)
+			return
+		}
+		auditFAQ(db, r, scope, audit.ActionFAQDraftDeleted, f.ID, nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
 
-		// URLからIDを抽出: /faqs/{id} の形式を想定
-		id := strings.TrimPrefix(r.URL.Path, "/faqs/")
-		if id == "" {
-			http.Error(w, "Invalid FAQ ID", http.StatusBadRequest)
+// HandleTransition は POST /faqs/{id}/{action} で公開状態を遷移させる。
+// action は submit, approve, reject, publish, unpublish のいずれか
+func HandleTransition(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, action := r.PathValue("id"), r.PathValue("action")
+		if !IsTransitionAction(action) {
+			http.NotFound(w, r)
+			return
+		}
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
 			return
 		}
 
-		switch r.Method {
-		case http.MethodGet:
-			faq, err := GetFAQByID(db, id, userID)
-			if err != nil {
-				http.Error(w, "FAQ not found", http.StatusNotFound)
-				return
-			}
+		f, err := TransitionFAQ(db, id, scope.WorkspaceID, scope.UserID, action)
+		switch {
+		case errors.Is(err, ErrFAQNotFound):
+			http.Error(w, "FAQ not found", http.StatusNotFound)
+		case errors.Is(err, ErrSelfApproval):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrReviewRequired):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			log.Printf("TransitionFAQ error: %v", err)
+			http.Error(w, "Failed to change FAQ status", http.StatusInternalServerError)
+		default:
+			auditFAQ(db, r, scope, audit.ActionFAQUpdated, id, map[string]string{"transition": action, "status": f.Status})
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(faq)
+			json.NewEncoder(w).Encode(f)
+		}
+	}
+}
 
-		case http.MethodPut:
-			var updatedFAQ model.FAQ
-			if err := json.NewDecoder(r.Body).Decode(&updatedFAQ); err != nil {
-				http.Error(w, "Invalid request body", http.StatusBadRequest)
-				return
-			}
-			updatedFAQ.ID = id
-			updatedFAQ.UserID = userID
+// HandleListRevisions は GET /faqs/{id}/revisions で履歴を返す
+func HandleListRevisions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleViewer)
+		if !ok {
+			return
+		}
+		f, ok := faqFromPath(db, w, r, scope)
+		if !ok {
+			return
+		}
+		revisions, err := GetRevisions(db, f.ID)
+		if err != nil {
+			http.Error(w, "Failed to fetch revisions", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(revisions)
+	}
+}
 
-			if err := UpdateFAQ(db, &updatedFAQ); err != nil {
-				http.Error(w, "Failed to update FAQ", http.StatusInternalServerError)
+// HandleDiffRevisions は GET /faqs/{id}/revisions/diff?from=1&to=2 で2つのリビジョンの差分を返す
+func HandleDiffRevisions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleViewer)
+		if !ok {
+			return
+		}
+		f, ok := faqFromPath(db, w, r, scope)
+		if !ok {
+			return
+		}
+		from, err1 := strconv.Atoi(r.URL.Query().Get("from"))
+		to, err2 := strconv.Atoi(r.URL.Query().Get("to"))
+		if err1 != nil || err2 != nil {
+			http.Error(w, "from and to must be revision numbers", http.StatusBadRequest)
+			return
+		}
+		fromRev, err := GetRevision(db, f.ID, from)
+		if err == nil {
+			var toRev *model.FAQRevision
+			if toRev, err = GetRevision(db, f.ID, to); err == nil {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(DiffRevisions(fromRev, toRev))
 				return
 			}
-			w.WriteHeader(http.StatusNoContent)
+		}
+		if errors.Is(err, ErrRevisionNotFound) {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch revisions", http.StatusInternalServerError)
+	}
+}
 
-		case http.MethodDelete:
-			if err := DeleteFAQ(db, id, userID); err != nil {
-				http.Error(w, "Failed to delete FAQ", http.StatusInternalServerError)
-				return
-			}
-			w.WriteHeader(http.StatusNoContent)
+// HandleRevertFAQ は POST /faqs/{id}/revisions/{rev}/revert で指定リビジョンへ戻す
+func HandleRevertFAQ(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
+			return
+		}
+		f, ok := faqFromPath(db, w, r, scope)
+		if !ok {
+			return
+		}
+		rev, err := strconv.Atoi(r.PathValue("rev"))
+		if err != nil {
+			http.Error(w, "Invalid revision", http.StatusBadRequest)
+			return
+		}
+		if !checkIfMatch(w, r, f) {
+			return
+		}
+		// 戻すのも更新と同じく、レビュー必須なら公開版は直接変えられない
+		if config.RequireReview && f.Status == model.StatusPublished {
+			http.Error(w, "Published FAQs are edited via /faqs/{id}/draft", http.StatusConflict)
+			return
+		}
+		reverted, err := RevertFAQ(db, f.ID, scope.WorkspaceID, scope.UserID, rev, f.Version)
+		if errors.Is(err, ErrRevisionNotFound) {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrVersionConflict) {
+			http.Error(w, "FAQ was modified; fetch it again and retry", http.StatusPreconditionFailed)
+			return
+		}
+		if err != nil {
+			log.Printf("RevertFAQ error: %v", err)
+			http.Error(w, "Failed to revert FAQ", http.StatusInternalServerError)
+			return
+		}
+		auditFAQ(db, r, scope, audit.ActionFAQUpdated, f.ID, map[string]string{"reverted_to": strconv.Itoa(rev)})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reverted)
+	}
+}
 
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// HandleListTrash は GET /trash でゴミ箱内のFAQを返す
+func HandleListTrash(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleViewer)
+		if !ok {
+			return
+		}
+		faqs, err := GetTrashedFAQs(db, scope.WorkspaceID)
+		if err != nil {
+			http.Error(w, "Failed to fetch trash", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(faqs)
+	}
+}
+
+// HandleRestoreFAQ は POST /trash/{id}/restore でFAQをゴミ箱から元に戻す
+func HandleRestoreFAQ(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
+			return
+		}
+		f, err := RestoreFAQ(db, r.PathValue("id"), scope.WorkspaceID)
+		if errors.Is(err, ErrNotInTrash) {
+			http.Error(w, "FAQ not found in trash", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("RestoreFAQ error: %v", err)
+			http.Error(w, "Failed to restore FAQ", http.StatusInternalServerError)
+			return
+		}
+		auditFAQ(db, r, scope, audit.ActionFAQRestored, f.ID, nil)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(f)
+	}
+}
+
+// HandlePurgeFAQ は DELETE /trash/{id} でゴミ箱内のFAQを完全に削除する
+func HandlePurgeFAQ(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
+			return
+		}
+		id := r.PathValue("id")
+		err := PurgeFAQ(db, id, scope.WorkspaceID)
+		if errors.Is(err, ErrNotInTrash) {
+			http.Error(w, "FAQ not found in trash", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to delete FAQ", http.StatusInternalServerError)
+			return
+		}
+		auditFAQ(db, r, scope, audit.ActionFAQPurged, id, nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleListKnowledgeBases は GET /knowledge-bases でナレッジベースを一覧する
+func HandleListKnowledgeBases(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleViewer)
+		if !ok {
+			return
+		}
+		bases, err := ListKnowledgeBases(db, scope.WorkspaceID)
+		if err != nil {
+			http.Error(w, "Failed to fetch knowledge bases", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(bases)
+	}
+}
+
+// HandleCreateKnowledgeBase は POST /knowledge-bases でナレッジベースを作成する
+func HandleCreateKnowledgeBase(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
+			return
+		}
+		var input struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		kb := &model.KnowledgeBase{
+			WorkspaceID: scope.WorkspaceID,
+			UserID:      scope.UserID,
+			Name:        strings.TrimSpace(input.Name),
+			Description: strings.TrimSpace(input.Description),
+		}
+		if kb.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		err := CreateKnowledgeBase(db, kb)
+		if errors.Is(err, ErrKnowledgeBaseExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to create knowledge base", http.StatusInternalServerError)
+			return
+		}
+		auditKnowledgeBase(db, r, scope, audit.ActionKnowledgeBaseCreated, kb.ID, map[string]string{"name": kb.Name})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(kb)
+	}
+}
+
+// knowledgeBaseFromPath はパスの {id} のナレッジベースを返す。見つからなければエラーを書き込んで false を返す
+func knowledgeBaseFromPath(db *sql.DB, w http.ResponseWriter, r *http.Request, scope workspace.Scope) (*model.KnowledgeBase, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	kb, err := GetKnowledgeBase(db, id, scope.WorkspaceID)
+	if err != nil {
+		http.Error(w, "Failed to fetch knowledge base", http.StatusInternalServerError)
+		return nil, false
+	}
+	if kb == nil {
+		http.Error(w, "Knowledge base not found", http.StatusNotFound)
+		return nil, false
+	}
+	return kb, true
+}
+
+// HandleGetKnowledgeBase は GET /knowledge-bases/{id} でナレッジベースを返す
+func HandleGetKnowledgeBase(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleViewer)
+		if !ok {
+			return
+		}
+		kb, ok := knowledgeBaseFromPath(db, w, r, scope)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(kb)
+	}
+}
+
+// HandleUpdateKnowledgeBase は PATCH /knowledge-bases/{id} で名前と説明を変更する
+func HandleUpdateKnowledgeBase(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
+			return
+		}
+		kb, ok := knowledgeBaseFromPath(db, w, r, scope)
+		if !ok {
+			return
+		}
+		var input struct {
+			Name        *string `json:"name"`
+			Description *string `json:"description"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if input.Name != nil {
+			kb.Name = strings.TrimSpace(*input.Name)
+		}
+		if input.Description != nil {
+			kb.Description = strings.TrimSpace(*input.Description)
+		}
+		if kb.Name == "" {
+			http.Error(w, "Name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		err := UpdateKnowledgeBase(db, kb)
+		if errors.Is(err, ErrKnowledgeBaseExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to update knowledge base", http.StatusInternalServerError)
+			return
+		}
+		auditKnowledgeBase(db, r, scope, audit.ActionKnowledgeBaseUpdated, kb.ID, map[string]string{"name": kb.Name})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(kb)
+	}
+}
+
+// HandleDeleteKnowledgeBase は DELETE /knowledge-bases/{id} でナレッジベースを削除する。FAQが残っていれば 409
+func HandleDeleteKnowledgeBase(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleEditor)
+		if !ok {
+			return
+		}
+		kb, ok := knowledgeBaseFromPath(db, w, r, scope)
+		if !ok {
+			return
+		}
+		err := DeleteKnowledgeBase(db, kb.ID, scope.WorkspaceID)
+		if errors.Is(err, ErrKnowledgeBaseNotEmpty) {
+			http.Error(w, "Move or purge its FAQs (including the trash) first", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to delete knowledge base", http.StatusInternalServerError)
+			return
 		}
+		auditKnowledgeBase(db, r, scope, audit.ActionKnowledgeBaseDeleted, kb.ID, map[string]string{"name": kb.Name})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// knowledgeBaseExists はワークスペースにナレッジベースがあるか確かめ、無ければエラーを書き込む
+func knowledgeBaseExists(db *sql.DB, w http.ResponseWriter, id, workspaceID int64) bool {
+	kb, err := GetKnowledgeBase(db, id, workspaceID)
+	if err != nil {
+		http.Error(w, "Failed to fetch knowledge base", http.StatusInternalServerError)
+		return false
+	}
+	if kb == nil {
+		http.Error(w, "Knowledge base not found", http.StatusNotFound)
+		return false
 	}
+	return true
 }
 
+// HandleAskFAQ は POST /faqs/ask で似たFAQをもとにLLMで回答を作る
 func HandleAskFAQ(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := r.Context().Value(auth.UserIDContextKey).(int64)
+		scope, ok := workspace.FromRequest(db, w, r, model.RoleViewer)
 		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		var payload struct {
-			Question string `json:"question"`
+			KnowledgeBaseID int64    `json:"knowledge_base_id"`
+			Question        string   `json:"question"`
+			Category        string   `json:"category"`
+			Tags            []string `json:"tags"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || strings.TrimSpace(payload.Question) == "" {
 			http.Error(w, "Invalid question", http.StatusBadRequest)
 			return
 		}
+		// 指定されたナレッジベースのFAQだけから回答する。省略時は全てのナレッジベースが対象
+		if payload.KnowledgeBaseID != 0 && !knowledgeBaseExists(db, w, payload.KnowledgeBaseID, scope.WorkspaceID) {
+			return
+		}
 
 		// 1. 質問をEmbeddingに変換
 		vectorData, err := vector.GenerateEmbedding(payload.Question)
@@ -135,11 +812,21 @@ func HandleAskFAQ(db *sql.DB) http.HandlerFunc {
 		}
 
 		// 2. Qdrantで類似FAQの検索（上位5件取得）
-		similarQuestions, err := vector.SearchSimilarFAQs(vectorData, userID, 5)
+		filter := vector.SearchFilter{
+			KnowledgeBaseID: payload.KnowledgeBaseID,
+			Category:        strings.TrimSpace(payload.Category),
+			Tags:            NormalizeTags(payload.Tags),
+		}
+		similarQuestions, err := vector.SearchSimilarFAQs(vectorData, scope.WorkspaceID, filter, 5)
 		if err != nil {
 			http.Error(w, "Vector search failed", http.StatusInternalServerError)
 			return
 		}
+		if similarQuestions, err = FilterAnswerable(db, similarQuestions); err != nil {
+			log.Printf("FilterAnswerable error: %v", err)
+			http.Error(w, "Vector search failed", http.StatusInternalServerError)
+			return
+		}
 		if len(similarQuestions) == 0 {
 			http.Error(w, "No relevant FAQs found", http.StatusNotFound)
 			return
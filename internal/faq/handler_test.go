@@ -6,8 +6,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
 	"faq-search-ai/internal/faq"
 	"faq-search-ai/internal/model"
+	"faq-search-ai/internal/workspace"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -20,31 +22,57 @@ func setupTestDB(t *testing.T) *sql.DB {
 	if err != nil {
 		t.Fatalf("failed to open db: %v", err)
 	}
-	_, err = db.Exec(`CREATE TABLE faqs (
-		id TEXT PRIMARY KEY,
-		user_id INTEGER,
-		question TEXT,
-		answer TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`)
-	if err != nil {
-		t.Fatalf("failed to create table: %v", err)
+	db.SetMaxOpenConns(1)
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
 	}
 	return db
 }
 
-func TestHandleFAQListOrCreate_Get(t *testing.T) {
+// routes は本番のルーターと同じパターンで FAQ のハンドラーを振り分ける
+func routes(db *sql.DB) http.HandlerFunc {
+	mux := http.NewServeMux()
+	for pattern, h := range map[string]http.HandlerFunc{
+		"GET /faqs":                              faq.HandleListFAQs(db),
+		"POST /faqs":                             faq.HandleCreateFAQ(db),
+		"GET /faqs/search":                       faq.HandleSearchFAQ(db),
+		"GET /faqs/{id}":                         faq.HandleGetFAQ(db),
+		"PUT /faqs/{id}":                         faq.HandleUpdateFAQ(db),
+		"PATCH /faqs/{id}":                       faq.HandleUpdateFAQ(db),
+		"DELETE /faqs/{id}":                      faq.HandleDeleteFAQ(db),
+		"GET /faqs/{id}/draft":                   faq.HandleGetDraft(db),
+		"PUT /faqs/{id}/draft":                   faq.HandleSaveDraft(db),
+		"DELETE /faqs/{id}/draft":                faq.HandleDeleteDraft(db),
+		"POST /faqs/{id}/{action}":               faq.HandleTransition(db),
+		"GET /faqs/{id}/revisions":               faq.HandleListRevisions(db),
+		"GET /faqs/{id}/revisions/diff":          faq.HandleDiffRevisions(db),
+		"POST /faqs/{id}/revisions/{rev}/revert": faq.HandleRevertFAQ(db),
+		"GET /trash":                             faq.HandleListTrash(db),
+		"POST /trash/{id}/restore":               faq.HandleRestoreFAQ(db),
+		"DELETE /trash/{id}":                     faq.HandlePurgeFAQ(db),
+		"GET /knowledge-bases":                   faq.HandleListKnowledgeBases(db),
+		"POST /knowledge-bases":                  faq.HandleCreateKnowledgeBase(db),
+		"GET /knowledge-bases/{id}":              faq.HandleGetKnowledgeBase(db),
+		"PATCH /knowledge-bases/{id}":            faq.HandleUpdateKnowledgeBase(db),
+		"DELETE /knowledge-bases/{id}":           faq.HandleDeleteKnowledgeBase(db),
+	} {
+		mux.HandleFunc(pattern, h)
+	}
+	return mux.ServeHTTP
+}
+
+func TestHandleListFAQs(t *testing.T) {
 	db := setupTestDB(t)
 
 	// 事前にデータを挿入
-	_, err := db.Exec(`INSERT INTO faqs (id, user_id, question, answer) VALUES (?, ?, ?, ?)`,
-		"faq-1", 1, "What is Go?", "Go is a programming language.")
+	ws, _ := workspace.EnsurePersonal(db, 1)
+	_, err := db.Exec(`INSERT INTO faqs (id, workspace_id, user_id, question, answer) VALUES (?, ?, ?, ?, ?)`,
+		"faq-1", ws, 1, "What is Go?", "Go is a programming language.")
 	if err != nil {
 		t.Fatalf("failed to insert test data: %v", err)
 	}
 
-	handler := faq.HandleFAQListOrCreate(db)
+	handler := routes(db)
 
 	req := httptest.NewRequest("GET", "/faqs", nil)
 	ctx := context.WithValue(req.Context(), auth.UserIDContextKey, int64(1))
@@ -65,10 +93,10 @@ func TestHandleFAQListOrCreate_Get(t *testing.T) {
 	}
 }
 
-func TestHandleFAQListOrCreate_Post_Validation(t *testing.T) {
+func TestHandleCreateFAQ_Validation(t *testing.T) {
 	db := setupTestDB(t)
 
-	handler := faq.HandleFAQListOrCreate(db)
+	handler := routes(db)
 
 	payload := `{"question": "", "answer": ""}`
 	req := httptest.NewRequest("POST", "/faqs", bytes.NewBufferString(payload))
@@ -83,3 +111,46 @@ func TestHandleFAQListOrCreate_Post_Validation(t *testing.T) {
 		t.Errorf("expected 400 for empty question/answer, got %d", rr.Code)
 	}
 }
+
+func TestHandleListFAQs_FilterByCategoryAndTag(t *testing.T) {
+	db := setupTestDB(t)
+
+	for _, f := range []model.FAQ{
+		{ID: "faq-1", UserID: 1, Question: "料金は？", Answer: "月額制です。", Category: "billing", Tags: []string{"price", "plan"}},
+		{ID: "faq-2", UserID: 1, Question: "解約方法は？", Answer: "設定画面から。", Category: "billing", Tags: []string{"plan"}},
+		{ID: "faq-3", UserID: 1, Question: "ログインできない", Answer: "パスワードを再設定してください。", Category: "account"},
+	} {
+		f := f
+		if err := faq.CreateFAQ(db, &f); err != nil {
+			t.Fatalf("failed to insert test data: %v", err)
+		}
+	}
+
+	handler := routes(db)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"/faqs?category=billing", 2},
+		{"/faqs?category=billing&tag=price", 1},
+		{"/faqs?tag=plan", 2},
+		{"/faqs?tag=plan&tag=price", 1},
+		{"/faqs?category=account&tag=plan", 0},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		var faqs []model.FAQ
+		if err := json.NewDecoder(rr.Body).Decode(&faqs); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.query, err)
+		}
+		if len(faqs) != tt.want {
+			t.Errorf("%s: expected %d faqs, got %d", tt.query, tt.want, len(faqs))
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package faq
+
+import (
+	"database/sql"
+	"errors"
+	"faq-search-ai/internal/model"
+	"faq-search-ai/internal/vector"
+	"faq-search-ai/internal/workspace"
+	"log"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// DefaultKnowledgeBaseName はナレッジベース未指定のFAQを入れる先の名前
+const DefaultKnowledgeBaseName = "Default"
+
+// Qdrant の既存ポイントに後から追加したペイロードを付けたかどうかの印
+const (
+	knowledgeBasePayloadVersion = 1
+	workspacePayloadVersion     = 1
+)
+
+var (
+	ErrKnowledgeBaseNotFound = errors.New("knowledge base not found")
+	ErrKnowledgeBaseExists   = errors.New("knowledge base with that name already exists")
+	ErrKnowledgeBaseNotEmpty = errors.New("knowledge base still has FAQs")
+)
+
+// ListKnowledgeBases はワークスペースのナレッジベースを作成順に返す。FAQCount はゴミ箱を除いた件数
+func ListKnowledgeBases(db *sql.DB, workspaceID int64) ([]model.KnowledgeBase, error) {
+	rows, err := db.Query(`
+		SELECT kb.id, kb.workspace_id, kb.user_id, kb.name, kb.description, kb.created_at, kb.updated_at,
+			(SELECT COUNT(*) FROM faqs WHERE faqs.knowledge_base_id = kb.id AND faqs.deleted_at IS NULL)
+		FROM knowledge_bases kb WHERE kb.workspace_id = ? ORDER BY kb.id`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bases := []model.KnowledgeBase{}
+	for rows.Next() {
+		var kb model.KnowledgeBase
+		if err := rows.Scan(&kb.ID, &kb.WorkspaceID, &kb.UserID, &kb.Name, &kb.Description, &kb.CreatedAt, &kb.UpdatedAt, &kb.FAQCount); err != nil {
+			return nil, err
+		}
+		bases = append(bases, kb)
+	}
+	return bases, rows.Err()
+}
+
+// GetKnowledgeBase はワークスペース内のナレッジベースを返す。無ければ nil
+func GetKnowledgeBase(db *sql.DB, id, workspaceID int64) (*model.KnowledgeBase, error) {
+	var kb model.KnowledgeBase
+	err := db.QueryRow(`
+		SELECT kb.id, kb.workspace_id, kb.user_id, kb.name, kb.description, kb.created_at, kb.updated_at,
+			(SELECT COUNT(*) FROM faqs WHERE faqs.knowledge_base_id = kb.id AND faqs.deleted_at IS NULL)
+		FROM knowledge_bases kb WHERE kb.id = ? AND kb.workspace_id = ?`, id, workspaceID).
+		Scan(&kb.ID, &kb.WorkspaceID, &kb.UserID, &kb.Name, &kb.Description, &kb.CreatedAt, &kb.UpdatedAt, &kb.FAQCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &kb, nil
+}
+
+func CreateKnowledgeBase(db *sql.DB, kb *model.KnowledgeBase) error {
+	now := time.Now()
+	result, err := db.Exec(`
+		INSERT INTO knowledge_bases (workspace_id, user_id, name, description, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, kb.WorkspaceID, kb.UserID, kb.Name, kb.Description, now, now)
+	if isUniqueViolation(err) {
+		return ErrKnowledgeBaseExists
+	}
+	if err != nil {
+		return err
+	}
+	if kb.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	kb.CreatedAt, kb.UpdatedAt = now, now
+	return nil
+}
+
+// UpdateKnowledgeBase は名前と説明を変更する
+func UpdateKnowledgeBase(db *sql.DB, kb *model.KnowledgeBase) error {
+	now := time.Now()
+	result, err := db.Exec(`
+		UPDATE knowledge_bases SET name = ?, description = ?, updated_at = ?
+		WHERE id = ? AND workspace_id = ?`, kb.Name, kb.Description, now, kb.ID, kb.WorkspaceID)
+	if isUniqueViolation(err) {
+		return ErrKnowledgeBaseExists
+	}
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrKnowledgeBaseNotFound
+	}
+	kb.UpdatedAt = now
+	return nil
+}
+
+// DeleteKnowledgeBase は空のナレッジベースを削除する。
+// ゴミ箱内のFAQも復元先がなくなるため、残っていれば削除しない
+func DeleteKnowledgeBase(db *sql.DB, id, workspaceID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM faqs WHERE knowledge_base_id = ?`, id).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrKnowledgeBaseNotEmpty
+	}
+	result, err := tx.Exec(`DELETE FROM knowledge_bases WHERE id = ? AND workspace_id = ?`, id, workspaceID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrKnowledgeBaseNotFound
+	}
+	return tx.Commit()
+}
+
+// defaultKnowledgeBase はワークスペースの最初のナレッジベースを返し、無ければ userID が作成する
+func defaultKnowledgeBase(tx *sql.Tx, workspaceID, userID int64) (int64, error) {
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM knowledge_bases WHERE workspace_id = ? ORDER BY id LIMIT 1`, workspaceID).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	now := time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO knowledge_bases (workspace_id, user_id, name, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)`, workspaceID, userID, DefaultKnowledgeBaseName, now, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// EnsureWorkspaces はワークスペース導入前のFAQとナレッジベースを作成者の個人用ワークスペースへ割り当て、
+// Qdrant の既存ポイントにも workspace_id を付ける。InitCollections の後に呼ぶこと
+func EnsureWorkspaces(db *sql.DB) error {
+	users, err := queryIDs(db, `
+		SELECT user_id FROM faqs WHERE workspace_id = 0
+		UNION SELECT user_id FROM knowledge_bases WHERE workspace_id = 0`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, userID := range users {
+		ws, err := workspace.EnsurePersonal(tx, userID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE faqs SET workspace_id = ? WHERE user_id = ? AND workspace_id = 0`, ws, userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE knowledge_bases SET workspace_id = ? WHERE user_id = ? AND workspace_id = 0`, ws, userID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return syncPayload(db, "workspace_id", workspacePayloadVersion)
+}
+
+// EnsureKnowledgeBases はナレッジベース導入前のFAQを各ワークスペースの既定のナレッジベースへ割り当て、
+// Qdrant の既存ポイントにも knowledge_base_id を付ける。EnsureWorkspaces の後に呼ぶこと
+func EnsureKnowledgeBases(db *sql.DB) error {
+	if err := assignDefaultKnowledgeBases(db); err != nil {
+		return err
+	}
+	return syncPayload(db, "knowledge_base_id", knowledgeBasePayloadVersion)
+}
+
+func assignDefaultKnowledgeBases(db *sql.DB) error {
+	rows, err := db.Query(`SELECT workspace_id, MIN(user_id) FROM faqs WHERE knowledge_base_id = 0 GROUP BY workspace_id`)
+	if err != nil {
+		return err
+	}
+	owners := map[int64]int64{}
+	for rows.Next() {
+		var workspaceID, userID int64
+		if err := rows.Scan(&workspaceID, &userID); err != nil {
+			rows.Close()
+			return err
+		}
+		owners[workspaceID] = userID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for workspaceID, userID := range owners {
+		kb, err := defaultKnowledgeBase(tx, workspaceID, userID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE faqs SET knowledge_base_id = ? WHERE workspace_id = ? AND knowledge_base_id = 0`, kb, workspaceID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// syncPayload は公開中のFAQの column の値を Qdrant の同名のペイロードに書き込む。
+// 一度成功すれば index_versions に記録し、version が変わるまで再実行しない
+func syncPayload(db *sql.DB, column string, version int) error {
+	marker := "qdrant_" + column
+	var done int
+	err := db.QueryRow(`SELECT version FROM index_versions WHERE name = ?`, marker).Scan(&done)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if done == version {
+		return nil
+	}
+
+	// column は呼び出し元の定数のみ
+	rows, err := db.Query(`SELECT `+column+`, id FROM faqs WHERE status = ? AND deleted_at IS NULL`, model.StatusPublished)
+	if err != nil {
+		return err
+	}
+	points := map[int64][]string{}
+	for rows.Next() {
+		var value int64
+		var id string
+		if err := rows.Scan(&value, &id); err != nil {
+			rows.Close()
+			return err
+		}
+		points[value] = append(points[value], id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for value, ids := range points {
+		if err := vector.SetPayload(ids, map[string]interface{}{column: value}); err != nil {
+			return err
+		}
+	}
+	if len(points) > 0 {
+		log.Printf("set %s on existing Qdrant points (%d groups)", column, len(points))
+	}
+	_, err = db.Exec(`
+		INSERT INTO index_versions (name, version) VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET version = excluded.version`, marker, version)
+	return err
+}
+
+func queryIDs(db *sql.DB, query string, args ...interface{}) ([]int64, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
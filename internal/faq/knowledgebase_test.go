@@ -0,0 +1,159 @@
+package faq_test
+
+import (
+	"context"
+	"encoding/json"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/faq"
+	"faq-search-ai/internal/model"
+	"faq-search-ai/internal/workspace"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHandleKnowledgeBases(t *testing.T) {
+	db := setupTestDB(t)
+
+	do := func(handler http.HandlerFunc, method, path, body string, userID int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, userID))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	kbs := routes(db)
+
+	rr := do(kbs, "POST", "/knowledge-bases", `{"name":"Product A"}`, 1)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var a model.KnowledgeBase
+	json.NewDecoder(rr.Body).Decode(&a)
+
+	if rr := do(kbs, "POST", "/knowledge-bases", `{"name":"Product A"}`, 1); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for duplicate name, got %d", rr.Code)
+	}
+	if rr := do(kbs, "POST", "/knowledge-bases", `{"name":" "}`, 1); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for empty name, got %d", rr.Code)
+	}
+
+	// 他人のナレッジベースには登録できない
+	rr = do(routes(db), "POST", "/faqs", `{"question":"Q","answer":"A","knowledge_base_id":`+strconv.FormatInt(a.ID, 10)+`}`, 2)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's knowledge base, got %d", rr.Code)
+	}
+
+	rr = do(routes(db), "POST", "/faqs", `{"question":"Q1","answer":"A1","status":"draft","knowledge_base_id":`+strconv.FormatInt(a.ID, 10)+`}`, 1)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var created model.FAQ
+	json.NewDecoder(rr.Body).Decode(&created)
+	if created.KnowledgeBaseID != a.ID {
+		t.Errorf("expected faq in knowledge base %d, got %d", a.ID, created.KnowledgeBaseID)
+	}
+
+	// 指定がなければ既定のナレッジベースに入る
+	other := model.FAQ{ID: "faq-default", UserID: 1, Question: "Q2", Answer: "A2"}
+	if err := faq.CreateFAQ(db, &other); err != nil {
+		t.Fatalf("failed to create faq: %v", err)
+	}
+	if other.KnowledgeBaseID != a.ID {
+		t.Errorf("expected first knowledge base to be the default, got %d", other.KnowledgeBaseID)
+	}
+
+	rr = do(kbs, "POST", "/knowledge-bases", `{"name":"Product B"}`, 1)
+	var b model.KnowledgeBase
+	json.NewDecoder(rr.Body).Decode(&b)
+
+	rr = do(routes(db), "GET", "/faqs/faq-default", "", 1)
+	etag := rr.Header().Get("ETag")
+	req := httptest.NewRequest("PATCH", "/faqs/faq-default", strings.NewReader(`{"knowledge_base_id":`+strconv.FormatInt(b.ID, 10)+`}`))
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+	req.Header.Set("If-Match", etag)
+	rr = httptest.NewRecorder()
+	routes(db).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 moving faq, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = do(routes(db), "GET", "/faqs?knowledge_base_id="+strconv.FormatInt(b.ID, 10), "", 1)
+	var listed []model.FAQ
+	json.NewDecoder(rr.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].ID != "faq-default" {
+		t.Errorf("expected moved faq in knowledge base B, got %+v", listed)
+	}
+
+	rr = do(kbs, "GET", "/knowledge-bases", "", 1)
+	var bases []model.KnowledgeBase
+	json.NewDecoder(rr.Body).Decode(&bases)
+	if len(bases) != 2 || bases[0].FAQCount != 1 || bases[1].FAQCount != 1 {
+		t.Errorf("expected two knowledge bases with one faq each, got %+v", bases)
+	}
+	if rr := do(kbs, "GET", "/knowledge-bases", "", 2); !strings.HasPrefix(rr.Body.String(), "[]") {
+		t.Errorf("expected no knowledge bases for another user, got %s", rr.Body.String())
+	}
+
+	rr = do(kbs, "PATCH", "/knowledge-bases/"+strconv.FormatInt(b.ID, 10), `{"description":"Second product"}`, 1)
+	var patched model.KnowledgeBase
+	json.NewDecoder(rr.Body).Decode(&patched)
+	if rr.Code != http.StatusOK || patched.Name != "Product B" || patched.Description != "Second product" {
+		t.Errorf("expected description update, got %d %+v", rr.Code, patched)
+	}
+
+	if rr := do(kbs, "DELETE", "/knowledge-bases/"+strconv.FormatInt(b.ID, 10), "", 1); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 deleting a non-empty knowledge base, got %d", rr.Code)
+	}
+	rr = do(kbs, "POST", "/knowledge-bases", `{"name":"Empty"}`, 1)
+	var empty model.KnowledgeBase
+	json.NewDecoder(rr.Body).Decode(&empty)
+	if rr := do(kbs, "DELETE", "/knowledge-bases/"+strconv.FormatInt(empty.ID, 10), "", 1); rr.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rr.Code)
+	}
+	if rr := do(kbs, "GET", "/knowledge-bases/"+strconv.FormatInt(empty.ID, 10), "", 1); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", rr.Code)
+	}
+
+	events, err := audit.List(db, audit.Filter{TargetType: audit.TargetKnowledgeBase}, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to list audit log: %v", err)
+	}
+	actions := map[string]int{}
+	for _, e := range events {
+		actions[e.Action]++
+	}
+	if actions[audit.ActionKnowledgeBaseCreated] != 3 || actions[audit.ActionKnowledgeBaseUpdated] != 1 || actions[audit.ActionKnowledgeBaseDeleted] != 1 {
+		t.Errorf("unexpected audited knowledge base changes: %v", actions)
+	}
+}
+
+func TestEnsureKnowledgeBases_AssignsLegacyFAQs(t *testing.T) {
+	db := setupTestDB(t)
+
+	// ワークスペース・ナレッジベース導入前の行
+	db.Exec(`INSERT INTO faqs (id, user_id, question, answer, status) VALUES ('a', 1, 'q', 'a', 'draft'), ('b', 2, 'q', 'a', 'draft')`)
+
+	if err := faq.EnsureWorkspaces(db); err != nil {
+		t.Fatalf("ensure workspaces failed: %v", err)
+	}
+	if err := faq.EnsureKnowledgeBases(db); err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+	for _, userID := range []int64{1, 2} {
+		ws, _ := workspace.EnsurePersonal(db, userID)
+		if f, _ := faq.GetFAQsByWorkspace(db, ws, faq.ListFilter{}); len(f) != 1 {
+			t.Errorf("user %d: expected the legacy faq in the personal workspace, got %+v", userID, f)
+		}
+		bases, err := faq.ListKnowledgeBases(db, ws)
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		if len(bases) != 1 || bases[0].Name != faq.DefaultKnowledgeBaseName || bases[0].FAQCount != 1 {
+			t.Errorf("user %d: expected default knowledge base with the legacy faq, got %+v", userID, bases)
+		}
+	}
+}
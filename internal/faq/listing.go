@@ -0,0 +1,291 @@
+package faq
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/model"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sortColumns は並び替えに使える列。クエリに埋め込むのはここにある値だけ
+var sortColumns = map[string]string{
+	"created":  "created_at",
+	"updated":  "updated_at",
+	"question": "question",
+}
+
+// ListFilter は一覧取得時の絞り込み条件。Tags は全て付いているFAQのみ返す
+type ListFilter struct {
+	KnowledgeBaseID int64
+	Category        string
+	Tags            []string
+	Status          string
+	CreatedAfter    time.Time
+	CreatedBefore   time.Time
+}
+
+// where はワークスペース内の絞り込み条件のSQLを返す。結合クエリでも使えるよう列は faqs. で修飾する
+func (f ListFilter) where(workspaceID int64) (string, []interface{}) {
+	conds := []string{"faqs.workspace_id = ?", "faqs.deleted_at IS NULL"}
+	args := []interface{}{workspaceID}
+	if f.KnowledgeBaseID != 0 {
+		conds = append(conds, "faqs.knowledge_base_id = ?")
+		args = append(args, f.KnowledgeBaseID)
+	}
+	if f.Category != "" {
+		conds = append(conds, "faqs.category = ?")
+		args = append(args, f.Category)
+	}
+	for _, tag := range f.Tags {
+		conds = append(conds, "faqs.id IN (SELECT faq_id FROM faq_tags WHERE tag = ?)")
+		args = append(args, tag)
+	}
+	if f.Status != "" {
+		conds = append(conds, "faqs.status = ?")
+		args = append(args, f.Status)
+	}
+	// 保存時のタイムゾーン表記の違いを吸収するため datetime() でUTCに揃えて比較する
+	if !f.CreatedAfter.IsZero() {
+		conds = append(conds, "datetime(faqs.created_at) >= datetime(?)")
+		args = append(args, f.CreatedAfter.UTC().Format(time.DateTime))
+	}
+	if !f.CreatedBefore.IsZero() {
+		conds = append(conds, "datetime(faqs.created_at) < datetime(?)")
+		args = append(args, f.CreatedBefore.UTC().Format(time.DateTime))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// ListQuery は絞り込みに加えて並び順とページ位置を指定する
+type ListQuery struct {
+	ListFilter
+	Sort   string // created, updated, question
+	Desc   bool
+	Limit  int
+	Cursor string
+}
+
+// FAQPage は一覧の1ページ分。NextCursor が空なら最後のページ
+type FAQPage struct {
+	Items      []model.FAQ
+	Total      int
+	NextCursor string
+}
+
+// cursor はページ境界となる最後の行の並び替えキー
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// encodeSortValue は並び替えキーをカーソルに入れる文字列にする。日時は UTC の RFC3339 にそろえる
+func encodeSortValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// sortArg はカーソルの値を列と同じ型に戻す。列をそのまま比較するのでインデックスが使える
+func sortArg(sort, value string) (interface{}, error) {
+	if sort == "question" {
+		return value, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return t.UTC(), nil
+}
+
+// ListFAQs はキーセット方式でFAQを1ページ分返す
+func ListFAQs(db *sql.DB, workspaceID int64, q ListQuery) (*FAQPage, error) {
+	if q.Sort == "" {
+		q.Sort = "created"
+	}
+	column, ok := sortColumns[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", q.Sort)
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		q.Limit = MaxPageSize
+	}
+
+	where, args := q.where(workspaceID)
+
+	page := &FAQPage{Items: []model.FAQ{}}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM faqs WHERE `+where, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	// 同じ値の行が続いてもページ境界がずれないよう id を第2キーにする
+	cmp, order := ">", "ASC"
+	if q.Desc {
+		cmp, order = "<", "DESC"
+	}
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != q.Sort || c.Desc != q.Desc {
+			return nil, ErrInvalidCursor
+		}
+		value, err := sortArg(q.Sort, c.Value)
+		if err != nil {
+			return nil, err
+		}
+		where += fmt.Sprintf(" AND (%s %s ? OR (%s = ? AND id %s ?))", column, cmp, column, cmp)
+		args = append(args, value, value, c.ID)
+	}
+	args = append(args, q.Limit+1)
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT id, workspace_id, user_id, knowledge_base_id, question, answer, category, status, version, created_at, updated_at, %s
+		FROM faqs WHERE %s ORDER BY %s %s, id %s LIMIT ?`, column, where, column, order, order), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var last cursor
+	for rows.Next() {
+		var f model.FAQ
+		var sortValue interface{}
+		if err := rows.Scan(&f.ID, &f.WorkspaceID, &f.UserID, &f.KnowledgeBaseID, &f.Question, &f.Answer, &f.Category, &f.Status, &f.Version, &f.CreatedAt, &f.UpdatedAt, &sortValue); err != nil {
+			return nil, err
+		}
+		if len(page.Items) == q.Limit {
+			page.NextCursor = encodeCursor(last)
+			break
+		}
+		page.Items = append(page.Items, f)
+		last = cursor{Sort: q.Sort, Desc: q.Desc, Value: encodeSortValue(sortValue), ID: f.ID}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := loadTags(db, page.Items); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// ParseListQuery は GET /faqs のクエリパラメータを解釈する
+//
+//	knowledge_base_id, category, tag (複数可), status  絞り込み
+//	created_after, created_before                     作成日時の範囲 (RFC3339 または YYYY-MM-DD)
+//	sort=created|updated|question, order=asc|desc
+//	limit, cursor                                     ページング
+func ParseListQuery(values url.Values) (ListQuery, error) {
+	q := ListQuery{
+		ListFilter: ListFilter{
+			Category: strings.TrimSpace(values.Get("category")),
+			Tags:     NormalizeTags(values["tag"]),
+			Status:   values.Get("status"),
+		},
+		Sort:   values.Get("sort"),
+		Cursor: values.Get("cursor"),
+	}
+
+	switch q.Status {
+	case "", model.StatusDraft, model.StatusInReview, model.StatusPublished:
+	default:
+		return q, fmt.Errorf("unknown status %q", q.Status)
+	}
+
+	if q.Sort == "" {
+		q.Sort = "created"
+	}
+	if _, ok := sortColumns[q.Sort]; !ok {
+		return q, fmt.Errorf("sort must be one of created, updated, question")
+	}
+
+	// 日時は新しい順、質問文は昇順を既定にする
+	switch values.Get("order") {
+	case "":
+		q.Desc = q.Sort != "question"
+	case "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+
+	if v := values.Get("knowledge_base_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return q, fmt.Errorf("knowledge_base_id must be a positive integer")
+		}
+		q.KnowledgeBaseID = id
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return q, fmt.Errorf("limit must be a positive integer")
+		}
+		q.Limit = limit
+	}
+
+	var err error
+	if q.CreatedAfter, err = parseDate(values.Get("created_after")); err != nil {
+		return q, fmt.Errorf("created_after: %w", err)
+	}
+	if q.CreatedBefore, err = parseDate(values.Get("created_before")); err != nil {
+		return q, fmt.Errorf("created_before: %w", err)
+	}
+	return q, nil
+}
+
+func parseDate(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
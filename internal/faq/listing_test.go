@@ -0,0 +1,134 @@
+package faq_test
+
+import (
+	"context"
+	"encoding/json"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/faq"
+	"faq-search-ai/internal/model"
+	"faq-search-ai/internal/workspace"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHandleListFAQs_CursorPagination(t *testing.T) {
+	db := setupTestDB(t)
+
+	// 作成日時が同じ行もページをまたいで欠けないことを確認する
+	ws, _ := workspace.EnsurePersonal(db, 1)
+	other, _ := workspace.EnsurePersonal(db, 2)
+	for i, q := range []string{"e", "c", "a", "d", "b"} {
+		_, err := db.Exec(`INSERT INTO faqs (id, workspace_id, user_id, question, answer, status, created_at) VALUES (?, ?, 1, ?, 'x', ?, ?)`,
+			fmt.Sprintf("faq-%d", i), ws, q, model.StatusPublished, time.Date(2024, 1, 1+i/2, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatalf("failed to insert test data: %v", err)
+		}
+	}
+	db.Exec(`INSERT INTO faqs (id, workspace_id, user_id, question, answer) VALUES ('other', ?, 2, 'z', 'x')`, other)
+
+	handler := routes(db)
+	fetchAll := func(query url.Values) []string {
+		var got []string
+		cursor := ""
+		for page := 0; page < 10; page++ {
+			if cursor != "" {
+				query.Set("cursor", cursor)
+			}
+			req := httptest.NewRequest("GET", "/faqs?"+query.Encode(), nil)
+			req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if total := rr.Header().Get("X-Total-Count"); total != "5" {
+				t.Errorf("expected X-Total-Count 5, got %q", total)
+			}
+
+			var faqs []model.FAQ
+			json.NewDecoder(rr.Body).Decode(&faqs)
+			for _, f := range faqs {
+				got = append(got, f.Question)
+			}
+			cursor = rr.Header().Get("X-Next-Cursor")
+			if cursor == "" {
+				return got
+			}
+		}
+		t.Fatal("pagination did not terminate")
+		return nil
+	}
+
+	got := fetchAll(url.Values{"limit": {"2"}, "sort": {"question"}})
+	if fmt.Sprint(got) != "[a b c d e]" {
+		t.Errorf("unexpected order sorting by question: %v", got)
+	}
+
+	got = fetchAll(url.Values{"limit": {"2"}, "sort": {"created"}, "order": {"asc"}})
+	if len(got) != 5 {
+		t.Errorf("expected 5 faqs across pages, got %v", got)
+	}
+
+	req := httptest.NewRequest("GET", "/faqs?created_after=2024-01-02&created_before=2024-01-03", nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	var faqs []model.FAQ
+	json.NewDecoder(rr.Body).Decode(&faqs)
+	if len(faqs) != 2 {
+		t.Errorf("expected 2 faqs in date range, got %d", len(faqs))
+	}
+
+	for _, bad := range []string{"sort=answer", "order=up", "limit=0", "cursor=not-a-cursor", "status=archived"} {
+		req := httptest.NewRequest("GET", "/faqs?"+bad, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", bad, rr.Code)
+		}
+	}
+}
+
+func TestListFAQs_LegacyTimestampsSortChronologically(t *testing.T) {
+	db := setupTestDB(t)
+
+	// 旧バージョンはローカル時刻や CURRENT_TIMESTAMP の書式で保存していた
+	ws, _ := workspace.EnsurePersonal(db, 1)
+	for id, createdAt := range map[string]string{
+		"tokyo":   "2024-01-01 08:30:00+09:00",
+		"default": "2024-01-01 00:00:00",
+		"utc":     "2024-01-01 00:00:00.5+00:00",
+	} {
+		if _, err := db.Exec(`INSERT INTO faqs (id, workspace_id, user_id, question, answer, created_at) VALUES (?, ?, 1, ?, 'x', ?)`, id, ws, id, createdAt); err != nil {
+			t.Fatalf("failed to insert test data: %v", err)
+		}
+	}
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	var got []string
+	q := faq.ListQuery{Sort: "created", Limit: 1}
+	for page := 0; page < 5; page++ {
+		p, err := faq.ListFAQs(db, ws, q)
+		if err != nil {
+			t.Fatalf("ListFAQs failed: %v", err)
+		}
+		for _, f := range p.Items {
+			got = append(got, f.ID)
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		q.Cursor = p.NextCursor
+	}
+	if fmt.Sprint(got) != "[tokyo default utc]" {
+		t.Errorf("expected chronological order across pages, got %v", got)
+	}
+}
@@ -5,16 +5,20 @@ import (
 	"errors"
 	"faq-search-ai/internal/model"
 	"faq-search-ai/internal/vector"
-	"fmt"
+	"faq-search-ai/internal/workspace"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-func GetFAQsByUser(db *sql.DB, userID int64) ([]model.FAQ, error) {
+// GetFAQsByWorkspace は条件に合うFAQを作成日時の新しい順に全件返す
+func GetFAQsByWorkspace(db *sql.DB, workspaceID int64, filter ListFilter) ([]model.FAQ, error) {
+	where, args := filter.where(workspaceID)
 	rows, err := db.Query(`
-		SELECT id, user_id, question, answer, created_at, updated_at
-		FROM faqs WHERE user_id = ? ORDER BY created_at DESC`, userID)
+		SELECT id, workspace_id, user_id, knowledge_base_id, question, answer, category, status, version, created_at, updated_at
+		FROM faqs WHERE `+where+` ORDER BY created_at DESC`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -23,42 +27,147 @@ func GetFAQsByUser(db *sql.DB, userID int64) ([]model.FAQ, error) {
 	var faqs []model.FAQ
 	for rows.Next() {
 		var f model.FAQ
-		err := rows.Scan(&f.ID, &f.UserID, &f.Question, &f.Answer, &f.CreatedAt, &f.UpdatedAt)
+		err := rows.Scan(&f.ID, &f.WorkspaceID, &f.UserID, &f.KnowledgeBaseID, &f.Question, &f.Answer, &f.Category, &f.Status, &f.Version, &f.CreatedAt, &f.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
 		faqs = append(faqs, f)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
 	if faqs == nil {
 		faqs = []model.FAQ{}
 	}
+	if err := loadTags(db, faqs); err != nil {
+		return nil, err
+	}
 	return faqs, nil
 }
 
-func CreateFAQ(db *sql.DB, id string, userID int64, question, answer string) error {
-	now := time.Now()
-	_, err := db.Exec(`
-		INSERT INTO faqs (id, user_id, question, answer, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)`, id, userID, question, answer, now, now)
-	return err
+func CreateFAQ(db *sql.DB, f *model.FAQ) error {
+	now := time.Now().UTC()
+	if f.Status == "" {
+		f.Status = model.StatusDraft
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// ワークスペースの指定がなければ作成者の個人用、ナレッジベースの指定がなければ既定のものに入れる
+	if f.WorkspaceID == 0 {
+		if f.WorkspaceID, err = workspace.EnsurePersonal(tx, f.UserID); err != nil {
+			return err
+		}
+	}
+	if f.KnowledgeBaseID == 0 {
+		if f.KnowledgeBaseID, err = defaultKnowledgeBase(tx, f.WorkspaceID, f.UserID); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		INSERT INTO faqs (id, workspace_id, user_id, knowledge_base_id, question, answer, category, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, f.ID, f.WorkspaceID, f.UserID, f.KnowledgeBaseID, f.Question, f.Answer, f.Category, f.Status, now, now)
+	if err != nil {
+		return err
+	}
+	if err := replaceTags(tx, f.ID, f.Tags); err != nil {
+		return err
+	}
+	if err := recordRevision(tx, f, f.UserID, RevisionCreate, now); err != nil {
+		return err
+	}
+	if err := indexKeywords(tx, f); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	f.Version = 1
+	f.CreatedAt, f.UpdatedAt = now, now
+	return nil
 }
 
-func GetFAQByID(db *sql.DB, id string, userID int64) (*model.FAQ, error) {
+func GetFAQByID(db *sql.DB, id string, workspaceID int64) (*model.FAQ, error) {
 	var f model.FAQ
-	err := db.QueryRow(`SELECT id, user_id, question, answer FROM faqs WHERE id = ? AND user_id = ?`, id, userID).
-		Scan(&f.ID, &f.UserID, &f.Question, &f.Answer)
+	err := db.QueryRow(`
+		SELECT id, workspace_id, user_id, knowledge_base_id, question, answer, category, status, version, created_at, updated_at
+		FROM faqs WHERE id = ? AND workspace_id = ? AND deleted_at IS NULL`, id, workspaceID).
+		Scan(&f.ID, &f.WorkspaceID, &f.UserID, &f.KnowledgeBaseID, &f.Question, &f.Answer, &f.Category, &f.Status, &f.Version, &f.CreatedAt, &f.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &f, nil
+	faqs := []model.FAQ{f}
+	if err := loadTags(db, faqs); err != nil {
+		return nil, err
+	}
+	return &faqs[0], nil
+}
+
+// ErrVersionConflict は更新しようとしたFAQが読み込み後に他で変更されていたことを表す
+var ErrVersionConflict = errors.New("faq was modified by someone else")
+
+// UpdateFAQ は内容を更新し、authorID による変更としてリビジョンを残す。
+// faq.Version が0でなければ、現在のバージョンと一致する場合のみ更新する。
+// faq.KnowledgeBaseID が0なら所属するナレッジベースは変えない
+func UpdateFAQ(db *sql.DB, faq *model.FAQ, authorID int64) error {
+	return updateFAQ(db, faq, authorID, RevisionUpdate)
+}
+
+func updateFAQ(db *sql.DB, faq *model.FAQ, authorID int64, action string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateFAQTx(tx, faq, authorID, action); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// 2. 公開中ならQdrantを更新（再アップサート）
+	if faq.Status != model.StatusPublished {
+		return nil
+	}
+	return indexFAQ(faq)
 }
 
-func UpdateFAQ(db *sql.DB, faq *model.FAQ) error {
-	result, err := db.Exec(`UPDATE faqs SET question = ?, answer = ? WHERE id = ? AND user_id = ?`, faq.Question, faq.Answer, faq.ID, faq.UserID)
+// updateFAQTx は updateFAQ のDB更新部分。Qdrant への反映はコミット後に呼び出し側で行う
+func updateFAQTx(tx *sql.Tx, faq *model.FAQ, authorID int64, action string) error {
+	now := time.Now().UTC()
+	if err := ensureBaseRevision(tx, faq.ID, faq.WorkspaceID); err != nil {
+		return err
+	}
+	// 公開状態は更新では変えない
+	// 作成者も更新では変えない
+	var version, knowledgeBaseID int64
+	err := tx.QueryRow(`SELECT user_id, status, version, knowledge_base_id FROM faqs WHERE id = ? AND workspace_id = ? AND deleted_at IS NULL`, faq.ID, faq.WorkspaceID).
+		Scan(&faq.UserID, &faq.Status, &version, &knowledgeBaseID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("no rows updated")
+	}
+	if err != nil {
+		return err
+	}
+	if faq.Version != 0 && faq.Version != version {
+		return ErrVersionConflict
+	}
+	if faq.KnowledgeBaseID == 0 {
+		faq.KnowledgeBaseID = knowledgeBaseID
+	}
+
+	result, err := tx.Exec(`UPDATE faqs SET knowledge_base_id = ?, question = ?, answer = ?, category = ?, version = version + 1, updated_at = ? WHERE id = ? AND workspace_id = ? AND version = ? AND deleted_at IS NULL`,
+		faq.KnowledgeBaseID, faq.Question, faq.Answer, faq.Category, now, faq.ID, faq.WorkspaceID, version)
 	if err != nil {
 		return err
 	}
@@ -67,20 +176,31 @@ func UpdateFAQ(db *sql.DB, faq *model.FAQ) error {
 		return err
 	}
 	if affected == 0 {
-		return errors.New("no rows updated")
+		return ErrVersionConflict
 	}
-
-	// 2. Qdrantを更新（再アップサート）
-	vectorData, err := vector.GenerateEmbedding(faq.Question)
-	if err != nil {
+	if err := replaceTags(tx, faq.ID, faq.Tags); err != nil {
 		return err
 	}
-	return vector.UpsertToQdrant(faq.ID, faq.UserID, faq.Question, faq.Answer, vectorData)
+	if err := recordRevision(tx, faq, authorID, action, now); err != nil {
+		return err
+	}
+	if err := indexKeywords(tx, faq); err != nil {
+		return err
+	}
+	faq.Version = version + 1
+	faq.UpdatedAt = now
+	return nil
 }
 
-func DeleteFAQ(db *sql.DB, id string, userID int64) error {
-	// 1. DBから削除
-	result, err := db.Exec(`DELETE FROM faqs WHERE id = ? AND user_id = ?`, id, userID)
+// indexFAQ は質問をベクトル化してQdrantに登録する。公開中のFAQのみ対象にすること
+func indexFAQ(f *model.FAQ) error {
+	return vector.UpsertToQdrant(*f)
+}
+
+// DeleteFAQ はFAQをゴミ箱へ移す。検索対象から外すためQdrantからは削除する
+func DeleteFAQ(db *sql.DB, id string, workspaceID int64) error {
+	// 1. DBで削除済みにする
+	result, err := db.Exec(`UPDATE faqs SET deleted_at = ? WHERE id = ? AND workspace_id = ? AND deleted_at IS NULL`, time.Now().UTC(), id, workspaceID)
 	if err != nil {
 		return err
 	}
@@ -89,34 +209,159 @@ func DeleteFAQ(db *sql.DB, id string, userID int64) error {
 		return err
 	}
 	if affected == 0 {
-		return errors.New("no rows deleted")
+		return ErrFAQNotFound
 	}
 
-	// 2. Qdrantから削除
+	// 2. Qdrantから削除。失敗しても回答には使われない (FilterAnswerable) ので、ゴミ箱へは移したままにする
 	if err := vector.DeleteFromQdrant(id); err != nil {
-		return fmt.Errorf("deleted from DB but failed to delete from Qdrant: %w", err)
+		log.Printf("faq %s moved to trash but Qdrant deletion failed: %v", id, err)
 	}
 
 	return nil
 }
 
-func CreateFAQWithVector(db *sql.DB, userID int64, question, answer string) error {
+// FilterAnswerable はベクトル検索の結果から、ゴミ箱にあるか公開をやめたFAQを取り除く。
+// Qdrant からの削除に失敗して残った点を回答に使わないようにするため
+func FilterAnswerable(db *sql.DB, faqs []model.FAQ) ([]model.FAQ, error) {
+	if len(faqs) == 0 {
+		return faqs, nil
+	}
+	args := []interface{}{model.StatusPublished}
+	for _, f := range faqs {
+		args = append(args, f.ID)
+	}
+	rows, err := db.Query(`SELECT id FROM faqs WHERE status = ? AND deleted_at IS NULL AND id IN (?`+strings.Repeat(", ?", len(faqs)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	live := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		live[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	answerable := []model.FAQ{}
+	for _, f := range faqs {
+		if live[f.ID] {
+			answerable = append(answerable, f)
+		}
+	}
+	return answerable, nil
+}
+
+func CreateFAQWithVector(db *sql.DB, f *model.FAQ) error {
 	// 1. DBに登録
-	id := uuid.New().String()
-	if err := CreateFAQ(db, id, userID, question, answer); err != nil {
+	f.ID = uuid.New().String()
+	if err := CreateFAQ(db, f); err != nil {
 		return err
 	}
 
-	// 2. 質問をベクトル化
-	vectorData, err := vector.GenerateEmbedding(question)
-	if err != nil {
+	// 2. 公開する場合のみベクトル化してQdrantに登録
+	if f.Status != model.StatusPublished {
+		return nil
+	}
+	return indexFAQ(f)
+}
+
+// NormalizeTags は前後の空白を除き、空のタグと重複を取り除く
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+func replaceTags(tx *sql.Tx, faqID string, tags []string) error {
+	if _, err := tx.Exec(`DELETE FROM faq_tags WHERE faq_id = ?`, faqID); err != nil {
 		return err
 	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT INTO faq_tags (faq_id, tag) VALUES (?, ?)`, faqID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTags は faqs の各要素にタグを読み込む
+func loadTags(db *sql.DB, faqs []model.FAQ) error {
+	if len(faqs) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(faqs))
+	placeholders := make([]string, len(faqs))
+	args := make([]interface{}, len(faqs))
+	for i := range faqs {
+		faqs[i].Tags = []string{}
+		index[faqs[i].ID] = i
+		placeholders[i] = "?"
+		args[i] = faqs[i].ID
+	}
 
-	// 3. Qdrantに登録
-	if err := vector.UpsertToQdrant(id, userID, question, answer, vectorData); err != nil {
+	rows, err := db.Query(`SELECT faq_id, tag FROM faq_tags WHERE faq_id IN (`+strings.Join(placeholders, ",")+`) ORDER BY tag`, args...)
+	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	return nil
+	for rows.Next() {
+		var faqID, tag string
+		if err := rows.Scan(&faqID, &tag); err != nil {
+			return err
+		}
+		i := index[faqID]
+		faqs[i].Tags = append(faqs[i].Tags, tag)
+	}
+	return rows.Err()
+}
+
+// ReindexSource はQdrantコレクション再構築のために全FAQを順に渡す
+func ReindexSource(db *sql.DB) vector.FAQSource {
+	return func(fn func(f model.FAQ) error) error {
+		rows, err := db.Query(`
+			SELECT id, workspace_id, user_id, knowledge_base_id, question, answer, category, status FROM faqs
+			WHERE status = ? AND deleted_at IS NULL ORDER BY created_at`, model.StatusPublished)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var faqs []model.FAQ
+		for rows.Next() {
+			var f model.FAQ
+			if err := rows.Scan(&f.ID, &f.WorkspaceID, &f.UserID, &f.KnowledgeBaseID, &f.Question, &f.Answer, &f.Category, &f.Status); err != nil {
+				return err
+			}
+			faqs = append(faqs, f)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		if err := loadTags(db, faqs); err != nil {
+			return err
+		}
+
+		// 埋め込みAPI呼び出し中に接続を掴み続けないよう、読み込み後に処理する
+		for _, f := range faqs {
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 }
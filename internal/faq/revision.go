@@ -0,0 +1,150 @@
+package faq
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/model"
+	"time"
+)
+
+const (
+	RevisionCreate = "create"
+	RevisionUpdate = "update"
+	RevisionRevert = "revert"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// recordRevision は tx 内で faq の現在の内容を新しいリビジョンとして保存する
+func recordRevision(tx *sql.Tx, f *model.FAQ, authorID int64, action string, at time.Time) error {
+	tags, err := json.Marshal(nonNilTags(f.Tags))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO faq_revisions (faq_id, revision, author_id, action, question, answer, category, tags, created_at)
+		SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ?, ?, ?, ?
+		FROM faq_revisions WHERE faq_id = ?`,
+		f.ID, authorID, action, f.Question, f.Answer, f.Category, string(tags), at, f.ID)
+	return err
+}
+
+// ensureBaseRevision は履歴導入前に作られたFAQの現在の内容を最初のリビジョンとして残す
+func ensureBaseRevision(tx *sql.Tx, faqID string, workspaceID int64) error {
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM faq_revisions WHERE faq_id = ?`, faqID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var f model.FAQ
+	var updatedAt time.Time
+	err := tx.QueryRow(`SELECT id, user_id, question, answer, category, updated_at FROM faqs WHERE id = ? AND workspace_id = ?`, faqID, workspaceID).
+		Scan(&f.ID, &f.UserID, &f.Question, &f.Answer, &f.Category, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT tag FROM faq_tags WHERE faq_id = ? ORDER BY tag`, faqID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return err
+		}
+		f.Tags = append(f.Tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	return recordRevision(tx, &f, f.UserID, RevisionCreate, updatedAt)
+}
+
+// GetRevisions は新しい順にリビジョンを返す
+func GetRevisions(db *sql.DB, faqID string) ([]model.FAQRevision, error) {
+	rows, err := db.Query(`
+		SELECT faq_id, revision, author_id, action, question, answer, category, tags, created_at
+		FROM faq_revisions WHERE faq_id = ? ORDER BY revision DESC`, faqID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []model.FAQRevision{}
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *rev)
+	}
+	return revisions, rows.Err()
+}
+
+func GetRevision(db *sql.DB, faqID string, revision int) (*model.FAQRevision, error) {
+	row := db.QueryRow(`
+		SELECT faq_id, revision, author_id, action, question, answer, category, tags, created_at
+		FROM faq_revisions WHERE faq_id = ? AND revision = ?`, faqID, revision)
+	rev, err := scanRevision(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRevisionNotFound
+	}
+	return rev, err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRevision(row rowScanner) (*model.FAQRevision, error) {
+	var rev model.FAQRevision
+	var tags string
+	if err := row.Scan(&rev.FAQID, &rev.Revision, &rev.AuthorID, &rev.Action, &rev.Question, &rev.Answer, &rev.Category, &tags, &rev.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(tags), &rev.Tags); err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// RevertFAQ はリビジョンの内容でFAQを更新し、authorID による変更として再度ベクトル化する。
+// version が0でなければ、現在のバージョンと一致する場合のみ更新する
+func RevertFAQ(db *sql.DB, faqID string, workspaceID, authorID int64, revision int, version int64) (*model.FAQ, error) {
+	rev, err := GetRevision(db, faqID, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &model.FAQ{
+		ID:          faqID,
+		WorkspaceID: workspaceID,
+		Question:    rev.Question,
+		Answer:      rev.Answer,
+		Category:    rev.Category,
+		Tags:        rev.Tags,
+		Version:     version,
+	}
+	if err := updateFAQ(db, f, authorID, RevisionRevert); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
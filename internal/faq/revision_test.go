@@ -0,0 +1,133 @@
+package faq_test
+
+import (
+	"context"
+	"encoding/json"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/faq"
+	"faq-search-ai/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleDiffRevisions(t *testing.T) {
+	db := setupTestDB(t)
+
+	f := &model.FAQ{ID: "faq-1", UserID: 1, Question: "営業時間は？", Answer: "平日9時から\n18時までです。", Tags: []string{"hours"}}
+	if err := faq.CreateFAQ(db, f); err != nil {
+		t.Fatalf("failed to create faq: %v", err)
+	}
+	_, err := db.Exec(`INSERT INTO faq_revisions (faq_id, revision, author_id, action, question, answer, category, tags)
+		VALUES ('faq-1', 2, 1, 'update', '営業時間は？', '平日9時から
+17時までです。', 'support', '["hours","contact"]')`)
+	if err != nil {
+		t.Fatalf("failed to insert revision: %v", err)
+	}
+
+	handler := routes(db)
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/faqs/faq-1/revisions")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var revisions []model.FAQRevision
+	json.NewDecoder(rr.Body).Decode(&revisions)
+	if len(revisions) != 2 || revisions[0].Revision != 2 {
+		t.Fatalf("expected 2 revisions newest first, got %+v", revisions)
+	}
+
+	rr = get("/faqs/faq-1/revisions/diff?from=1&to=2")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var diff faq.RevisionDiff
+	json.NewDecoder(rr.Body).Decode(&diff)
+	want := []faq.DiffOp{
+		{Op: faq.DiffEqual, Text: "平日9時から"},
+		{Op: faq.DiffDelete, Text: "18時までです。"},
+		{Op: faq.DiffInsert, Text: "17時までです。"},
+	}
+	if len(diff.Answer) != len(want) {
+		t.Fatalf("unexpected answer diff: %+v", diff.Answer)
+	}
+	for i := range want {
+		if diff.Answer[i] != want[i] {
+			t.Errorf("answer diff[%d] = %+v, want %+v", i, diff.Answer[i], want[i])
+		}
+	}
+	if diff.Category == nil || diff.Category.To != "support" {
+		t.Errorf("expected category change, got %+v", diff.Category)
+	}
+	if len(diff.Tags.Added) != 1 || diff.Tags.Added[0] != "contact" {
+		t.Errorf("expected contact tag added, got %+v", diff.Tags)
+	}
+
+	if rr := get("/faqs/faq-1/revisions/diff?from=1&to=9"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown revision, got %d", rr.Code)
+	}
+
+	// 他ユーザーのFAQの履歴は見えない
+	req := httptest.NewRequest("GET", "/faqs/faq-1/revisions", nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(2)))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's FAQ, got %d", rr.Code)
+	}
+}
+
+func TestHandleRevertFAQ_Preconditions(t *testing.T) {
+	db := setupTestDB(t)
+	prev := config.RequireReview
+	config.RequireReview = true
+	t.Cleanup(func() { config.RequireReview = prev })
+
+	for _, f := range []*model.FAQ{
+		{ID: "draft", UserID: 1, Question: "Q1", Answer: "A1", Status: model.StatusDraft},
+		{ID: "live", UserID: 1, Question: "Q1", Answer: "A1", Status: model.StatusPublished},
+	} {
+		if err := faq.CreateFAQ(db, f); err != nil {
+			t.Fatalf("failed to create faq: %v", err)
+		}
+	}
+	if err := faq.UpdateFAQ(db, &model.FAQ{ID: "draft", WorkspaceID: 1, Question: "Q2", Answer: "A2"}, 1); err != nil {
+		t.Fatalf("failed to update faq: %v", err)
+	}
+
+	revert := func(id, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/faqs/"+id+"/revisions/1/revert", nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		routes(db).ServeHTTP(rr, req)
+		return rr
+	}
+
+	// レビュー必須なら公開版は戻せない
+	if rr := revert("live", ""); rr.Code != http.StatusConflict {
+		t.Errorf("published with review: expected 409, got %d", rr.Code)
+	}
+	stale, _ := faq.GetFAQByID(db, "draft", 1)
+	staleTag := faq.ETag(stale)
+	stale.Version--
+	if rr := revert("draft", faq.ETag(stale)); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: expected 412, got %d", rr.Code)
+	}
+	rr := revert("draft", staleTag)
+	var reverted model.FAQ
+	json.NewDecoder(rr.Body).Decode(&reverted)
+	if rr.Code != http.StatusOK || reverted.Question != "Q1" {
+		t.Errorf("matching If-Match: expected revert to Q1, got %d %+v", rr.Code, reverted)
+	}
+}
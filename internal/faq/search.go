@@ -0,0 +1,302 @@
+package faq
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"faq-search-ai/internal/analysis"
+	"faq-search-ai/internal/model"
+	"html"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+
+	// maxSearchCandidates はスコアを計算する候補の上限。よく使われる語でも全件を読み込まないようにする
+	maxSearchCandidates = 1000
+
+	// snippetRunes はスニペットとして返す前後の文字数の目安
+	snippetRunes = 60
+)
+
+// 質問のヒットを回答より重く扱う。先頭の faq_id は索引に含めない
+var columnWeights = []float64{0, 2.0, 1.0}
+
+// SearchHit はキーワード検索の1件。Snippets はヒット箇所を <mark> で囲んだHTML
+type SearchHit struct {
+	FAQ      model.FAQ         `json:"faq"`
+	Score    float64           `json:"score"`
+	Snippets map[string]string `json:"snippets"`
+}
+
+// keywordIndexVersion は索引の作り方を変えたら上げる。起動時に作り直される
+const keywordIndexVersion = 3
+
+// indexKeywords は全文検索インデックスのFAQの行を書き換える。
+// 日本語は分かち書きできないため、形態素解析した語を空白区切りで格納する
+func indexKeywords(tx *sql.Tx, f *model.FAQ) error {
+	if err := unindexKeywords(tx, f.ID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`INSERT INTO faqs_fts (faq_id, question, answer) VALUES (?, ?, ?)`,
+		f.ID, analysis.IndexText(f.Question), analysis.IndexText(f.Answer))
+	return err
+}
+
+func unindexKeywords(tx *sql.Tx, id string) error {
+	_, err := tx.Exec(`DELETE FROM faqs_fts WHERE faq_id = ?`, id)
+	return err
+}
+
+// EnsureKeywordIndex はインデックスがFAQ件数と食い違っているか、存在しないFAQの行を含むか、
+// 古い作り方のままであれば作り直す
+func EnsureKeywordIndex(db *sql.DB) error {
+	var faqs, indexed, version int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM faqs`).Scan(&faqs); err != nil {
+		return err
+	}
+	if err := db.QueryRow(`
+		SELECT CASE WHEN COUNT(faqs.id) = COUNT(*) THEN COUNT(*) ELSE -1 END
+		FROM faqs_fts LEFT JOIN faqs ON faqs.id = faqs_fts.faq_id`).Scan(&indexed); err != nil {
+		return err
+	}
+	err := db.QueryRow(`SELECT version FROM index_versions WHERE name = 'faqs_fts'`).Scan(&version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if faqs == indexed && version == keywordIndexVersion {
+		return nil
+	}
+	log.Printf("rebuilding keyword index (%d FAQs, %d indexed, version %d)", faqs, indexed, version)
+	return RebuildKeywordIndex(db)
+}
+
+func RebuildKeywordIndex(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, question, answer FROM faqs`)
+	if err != nil {
+		return err
+	}
+	var faqs []model.FAQ
+	for rows.Next() {
+		var f model.FAQ
+		if err := rows.Scan(&f.ID, &f.Question, &f.Answer); err != nil {
+			rows.Close()
+			return err
+		}
+		faqs = append(faqs, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM faqs_fts`); err != nil {
+		return err
+	}
+	for i := range faqs {
+		if err := indexKeywords(tx, &faqs[i]); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO index_versions (name, version) VALUES ('faqs_fts', ?)
+		ON CONFLICT(name) DO UPDATE SET version = excluded.version`, keywordIndexVersion); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// searchTerms はクエリを索引と同じ方法で解析し、重複を除いた検索語を返す
+func searchTerms(q string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, t := range analysis.Terms(q) {
+		// MATCH 構文として解釈される記号を含めない
+		t = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsNumber(r) {
+				return r
+			}
+			return -1
+		}, t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		terms = append(terms, t)
+	}
+	return terms
+}
+
+// matchExpression は検索語を全て含む行に一致するFTSのMATCH式を作る。
+// 入力途中の語でも引けるよう最後の語だけ前方一致にする
+func matchExpression(terms []string) string {
+	return strings.Join(terms, " ") + "*"
+}
+
+// SearchFAQs はキーワードで質問・回答を全文検索し、スコア順に返す
+func SearchFAQs(db *sql.DB, workspaceID int64, query string, filter ListFilter, limit int) ([]SearchHit, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []SearchHit{}, nil
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	// FTS4 は SQL でスコア順に並べられないため、候補は更新の新しい順に上限まで取ってから並べ替える
+	where, args := filter.where(workspaceID)
+	args = append([]interface{}{matchExpression(terms)}, args...)
+	args = append(args, maxSearchCandidates)
+	rows, err := db.Query(`
+		SELECT faqs.id, faqs.workspace_id, faqs.user_id, faqs.knowledge_base_id, faqs.question, faqs.answer, faqs.category, faqs.status, faqs.version,
+			faqs.created_at, faqs.updated_at, matchinfo(faqs_fts, 'pcnalx')
+		FROM faqs_fts JOIN faqs ON faqs.id = faqs_fts.faq_id
+		WHERE faqs_fts MATCH ? AND `+where+`
+		ORDER BY faqs.updated_at DESC, faqs.id
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		var h SearchHit
+		var info []byte
+		if err := rows.Scan(&h.FAQ.ID, &h.FAQ.WorkspaceID, &h.FAQ.UserID, &h.FAQ.KnowledgeBaseID, &h.FAQ.Question, &h.FAQ.Answer, &h.FAQ.Category, &h.FAQ.Status, &h.FAQ.Version, &h.FAQ.CreatedAt, &h.FAQ.UpdatedAt, &info); err != nil {
+			return nil, err
+		}
+		h.Score = bm25(info)
+		hits = append(hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	faqs := make([]model.FAQ, len(hits))
+	for i := range hits {
+		faqs[i] = hits[i].FAQ
+	}
+	if err := loadTags(db, faqs); err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		hits[i].FAQ = faqs[i]
+		hits[i].Snippets = map[string]string{
+			"question": highlight(hits[i].FAQ.Question, terms),
+			"answer":   highlight(hits[i].FAQ.Answer, terms),
+		}
+	}
+	return hits, nil
+}
+
+// bm25 は matchinfo(..., 'pcnalx') の結果からOkapi BM25スコアを計算する
+func bm25(info []byte) float64 {
+	const k1, b = 1.2, 0.75
+
+	v := make([]uint32, len(info)/4)
+	for i := range v {
+		v[i] = binary.NativeEndian.Uint32(info[i*4:])
+	}
+	if len(v) < 3 {
+		return 0
+	}
+	p, c, n := int(v[0]), int(v[1]), float64(v[2])
+	avg := v[3 : 3+c]
+	length := v[3+c : 3+2*c]
+	x := v[3+2*c:]
+
+	score := 0.0
+	for i := 0; i < p; i++ {
+		for j := 0; j < c; j++ {
+			k := 3 * (i*c + j)
+			hits, docs := float64(x[k]), float64(x[k+2])
+			if hits == 0 {
+				continue
+			}
+			idf := math.Log((n-docs+0.5)/(docs+0.5) + 1)
+			norm := 1 - b + b*float64(length[j])/math.Max(float64(avg[j]), 1)
+			weight := 1.0
+			if j < len(columnWeights) {
+				weight = columnWeights[j]
+			}
+			score += weight * idf * hits * (k1 + 1) / (hits + k1*norm)
+		}
+	}
+	return score
+}
+
+// highlight は最初のヒット箇所の前後を切り出し、検索語に当たる語を <mark> で囲む。
+// 原文を解析して語の位置を求めるので、活用形や全角・半角の違いがあっても強調できる。
+// ヒットが無ければ先頭から切り出す
+func highlight(text string, terms []string) string {
+	runes := []rune(text)
+	want := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		want[t] = true
+	}
+	last := ""
+	if len(terms) > 0 {
+		last = terms[len(terms)-1]
+	}
+
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, tok := range analysis.Analyze(text) {
+		if !want[tok.Term] && !strings.HasPrefix(tok.Term, last) {
+			continue
+		}
+		for k := tok.Start; k < tok.End && k < len(runes); k++ {
+			marked[k] = true
+		}
+		if first < 0 || tok.Start < first {
+			first = tok.Start
+		}
+	}
+
+	start, end := 0, len(runes)
+	if first > snippetRunes/2 {
+		start = first - snippetRunes/2
+	}
+	if end-start > snippetRunes*2 {
+		end = start + snippetRunes*2
+	}
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if marked[i] && (i == start || !marked[i-1]) {
+			sb.WriteString("<mark>")
+		}
+		sb.WriteString(html.EscapeString(string(runes[i])))
+		if marked[i] && (i == end-1 || !marked[i+1]) {
+			sb.WriteString("</mark>")
+		}
+	}
+	if end < len(runes) {
+		sb.WriteString("…")
+	}
+	return sb.String()
+}
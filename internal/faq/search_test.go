@@ -0,0 +1,161 @@
+package faq_test
+
+import (
+	"context"
+	"encoding/json"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/faq"
+	"faq-search-ai/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleSearchFAQ(t *testing.T) {
+	db := setupTestDB(t)
+
+	for _, f := range []model.FAQ{
+		{ID: "faq-1", UserID: 1, Question: "How do I reset my password?", Answer: "Use the reset link on the sign in page."},
+		{ID: "faq-2", UserID: 1, Question: "Which plans are available?", Answer: "Free and Pro. You can reset your plan anytime."},
+		{ID: "faq-3", UserID: 1, Question: "Where is the <b>office</b>?", Answer: "Tokyo."},
+		{ID: "faq-4", UserID: 2, Question: "How do I reset my password?", Answer: "Other tenant."},
+	} {
+		f := f
+		if err := faq.CreateFAQ(db, &f); err != nil {
+			t.Fatalf("failed to create faq: %v", err)
+		}
+	}
+
+	search := func(query string) []faq.SearchHit {
+		req := httptest.NewRequest("GET", "/faqs/search?"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		rr := httptest.NewRecorder()
+		faq.HandleSearchFAQ(db).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var hits []faq.SearchHit
+		json.NewDecoder(rr.Body).Decode(&hits)
+		return hits
+	}
+
+	hits := search("q=reset")
+	if len(hits) != 2 {
+		t.Fatalf("expected 2 hits for own FAQs, got %d", len(hits))
+	}
+	// 質問でヒットした方を上位にする
+	if hits[0].FAQ.ID != "faq-1" {
+		t.Errorf("expected question hit ranked first, got %s", hits[0].FAQ.ID)
+	}
+	if !strings.Contains(hits[0].Snippets["question"], "<mark>reset</mark>") {
+		t.Errorf("expected highlighted snippet, got %q", hits[0].Snippets["question"])
+	}
+
+	if hits := search("q=pass"); len(hits) != 1 {
+		t.Errorf("expected prefix match on pass, got %d hits", len(hits))
+	}
+	if hits := search("q=reset+plan"); len(hits) != 1 || hits[0].FAQ.ID != "faq-2" {
+		t.Errorf("expected all terms to be required, got %+v", hits)
+	}
+
+	hits = search("q=office")
+	if len(hits) != 1 || strings.Contains(hits[0].Snippets["question"], "<b>") {
+		t.Errorf("expected escaped snippet, got %+v", hits)
+	}
+
+	// 削除済みは検索対象外
+	db.Exec(`UPDATE faqs SET deleted_at = CURRENT_TIMESTAMP WHERE id = 'faq-1'`)
+	if hits := search("q=password"); len(hits) != 0 {
+		t.Errorf("expected trashed faq to be excluded, got %d hits", len(hits))
+	}
+
+	// q が無いときと、一覧用の並び替えやページングの指定は 400 にする
+	for _, query := range []string{"", "q=reset&sort=updated", "q=reset&order=asc", "q=reset&cursor=abc"} {
+		req := httptest.NewRequest("GET", "/faqs/search?"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		rr := httptest.NewRecorder()
+		faq.HandleSearchFAQ(db).ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestSearchFAQsJapanese(t *testing.T) {
+	db := setupTestDB(t)
+
+	for _, f := range []model.FAQ{
+		{ID: "faq-1", UserID: 1, Question: "ﾊﾟｽﾜｰﾄﾞを忘れた場合は？", Answer: "ログイン画面の「再設定」から変更できます。"},
+		{ID: "faq-2", UserID: 1, Question: "料金プランを教えてください", Answer: "無料プランと有料プランがあります。"},
+	} {
+		f := f
+		if err := faq.CreateFAQ(db, &f); err != nil {
+			t.Fatalf("failed to create faq: %v", err)
+		}
+	}
+
+	// 全角・半角の違いと活用形の違いを吸収する
+	hits, err := faq.SearchFAQs(db, 1, "パスワードを忘れました", faq.ListFilter{}, 0)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(hits) != 1 || hits[0].FAQ.ID != "faq-1" {
+		t.Fatalf("expected faq-1, got %+v", hits)
+	}
+	if !strings.Contains(hits[0].Snippets["question"], "<mark>ﾊﾟｽﾜｰﾄﾞ</mark>") {
+		t.Errorf("expected original text highlighted, got %q", hits[0].Snippets["question"])
+	}
+
+	// 助詞だけのクエリでは何も返さない
+	if hits, _ := faq.SearchFAQs(db, 1, "を", faq.ListFilter{}, 0); len(hits) != 0 {
+		t.Errorf("expected no hits for particle only query, got %d", len(hits))
+	}
+}
+
+func TestEnsureKeywordIndexRebuildsOldIndex(t *testing.T) {
+	db := setupTestDB(t)
+
+	f := model.FAQ{ID: "faq-1", UserID: 1, Question: "料金プランを教えてください", Answer: "無料です。"}
+	if err := faq.CreateFAQ(db, &f); err != nil {
+		t.Fatalf("failed to create faq: %v", err)
+	}
+	// 解析前の原文のまま登録されていた索引を再現する
+	db.Exec(`UPDATE faqs_fts SET question = '料金プランを教えてください'`)
+	db.Exec(`DELETE FROM index_versions`)
+
+	if err := faq.EnsureKeywordIndex(db); err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+	hits, err := faq.SearchFAQs(db, 1, "プラン", faq.ListFilter{}, 0)
+	if err != nil || len(hits) != 1 {
+		t.Errorf("expected rebuilt index to match, got %d hits (%v)", len(hits), err)
+	}
+}
+
+func TestKeywordIndexSurvivesRowidChanges(t *testing.T) {
+	db := setupTestDB(t)
+	for _, f := range []model.FAQ{
+		{ID: "faq-1", UserID: 1, Question: "料金プランを教えてください", Answer: "無料です。"},
+		{ID: "faq-2", UserID: 1, Question: "パスワードを忘れました", Answer: "再設定してください。"},
+	} {
+		if err := faq.CreateFAQ(db, &f); err != nil {
+			t.Fatalf("failed to create faq: %v", err)
+		}
+	}
+	// VACUUM で rowid が振り直された状態を再現する
+	if _, err := db.Exec(`UPDATE faqs SET rowid = CASE id WHEN 'faq-1' THEN 200 ELSE 100 END`); err != nil {
+		t.Fatal(err)
+	}
+	if err := faq.EnsureKeywordIndex(db); err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+
+	hits, err := faq.SearchFAQs(db, 1, "プラン", faq.ListFilter{}, 0)
+	if err != nil || len(hits) != 1 || hits[0].FAQ.ID != "faq-1" {
+		t.Fatalf("expected faq-1, got %+v (%v)", hits, err)
+	}
+	if hits, _ := faq.SearchFAQs(db, 1, "パスワード", faq.ListFilter{}, 0); len(hits) != 1 || hits[0].FAQ.ID != "faq-2" {
+		t.Errorf("expected faq-2, got %+v", hits)
+	}
+}
@@ -0,0 +1,189 @@
+package faq
+
+import (
+	"database/sql"
+	"errors"
+	"faq-search-ai/internal/model"
+	"faq-search-ai/internal/vector"
+	"fmt"
+	"log"
+	"time"
+)
+
+var ErrNotInTrash = errors.New("faq not in trash")
+
+// GetTrashedFAQs は削除日時の新しい順にゴミ箱内のFAQを返す
+func GetTrashedFAQs(db *sql.DB, workspaceID int64) ([]model.FAQ, error) {
+	rows, err := db.Query(`
+		SELECT id, workspace_id, user_id, knowledge_base_id, question, answer, category, status, version, created_at, updated_at, deleted_at
+		FROM faqs WHERE workspace_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	faqs := []model.FAQ{}
+	for rows.Next() {
+		var f model.FAQ
+		var deletedAt time.Time
+		if err := rows.Scan(&f.ID, &f.WorkspaceID, &f.UserID, &f.KnowledgeBaseID, &f.Question, &f.Answer, &f.Category, &f.Status, &f.Version, &f.CreatedAt, &f.UpdatedAt, &deletedAt); err != nil {
+			return nil, err
+		}
+		f.DeletedAt = &deletedAt
+		faqs = append(faqs, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := loadTags(db, faqs); err != nil {
+		return nil, err
+	}
+	return faqs, nil
+}
+
+// RestoreFAQ はゴミ箱からFAQを戻し、公開中であれば再びQdrantに登録する
+func RestoreFAQ(db *sql.DB, id string, workspaceID int64) (*model.FAQ, error) {
+	result, err := db.Exec(`UPDATE faqs SET deleted_at = NULL WHERE id = ? AND workspace_id = ? AND deleted_at IS NOT NULL`, id, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrNotInTrash
+	}
+
+	f, err := GetFAQByID(db, id, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if f.Status == model.StatusPublished {
+		if err := indexFAQ(f); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// PurgeFAQ はゴミ箱内のFAQを完全に削除する
+func PurgeFAQ(db *sql.DB, id string, workspaceID int64) error {
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM faqs WHERE id = ? AND workspace_id = ? AND deleted_at IS NOT NULL)`, id, workspaceID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotInTrash
+	}
+	// 先にQdrantに残った点を消す。失敗したらFAQを残し、やり直せるようにする
+	if err := vector.DeleteFromQdrant(id); err != nil {
+		return fmt.Errorf("failed to delete from Qdrant: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	purged, err := purgeFAQ(tx, id, "workspace_id = ? AND deleted_at IS NOT NULL", workspaceID)
+	if err != nil {
+		return err
+	}
+	if !purged {
+		return ErrNotInTrash
+	}
+	return tx.Commit()
+}
+
+// PurgeExpiredFAQs は before より前に削除されたFAQを完全に削除し、件数を返す
+func PurgeExpiredFAQs(db *sql.DB, before time.Time) (int, error) {
+	rows, err := db.Query(`SELECT id FROM faqs WHERE deleted_at IS NOT NULL AND deleted_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := vector.DeletePointsFromQdrant(ids); err != nil {
+		return 0, fmt.Errorf("failed to delete from Qdrant: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	n := 0
+	for _, id := range ids {
+		// 一覧を読んでから元に戻されたFAQは残す
+		purged, err := purgeFAQ(tx, id, "deleted_at IS NOT NULL AND deleted_at < ?", before)
+		if err != nil {
+			return 0, err
+		}
+		if purged {
+			n++
+		}
+	}
+	return n, tx.Commit()
+}
+
+// StartTrashSweeper は interval ごとに保持期間を過ぎたFAQを削除する
+func StartTrashSweeper(db *sql.DB, retention, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			n, err := PurgeExpiredFAQs(db, time.Now().UTC().Add(-retention))
+			if err != nil {
+				log.Printf("trash sweep failed: %v", err)
+			} else if n > 0 {
+				log.Printf("trash sweep purged %d FAQs", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// purgeFAQ はFAQと関連する行を完全に削除する。cond を指定すると、FAQがその条件を満たすときだけ削除し、
+// 削除したかどうかを返す
+func purgeFAQ(tx *sql.Tx, id string, cond string, args ...interface{}) (bool, error) {
+	where := "id = ?"
+	if cond != "" {
+		where += " AND " + cond
+	}
+	result, err := tx.Exec(`DELETE FROM faqs WHERE `+where, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := unindexKeywords(tx, id); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM faq_tags WHERE faq_id = ?`, id); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM faq_revisions WHERE faq_id = ?`, id); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM faq_drafts WHERE faq_id = ?`, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,180 @@
+package faq_test
+
+import (
+	"context"
+	"encoding/json"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/faq"
+	"faq-search-ai/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubQdrant は Qdrant を差し替え、削除を頼まれた点のIDを返す関数を返す
+func stubQdrant(t *testing.T) func() []string {
+	var mu sync.Mutex
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/points/delete") {
+			var body struct {
+				Points []string `json:"points"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			deleted = append(deleted, body.Points...)
+			mu.Unlock()
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	old := config.QdrantURL
+	config.QdrantURL = server.URL
+	t.Cleanup(func() {
+		config.QdrantURL = old
+		server.Close()
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), deleted...)
+	}
+}
+
+func TestTrash_ListAndPurge(t *testing.T) {
+	db := setupTestDB(t)
+	deleted := stubQdrant(t)
+
+	for _, id := range []string{"live", "old", "recent"} {
+		if err := faq.CreateFAQ(db, &model.FAQ{ID: id, UserID: 1, Question: id, Answer: id}); err != nil {
+			t.Fatalf("failed to create faq: %v", err)
+		}
+	}
+	now := time.Now()
+	db.Exec(`UPDATE faqs SET deleted_at = ? WHERE id = 'old'`, now.Add(-40*24*time.Hour))
+	db.Exec(`UPDATE faqs SET deleted_at = ? WHERE id = 'recent'`, now.Add(-time.Hour))
+
+	withUser := func(req *http.Request) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+	}
+
+	// 一覧からはゴミ箱内のFAQが除かれる
+	rr := httptest.NewRecorder()
+	routes(db).ServeHTTP(rr, withUser(httptest.NewRequest("GET", "/faqs", nil)))
+	var faqs []model.FAQ
+	json.NewDecoder(rr.Body).Decode(&faqs)
+	if len(faqs) != 1 || faqs[0].ID != "live" {
+		t.Fatalf("expected only live faq in listing, got %+v", faqs)
+	}
+
+	trash := routes(db)
+	rr = httptest.NewRecorder()
+	trash.ServeHTTP(rr, withUser(httptest.NewRequest("GET", "/trash", nil)))
+	faqs = nil
+	json.NewDecoder(rr.Body).Decode(&faqs)
+	if len(faqs) != 2 || faqs[0].ID != "recent" || faqs[0].DeletedAt == nil {
+		t.Fatalf("expected recent and old in trash, got %+v", faqs)
+	}
+
+	n, err := faq.PurgeExpiredFAQs(db, now.Add(-30*24*time.Hour))
+	if err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 purged faq, got %d", n)
+	}
+
+	rr = httptest.NewRecorder()
+	trash.ServeHTTP(rr, withUser(httptest.NewRequest("DELETE", "/trash/recent", nil)))
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	trash.ServeHTTP(rr, withUser(httptest.NewRequest("DELETE", "/trash/live", nil)))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 purging a live faq, got %d", rr.Code)
+	}
+	// 完全に削除したFAQだけQdrantからも消す
+	if got := deleted(); !reflect.DeepEqual(got, []string{"old", "recent"}) {
+		t.Errorf("expected old and recent removed from Qdrant, got %v", got)
+	}
+
+	var remaining int
+	db.QueryRow(`SELECT COUNT(*) FROM faqs`).Scan(&remaining)
+	if remaining != 1 {
+		t.Errorf("expected 1 faq left, got %d", remaining)
+	}
+}
+
+func TestHandleDeleteFAQ_NotFound(t *testing.T) {
+	db := setupTestDB(t)
+	stubQdrant(t)
+
+	if err := faq.CreateFAQ(db, &model.FAQ{ID: "faq-1", UserID: 1, Question: "Q", Answer: "A"}); err != nil {
+		t.Fatalf("failed to create faq: %v", err)
+	}
+	for _, tt := range []struct {
+		id   string
+		want int
+	}{
+		{"faq-1", http.StatusNoContent},
+		{"faq-1", http.StatusNotFound}, // すでにゴミ箱にある
+		{"missing", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest("DELETE", "/faqs/"+tt.id, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		rr := httptest.NewRecorder()
+		routes(db).ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("DELETE /faqs/%s: expected %d, got %d", tt.id, tt.want, rr.Code)
+		}
+	}
+}
+
+func TestHandleRestoreFAQ_Audited(t *testing.T) {
+	db := setupTestDB(t)
+
+	if err := faq.CreateFAQ(db, &model.FAQ{ID: "faq-1", UserID: 1, Question: "Q", Answer: "A"}); err != nil {
+		t.Fatalf("failed to create faq: %v", err)
+	}
+	db.Exec(`UPDATE faqs SET deleted_at = ? WHERE id = 'faq-1'`, time.Now())
+
+	req := httptest.NewRequest("POST", "/trash/faq-1/restore", nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+	rr := httptest.NewRecorder()
+	routes(db).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	events, err := audit.List(db, audit.Filter{Actions: []string{audit.ActionFAQRestored}, TargetID: "faq-1"}, 0, 0)
+	if err != nil || len(events) != 1 || events[0].ActorID != 1 {
+		t.Errorf("expected one audited restore by user 1, got %+v (%v)", events, err)
+	}
+}
+
+func TestFilterAnswerable(t *testing.T) {
+	db := setupTestDB(t)
+	for _, f := range []model.FAQ{
+		{ID: "live", UserID: 1, Question: "q", Answer: "a", Status: model.StatusPublished},
+		{ID: "trashed", UserID: 1, Question: "q", Answer: "a", Status: model.StatusPublished},
+		{ID: "draft", UserID: 1, Question: "q", Answer: "a", Status: model.StatusDraft},
+	} {
+		if err := faq.CreateFAQ(db, &f); err != nil {
+			t.Fatalf("failed to create faq: %v", err)
+		}
+	}
+	db.Exec(`UPDATE faqs SET deleted_at = ? WHERE id = 'trashed'`, time.Now())
+
+	// Qdrant からの削除に失敗して残った点は回答に使わない
+	hits := []model.FAQ{{ID: "trashed"}, {ID: "live"}, {ID: "draft"}, {ID: "purged"}}
+	answerable, err := faq.FilterAnswerable(db, hits)
+	if err != nil || len(answerable) != 1 || answerable[0].ID != "live" {
+		t.Errorf("expected only the live faq, got %+v (%v)", answerable, err)
+	}
+}
@@ -0,0 +1,265 @@
+package faq
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/model"
+	"faq-search-ai/internal/vector"
+	"time"
+)
+
+const (
+	ActionSubmit    = "submit"
+	ActionApprove   = "approve"
+	ActionReject    = "reject"
+	ActionPublish   = "publish"
+	ActionUnpublish = "unpublish"
+)
+
+var (
+	ErrFAQNotFound       = errors.New("faq not found")
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrReviewRequired    = errors.New("review is required before publishing")
+	ErrSelfApproval      = errors.New("submitter cannot approve their own change")
+	ErrNotPublished      = errors.New("faq is not published")
+)
+
+// IsTransitionAction は action が状態遷移のエンドポイント名かどうかを返す
+func IsTransitionAction(action string) bool {
+	switch action {
+	case ActionSubmit, ActionApprove, ActionReject, ActionPublish, ActionUnpublish:
+		return true
+	}
+	return false
+}
+
+// TransitionFAQ はFAQの公開状態を遷移させる。
+// 公開中のFAQに編集中の下書きがある場合、unpublish 以外は下書きに対して作用する。
+//
+//	draft     --submit-->    in_review
+//	in_review --approve-->   published   (提出者以外が承認)
+//	in_review --reject-->    draft
+//	draft     --publish-->   published   (レビュー必須でない場合のみ)
+//	published --unpublish--> draft
+func TransitionFAQ(db *sql.DB, id string, workspaceID, actorID int64, action string) (*model.FAQ, error) {
+	f, err := GetFAQByID(db, id, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return nil, ErrFAQNotFound
+	}
+
+	if f.Status == model.StatusPublished && action != ActionUnpublish {
+		pending, err := GetPendingDraft(db, id)
+		if err != nil {
+			return nil, err
+		}
+		if pending == nil {
+			return nil, ErrInvalidTransition
+		}
+		return transitionPendingDraft(db, f, pending, actorID, action)
+	}
+
+	now := time.Now().UTC()
+	switch action {
+	case ActionSubmit:
+		err = setStatus(db, f, model.StatusDraft, model.StatusInReview,
+			`submitted_by = ?`, actorID)
+
+	case ActionApprove:
+		var submittedBy sql.NullInt64
+		if err := db.QueryRow(`SELECT submitted_by FROM faqs WHERE id = ?`, id).Scan(&submittedBy); err != nil {
+			return nil, err
+		}
+		if config.RequireReview && submittedBy.Valid && submittedBy.Int64 == actorID {
+			return nil, ErrSelfApproval
+		}
+		err = setStatus(db, f, model.StatusInReview, model.StatusPublished,
+			`reviewed_by = ?, reviewed_at = ?`, actorID, now)
+
+	case ActionReject:
+		err = setStatus(db, f, model.StatusInReview, model.StatusDraft,
+			`reviewed_by = ?, reviewed_at = ?`, actorID, now)
+
+	case ActionPublish:
+		if config.RequireReview {
+			return nil, ErrReviewRequired
+		}
+		err = setStatus(db, f, model.StatusDraft, model.StatusPublished,
+			`reviewed_by = NULL, reviewed_at = NULL`)
+
+	case ActionUnpublish:
+		pending, err := GetPendingDraft(db, id)
+		if err != nil {
+			return nil, err
+		}
+		// 下書きの行き場がなくなるため先に破棄してもらう
+		if pending != nil {
+			return nil, ErrInvalidTransition
+		}
+		if err := setStatus(db, f, model.StatusPublished, model.StatusDraft, `submitted_by = NULL`); err != nil {
+			return nil, err
+		}
+		return f, vector.DeleteFromQdrant(id)
+
+	default:
+		return nil, ErrInvalidTransition
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Status == model.StatusPublished {
+		if err := indexFAQ(f); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// setStatus は現在の状態が from の場合のみ to に変更し、追加の列も更新する
+func setStatus(db *sql.DB, f *model.FAQ, from, to, set string, args ...interface{}) error {
+	if f.Status != from {
+		return ErrInvalidTransition
+	}
+	args = append([]interface{}{to}, args...)
+	args = append(args, f.ID, from)
+	result, err := db.Exec(`UPDATE faqs SET status = ?, version = version + 1, `+set+` WHERE id = ? AND status = ? AND deleted_at IS NULL`, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvalidTransition
+	}
+	f.Status = to
+	f.Version++
+	return nil
+}
+
+func transitionPendingDraft(db *sql.DB, f *model.FAQ, pending *model.FAQDraft, actorID int64, action string) (*model.FAQ, error) {
+	switch action {
+	case ActionSubmit:
+		if pending.Status != model.StatusDraft {
+			return nil, ErrInvalidTransition
+		}
+		_, err := db.Exec(`UPDATE faq_drafts SET status = ?, submitted_by = ? WHERE faq_id = ?`, model.StatusInReview, actorID, f.ID)
+		return f, err
+
+	case ActionReject:
+		if pending.Status != model.StatusInReview {
+			return nil, ErrInvalidTransition
+		}
+		_, err := db.Exec(`UPDATE faq_drafts SET status = ? WHERE faq_id = ?`, model.StatusDraft, f.ID)
+		return f, err
+
+	case ActionApprove:
+		if pending.Status != model.StatusInReview {
+			return nil, ErrInvalidTransition
+		}
+		var submittedBy sql.NullInt64
+		if err := db.QueryRow(`SELECT submitted_by FROM faq_drafts WHERE faq_id = ?`, f.ID).Scan(&submittedBy); err != nil {
+			return nil, err
+		}
+		if config.RequireReview && submittedBy.Valid && submittedBy.Int64 == actorID {
+			return nil, ErrSelfApproval
+		}
+
+	case ActionPublish:
+		if pending.Status != model.StatusDraft {
+			return nil, ErrInvalidTransition
+		}
+		if config.RequireReview {
+			return nil, ErrReviewRequired
+		}
+
+	default:
+		return nil, ErrInvalidTransition
+	}
+
+	// 承認・公開: 下書きの内容を公開版に反映する
+	f.Question = pending.Question
+	f.Answer = pending.Answer
+	f.Category = pending.Category
+	f.Tags = pending.Tags
+	// 反映・レビュー記録・下書きの破棄は一緒に行い、途中で失敗しても下書きを残す
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := updateFAQTx(tx, f, pending.AuthorID, RevisionUpdate); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE faqs SET reviewed_by = ?, reviewed_at = ? WHERE id = ?`, actorID, time.Now().UTC(), f.ID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM faq_drafts WHERE faq_id = ?`, f.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return f, indexFAQ(f)
+}
+
+// GetPendingDraft は公開中のFAQに対する編集中の下書きを返す。無ければ nil
+func GetPendingDraft(db *sql.DB, faqID string) (*model.FAQDraft, error) {
+	var d model.FAQDraft
+	var tags string
+	err := db.QueryRow(`
+		SELECT faq_id, author_id, status, question, answer, category, tags, updated_at
+		FROM faq_drafts WHERE faq_id = ?`, faqID).
+		Scan(&d.FAQID, &d.AuthorID, &d.Status, &d.Question, &d.Answer, &d.Category, &tags, &d.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(tags), &d.Tags); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// SavePendingDraft は公開中のFAQに対する下書きを保存する。
+// 保存し直した下書きはレビュー前の状態に戻る
+func SavePendingDraft(db *sql.DB, f *model.FAQ, d *model.FAQDraft) error {
+	if f.Status != model.StatusPublished {
+		return ErrNotPublished
+	}
+	tags, err := json.Marshal(nonNilTags(d.Tags))
+	if err != nil {
+		return err
+	}
+
+	d.FAQID = f.ID
+	d.Status = model.StatusDraft
+	d.UpdatedAt = time.Now()
+	_, err = db.Exec(`
+		INSERT INTO faq_drafts (faq_id, author_id, status, question, answer, category, tags, submitted_by, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULL, ?)
+		ON CONFLICT(faq_id) DO UPDATE SET
+			author_id = excluded.author_id,
+			status = excluded.status,
+			question = excluded.question,
+			answer = excluded.answer,
+			category = excluded.category,
+			tags = excluded.tags,
+			submitted_by = NULL,
+			updated_at = excluded.updated_at`,
+		d.FAQID, d.AuthorID, d.Status, d.Question, d.Answer, d.Category, string(tags), d.UpdatedAt)
+	return err
+}
+
+func DeletePendingDraft(db *sql.DB, faqID string) error {
+	_, err := db.Exec(`DELETE FROM faq_drafts WHERE faq_id = ?`, faqID)
+	return err
+}
@@ -0,0 +1,137 @@
+package faq_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"faq-search-ai/internal/audit"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/faq"
+	"faq-search-ai/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleTransition_ReviewWorkflow(t *testing.T) {
+	db := setupTestDB(t)
+	prev := config.RequireReview
+	config.RequireReview = true
+	t.Cleanup(func() { config.RequireReview = prev })
+
+	if err := faq.CreateFAQ(db, &model.FAQ{ID: "faq-1", UserID: 1, Question: "Q", Answer: "A"}); err != nil {
+		t.Fatalf("failed to create faq: %v", err)
+	}
+
+	handler := routes(db)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	status := func() string {
+		var s string
+		db.QueryRow(`SELECT status FROM faqs WHERE id = 'faq-1'`).Scan(&s)
+		return s
+	}
+
+	if status() != model.StatusDraft {
+		t.Fatalf("expected new faq to be a draft, got %s", status())
+	}
+	if rr := do("POST", "/faqs/faq-1/publish", ""); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 publishing without review, got %d", rr.Code)
+	}
+	if rr := do("POST", "/faqs/faq-1/submit", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 on submit, got %d", rr.Code)
+	}
+	if status() != model.StatusInReview {
+		t.Errorf("expected in_review, got %s", status())
+	}
+	if rr := do("POST", "/faqs/faq-1/approve", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 approving own submission, got %d", rr.Code)
+	}
+	if rr := do("POST", "/faqs/faq-1/reject", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 on reject, got %d", rr.Code)
+	}
+	if status() != model.StatusDraft {
+		t.Errorf("expected draft after reject, got %s", status())
+	}
+	if rr := do("POST", "/faqs/faq-1/reject", ""); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 rejecting a draft, got %d", rr.Code)
+	}
+}
+
+func TestHandleSaveDraft_KeepsLiveVersion(t *testing.T) {
+	db := setupTestDB(t)
+	prev := config.RequireReview
+	config.RequireReview = true
+	t.Cleanup(func() { config.RequireReview = prev })
+
+	live := &model.FAQ{ID: "faq-1", UserID: 1, Question: "Q", Answer: "old answer", Status: model.StatusPublished}
+	if err := faq.CreateFAQ(db, live); err != nil {
+		t.Fatalf("failed to create faq: %v", err)
+	}
+
+	handler := routes(db)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("PUT", "/faqs/faq-1", `{"question":"Q","answer":"new answer"}`); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 editing published faq directly, got %d", rr.Code)
+	}
+	if rr := do("PUT", "/faqs/faq-1/draft", `{"question":"Q","answer":"new answer"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 saving draft, got %d", rr.Code)
+	}
+	if events, _ := audit.List(db, audit.Filter{Actions: []string{audit.ActionFAQDraftSaved}, TargetID: "faq-1"}, 0, 0); len(events) != 1 {
+		t.Errorf("expected one audited draft save, got %+v", events)
+	}
+
+	rr := do("GET", "/faqs/faq-1", "")
+	var got model.FAQ
+	json.NewDecoder(rr.Body).Decode(&got)
+	if got.Answer != "old answer" || got.Status != model.StatusPublished {
+		t.Errorf("live version changed: %+v", got)
+	}
+
+	rr = do("GET", "/faqs/faq-1/draft", "")
+	var d model.FAQDraft
+	json.NewDecoder(rr.Body).Decode(&d)
+	if d.Answer != "new answer" || d.Status != model.StatusDraft {
+		t.Errorf("unexpected draft: %+v", d)
+	}
+
+	if rr := do("POST", "/faqs/faq-1/submit", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 submitting draft, got %d", rr.Code)
+	}
+	if rr := do("POST", "/faqs/faq-1/approve", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 approving own draft, got %d", rr.Code)
+	}
+	if rr := do("POST", "/faqs/faq-1/unpublish", ""); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 unpublishing with a pending draft, got %d", rr.Code)
+	}
+}
+
+func TestHandleCreateFAQ_DraftWhenReviewRequired(t *testing.T) {
+	db := setupTestDB(t)
+	prev := config.RequireReview
+	config.RequireReview = true
+	t.Cleanup(func() { config.RequireReview = prev })
+
+	req := httptest.NewRequest("POST", "/faqs", bytes.NewBufferString(`{"question":"Q","answer":"A"}`))
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, int64(1)))
+	rr := httptest.NewRecorder()
+	routes(db).ServeHTTP(rr, req)
+	var created model.FAQ
+	json.NewDecoder(rr.Body).Decode(&created)
+	if rr.Code != http.StatusCreated || created.Status != model.StatusDraft {
+		t.Errorf("expected a draft, got %d %q", rr.Code, created.Status)
+	}
+}
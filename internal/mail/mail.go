@@ -0,0 +1,114 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"faq-search-ai/internal/config"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns an SMTP mailer when SMTP_ADDR is configured, and otherwise a
+// LogMailer for local development.
+func New() Mailer {
+	if config.SMTPAddr == "" {
+		return &LogMailer{Dir: config.MailDir, From: config.MailFrom}
+	}
+	return &SMTPMailer{
+		Addr:     config.SMTPAddr,
+		Username: config.SMTPUsername,
+		Password: config.SMTPPassword,
+		From:     config.MailFrom,
+	}
+}
+
+// SMTPMailer sends through an SMTP server, authenticating with PLAIN when a
+// username is set.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	data, err := compose(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, data)
+}
+
+// LogMailer writes each email to a file in Dir, or to the log when Dir is
+// empty. It never delivers anything.
+type LogMailer struct {
+	Dir  string
+	From string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9@._-]`)
+
+func (m *LogMailer) Send(msg Message) error {
+	now := time.Now()
+	data, err := compose(m.From, msg, now)
+	if err != nil {
+		return err
+	}
+	if m.Dir == "" {
+		log.Printf("mail to %s:\n%s", msg.To, data)
+		return nil
+	}
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o600)
+}
+
+// ErrInvalidHeader is returned when a header value would inject extra headers.
+var ErrInvalidHeader = errors.New("mail header contains a line break")
+
+// compose builds an RFC 5322 message with a UTF-8 body.
+func compose(from string, msg Message, date time.Time) ([]byte, error) {
+	if strings.ContainsAny(from+msg.To+msg.Subject, "\r\n") {
+		return nil, ErrInvalidHeader
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(msg.Body)
+	return b.Bytes(), nil
+}
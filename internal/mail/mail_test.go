@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogMailerWritesFile(t *testing.T) {
+	dir := t.TempDir()
+	m := &LogMailer{Dir: dir, From: "no-reply@example.com"}
+	if err := m.Send(Message{To: "a@example.com", Subject: "パスワードの再設定", Body: "本文"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), "a@example.com.eml") {
+		t.Fatalf("unexpected files: %v", entries)
+	}
+	data, _ := os.ReadFile(dir + "/" + entries[0].Name())
+	for _, want := range []string{"To: a@example.com\r\n", "Subject: =?utf-8?q?", "charset=UTF-8", "\r\n\r\n本文"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("message missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestComposeRejectsHeaderInjection(t *testing.T) {
+	m := &LogMailer{Dir: t.TempDir()}
+	err := m.Send(Message{To: "a@example.com\r\nBcc: victim@example.com", Subject: "x"})
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected ErrInvalidHeader, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import "net/http"
+
+// Middleware wraps a handler with behaviour shared by several routes, such as
+// authentication or CORS headers.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h with middlewares so that the first one sees the request first.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Deprecated marks responses served from a legacy path. The Link header points
+// clients to the same path under prefix.
+func Deprecated(prefix string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Add("Link", "<"+prefix+r.URL.Path+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
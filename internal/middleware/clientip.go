@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"faq-search-ai/internal/config"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the address of the client. X-Forwarded-For is only used
+// when TRUST_PROXY_HEADERS is enabled, since clients can set it themselves.
+// Entries are read from the right, skipping those added by TRUSTED_PROXIES,
+// so a value prepended by the client is never taken.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !config.TrustProxyHeaders {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		if !trustedProxy(ip) {
+			return ip.String()
+		}
+	}
+	return host
+}
+
+func trustedProxy(ip net.IP) bool {
+	for _, network := range config.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package middleware_test
+
+import (
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/middleware"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func useProxies(t *testing.T, trust bool, cidrs ...string) {
+	t.Helper()
+	prevTrust, prevProxies := config.TrustProxyHeaders, config.TrustedProxies
+	t.Cleanup(func() {
+		config.TrustProxyHeaders, config.TrustedProxies = prevTrust, prevProxies
+	})
+	config.TrustProxyHeaders = trust
+	config.TrustedProxies = nil
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.TrustedProxies = append(config.TrustedProxies, network)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cases := []struct {
+		name      string
+		trust     bool
+		proxies   []string
+		forwarded []string
+		want      string
+	}{
+		{"header ignored when not trusted", false, nil, []string{"203.0.113.7"}, "10.0.0.2"},
+		{"no header", true, nil, nil, "10.0.0.2"},
+		{"single proxy", true, nil, []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed leftmost entry", true, nil, []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"spoofed entry behind trusted proxies", true, []string{"10.1.0.0/16"}, []string{"1.2.3.4, 203.0.113.7, 10.1.0.5"}, "203.0.113.7"},
+		{"repeated headers", true, []string{"10.1.0.0/16"}, []string{"1.2.3.4", "203.0.113.7, 10.1.0.5"}, "203.0.113.7"},
+		{"invalid entry", true, nil, []string{"203.0.113.7, bogus"}, "10.0.0.2"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			useProxies(t, c.trust, c.proxies...)
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "10.0.0.2:51234"
+			for _, v := range c.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := middleware.ClientIP(r); got != c.want {
+				t.Errorf("ClientIP = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -6,7 +6,8 @@ func WithCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, x-api-key")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, x-api-key, If-Match, If-None-Match, X-Workspace-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor, Link, ETag, Deprecation")
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -2,11 +2,37 @@ package model
 
 import "time"
 
+const (
+	StatusDraft     = "draft"
+	StatusInReview  = "in_review"
+	StatusPublished = "published"
+)
+
 type FAQ struct {
-	ID        string    `json:"id"`
-	UserID    int64     `json:"-"`
+	ID              string     `json:"id"`
+	WorkspaceID     int64      `json:"workspace_id"`
+	UserID          int64      `json:"-"`
+	KnowledgeBaseID int64      `json:"knowledge_base_id"`
+	Question        string     `json:"question"`
+	Answer          string     `json:"answer"`
+	Category        string     `json:"category"`
+	Tags            []string   `json:"tags"`
+	Status          string     `json:"status"`
+	Version         int64      `json:"version"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+}
+
+// FAQDraft is pending content for a published FAQ, kept apart from the live
+// version until it is approved or published.
+type FAQDraft struct {
+	FAQID     string    `json:"faq_id"`
+	AuthorID  int64     `json:"author_id"`
+	Status    string    `json:"status"`
 	Question  string    `json:"question"`
 	Answer    string    `json:"answer"`
-	CreatedAt time.Time `json:"created_at"`
+	Category  string    `json:"category"`
+	Tags      []string  `json:"tags"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// KnowledgeBase groups FAQs so that questions can be answered from one
+// product or topic without mixing in the rest of a user's FAQs.
+type KnowledgeBase struct {
+	ID          int64     `json:"id"`
+	WorkspaceID int64     `json:"workspace_id"`
+	UserID      int64     `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	FAQCount    int       `json:"faq_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
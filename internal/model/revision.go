@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// FAQRevision is a snapshot of an FAQ's content after one change.
+type FAQRevision struct {
+	FAQID     string    `json:"faq_id"`
+	Revision  int       `json:"revision"`
+	AuthorID  int64     `json:"author_id"`
+	Action    string    `json:"action"`
+	Question  string    `json:"question"`
+	Answer    string    `json:"answer"`
+	Category  string    `json:"category"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+}
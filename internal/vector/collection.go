@@ -0,0 +1,371 @@
+package vector
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/model"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	CollectionActive   = "active"
+	CollectionBuilding = "building"
+	CollectionRetired  = "retired"
+
+	// legacyCollection is the collection created before models were tracked.
+	legacyCollection = "faq_vectors"
+	legacyModel      = "text-embedding-ada-002"
+)
+
+// knownDimensions maps embedding models to the size of the vectors they return.
+var knownDimensions = map[string]int{
+	"text-embedding-ada-002": 1536,
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+}
+
+// Collection is a Qdrant collection tagged with the embedding model that filled it.
+type Collection struct {
+	Name      string `json:"name"`
+	Model     string `json:"model"`
+	Dimension int    `json:"dimension"`
+	Status    string `json:"status"`
+}
+
+// FAQSource walks every stored FAQ so a new collection can be filled.
+type FAQSource func(fn func(f model.FAQ) error) error
+
+var (
+	collectionsMu sync.RWMutex
+	active        = Collection{Name: legacyCollection, Model: legacyModel, Dimension: 1536, Status: CollectionActive}
+	building      *Collection
+)
+
+// ActiveCollection returns the collection currently used for search.
+func ActiveCollection() Collection {
+	collectionsMu.RLock()
+	defer collectionsMu.RUnlock()
+	return active
+}
+
+// writeCollections returns every collection that must receive upserts and deletes.
+func writeCollections() []Collection {
+	collectionsMu.RLock()
+	defer collectionsMu.RUnlock()
+	cs := []Collection{active}
+	if building != nil {
+		cs = append(cs, *building)
+	}
+	return cs
+}
+
+// ModelDimension resolves the vector size for a model, preferring an explicit override.
+func ModelDimension(embeddingModel string, override int) (int, error) {
+	if override > 0 {
+		return override, nil
+	}
+	if dim, ok := knownDimensions[embeddingModel]; ok {
+		return dim, nil
+	}
+	return 0, fmt.Errorf("unknown dimension for embedding model %q; set EMBEDDING_DIMENSION", embeddingModel)
+}
+
+// CollectionName derives a collection name from the model and dimension.
+func CollectionName(embeddingModel string, dim int) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '_'
+		}
+	}, embeddingModel)
+	return fmt.Sprintf("faq_vectors_%s_%d", slug, dim)
+}
+
+// InitCollections loads the collection registry, validates the active collection
+// against Qdrant and the configured model, and starts a migration if allowed.
+func InitCollections(db *sql.DB, source FAQSource) error {
+	dim, err := ModelDimension(config.EmbeddingModel, config.EmbeddingDimension)
+	if err != nil {
+		return err
+	}
+
+	current, err := loadActiveCollection(db)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		current, err = bootstrapCollection(db, config.EmbeddingModel, dim)
+		if err != nil {
+			return err
+		}
+	}
+
+	size, exists, err := collectionSize(current.Name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := createCollection(current.Name, current.Dimension); err != nil {
+			return err
+		}
+	} else if size != current.Dimension {
+		return fmt.Errorf("collection %q has vector size %d but is registered as %d", current.Name, size, current.Dimension)
+	}
+	// 既存コレクションにも後から追加したインデックスを張る
+	if err := createPayloadIndexes(current.Name); err != nil {
+		return err
+	}
+
+	collectionsMu.Lock()
+	active = *current
+	collectionsMu.Unlock()
+
+	if current.Model == config.EmbeddingModel && current.Dimension == dim {
+		return nil
+	}
+	if !config.EmbeddingMigrate {
+		return fmt.Errorf("configured embedding model %s (%d) does not match active collection %q (%s, %d); set EMBEDDING_MIGRATE=true to rebuild",
+			config.EmbeddingModel, dim, current.Name, current.Model, current.Dimension)
+	}
+
+	go func() {
+		if err := MigrateCollection(db, config.EmbeddingModel, dim, source); err != nil {
+			log.Printf("embedding migration to %s failed: %v", config.EmbeddingModel, err)
+		}
+	}()
+	return nil
+}
+
+// MigrateCollection builds a new collection for embeddingModel, fills it from source
+// and switches search over to it. The old collection keeps serving until the switch
+// and is kept (as retired) afterwards.
+func MigrateCollection(db *sql.DB, embeddingModel string, dim int, source FAQSource) error {
+	next := Collection{
+		Name:      CollectionName(embeddingModel, dim),
+		Model:     embeddingModel,
+		Dimension: dim,
+		Status:    CollectionBuilding,
+	}
+
+	collectionsMu.Lock()
+	if building != nil {
+		collectionsMu.Unlock()
+		return fmt.Errorf("migration to %q already running", building.Name)
+	}
+	if active.Name == next.Name {
+		collectionsMu.Unlock()
+		return fmt.Errorf("collection %q is already active", next.Name)
+	}
+	building = &next
+	collectionsMu.Unlock()
+
+	err := buildCollection(db, next, source)
+	if err != nil {
+		collectionsMu.Lock()
+		building = nil
+		collectionsMu.Unlock()
+		return err
+	}
+
+	collectionsMu.Lock()
+	next.Status = CollectionActive
+	active = next
+	building = nil
+	collectionsMu.Unlock()
+
+	log.Printf("Qdrant collection '%s' is now active (model %s, dim %d).", next.Name, next.Model, next.Dimension)
+	return nil
+}
+
+func buildCollection(db *sql.DB, next Collection, source FAQSource) error {
+	size, exists, err := collectionSize(next.Name)
+	if err != nil {
+		return err
+	}
+	if exists && size != next.Dimension {
+		return fmt.Errorf("collection %q already exists with vector size %d", next.Name, size)
+	}
+	if !exists {
+		if err := createCollection(next.Name, next.Dimension); err != nil {
+			return err
+		}
+	}
+
+	if _, err := db.Exec(`
+		INSERT INTO vector_collections (name, model, dimension, status)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET status = excluded.status`,
+		next.Name, next.Model, next.Dimension, CollectionBuilding); err != nil {
+		return err
+	}
+
+	count := 0
+	err = source(func(f model.FAQ) error {
+		vec, err := embed(f.Question, next.Model)
+		if err != nil {
+			return err
+		}
+		count++
+		return upsertPoint(next, f, vec)
+	})
+	if err != nil {
+		return fmt.Errorf("reindex into %q failed after %d FAQs: %w", next.Name, count, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE vector_collections SET status = ? WHERE status = ?`, CollectionRetired, CollectionActive); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE vector_collections SET status = ?, activated_at = CURRENT_TIMESTAMP WHERE name = ?`, CollectionActive, next.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func loadActiveCollection(db *sql.DB) (*Collection, error) {
+	var c Collection
+	err := db.QueryRow(`SELECT name, model, dimension, status FROM vector_collections WHERE status = ?`, CollectionActive).
+		Scan(&c.Name, &c.Model, &c.Dimension, &c.Status)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// bootstrapCollection registers the first collection. Deployments that predate the
+// registry already have faq_vectors filled with ada-002 vectors, so it is adopted as is.
+func bootstrapCollection(db *sql.DB, embeddingModel string, dim int) (*Collection, error) {
+	c := Collection{Name: CollectionName(embeddingModel, dim), Model: embeddingModel, Dimension: dim, Status: CollectionActive}
+
+	_, exists, err := collectionSize(legacyCollection)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		c = Collection{Name: legacyCollection, Model: legacyModel, Dimension: knownDimensions[legacyModel], Status: CollectionActive}
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO vector_collections (name, model, dimension, status, activated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)`, c.Name, c.Model, c.Dimension, c.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// collectionSize reports the vector size of a Qdrant collection and whether it exists.
+func collectionSize(name string) (int, bool, error) {
+	res, err := http.Get(config.QdrantURL + "/collections/" + name)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get collection %q: %w", name, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return 0, false, nil
+	}
+	bodyBytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, false, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("get collection %q failed: %s", name, string(bodyBytes))
+	}
+
+	var info struct {
+		Result struct {
+			Config struct {
+				Params struct {
+					Vectors struct {
+						Size int `json:"size"`
+					} `json:"vectors"`
+				} `json:"params"`
+			} `json:"config"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(bodyBytes, &info); err != nil {
+		return 0, false, err
+	}
+	return info.Result.Config.Params.Vectors.Size, true, nil
+}
+
+func createCollection(name string, dim int) error {
+	payload := map[string]interface{}{
+		"vectors": map[string]interface{}{
+			"size":     dim,
+			"distance": "Cosine",
+		},
+	}
+	b, _ := json.Marshal(payload)
+
+	req, _ := http.NewRequest("PUT", config.QdrantURL+"/collections/"+name, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to create collection: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("create collection failed: %s", string(bodyBytes))
+	}
+
+	log.Printf("Qdrant collection '%s' created.", name)
+	return createPayloadIndexes(name)
+}
+
+// payloadIndexes lists the payload fields used in search filters.
+var payloadIndexes = map[string]string{
+	"workspace_id":      "integer",
+	"user_id":           "integer",
+	"knowledge_base_id": "integer",
+	"category":          "keyword",
+	"tags":              "keyword",
+}
+
+// createPayloadIndexes indexes filterable payload fields. Qdrant treats an
+// existing index as success, so this is safe to call on every startup.
+func createPayloadIndexes(name string) error {
+	for field, schema := range payloadIndexes {
+		b, _ := json.Marshal(map[string]string{
+			"field_name":   field,
+			"field_schema": schema,
+		})
+
+		req, _ := http.NewRequest("PUT", config.QdrantURL+"/collections/"+name+"/index?wait=true", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to create payload index %q: %w", field, err)
+		}
+		bodyBytes, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("create payload index %q failed: %s", field, string(bodyBytes))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package vector_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/model"
+	"faq-search-ai/internal/vector"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	return db
+}
+
+// fakeQdrant serves collection info for the given collections (name -> vector size)
+// and returns the number of payload index requests per collection.
+func fakeQdrant(t *testing.T, collections map[string]int) map[string]int {
+	indexes := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/collections/")
+		if strings.HasSuffix(name, "/index") {
+			indexes[strings.TrimSuffix(name, "/index")]++
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			size, ok := collections[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"result": map[string]any{
+					"config": map[string]any{
+						"params": map[string]any{
+							"vectors": map[string]any{"size": size, "distance": "Cosine"},
+						},
+					},
+				},
+			})
+		case http.MethodPut:
+			var body struct {
+				Vectors struct {
+					Size int `json:"size"`
+				} `json:"vectors"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			collections[name] = body.Vectors.Size
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	prevURL := config.QdrantURL
+	config.QdrantURL = srv.URL
+	t.Cleanup(func() { config.QdrantURL = prevURL })
+	return indexes
+}
+
+func setEmbeddingConfig(t *testing.T, embeddingModel string, migrate bool) {
+	prevModel, prevMigrate := config.EmbeddingModel, config.EmbeddingMigrate
+	config.EmbeddingModel, config.EmbeddingMigrate = embeddingModel, migrate
+	t.Cleanup(func() { config.EmbeddingModel, config.EmbeddingMigrate = prevModel, prevMigrate })
+}
+
+func emptySource(fn func(f model.FAQ) error) error { return nil }
+
+func TestCollectionName(t *testing.T) {
+	got := vector.CollectionName("text-embedding-3-large", 3072)
+	if got != "faq_vectors_text_embedding_3_large_3072" {
+		t.Errorf("unexpected collection name: %s", got)
+	}
+}
+
+func TestInitCollections_AdoptsLegacyCollection(t *testing.T) {
+	db := setupTestDB(t)
+	indexes := fakeQdrant(t, map[string]int{"faq_vectors": 1536})
+	setEmbeddingConfig(t, "text-embedding-ada-002", false)
+
+	if err := vector.InitCollections(db, emptySource); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	active := vector.ActiveCollection()
+	if active.Name != "faq_vectors" || active.Dimension != 1536 {
+		t.Errorf("expected legacy collection to be active, got %+v", active)
+	}
+	if indexes["faq_vectors"] == 0 {
+		t.Error("expected payload indexes to be created on the legacy collection")
+	}
+}
+
+func TestInitCollections_ModelMismatch(t *testing.T) {
+	db := setupTestDB(t)
+	fakeQdrant(t, map[string]int{"faq_vectors": 1536})
+	setEmbeddingConfig(t, "text-embedding-3-large", false)
+
+	err := vector.InitCollections(db, emptySource)
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected model mismatch error, got %v", err)
+	}
+}
+
+func TestInitCollections_DimensionMismatch(t *testing.T) {
+	db := setupTestDB(t)
+	fakeQdrant(t, map[string]int{"faq_vectors": 768})
+	setEmbeddingConfig(t, "text-embedding-ada-002", false)
+
+	if err := vector.InitCollections(db, emptySource); err == nil {
+		t.Fatal("expected error for collection with wrong vector size")
+	}
+}
+
+func TestMigrateCollection_SwitchesActive(t *testing.T) {
+	db := setupTestDB(t)
+	fakeQdrant(t, map[string]int{"faq_vectors": 1536})
+	setEmbeddingConfig(t, "text-embedding-ada-002", false)
+
+	if err := vector.InitCollections(db, emptySource); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if err := vector.MigrateCollection(db, "text-embedding-3-large", 3072, emptySource); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	active := vector.ActiveCollection()
+	if active.Model != "text-embedding-3-large" || active.Dimension != 3072 {
+		t.Errorf("expected new collection to be active, got %+v", active)
+	}
+
+	var status string
+	db.QueryRow(`SELECT status FROM vector_collections WHERE name = 'faq_vectors'`).Scan(&status)
+	if status != vector.CollectionRetired {
+		t.Errorf("expected legacy collection to be retired, got %q", status)
+	}
+}
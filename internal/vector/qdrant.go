@@ -46,51 +46,16 @@ type QdrantSearchResponse struct {
 	} `json:"result"`
 }
 
-// InitQdrantCollection checks and creates the collection if it doesn't exist
-func InitQdrantCollection() error {
-	url := config.QdrantURL + "/collections/faq_vectors"
-
-	req, _ := http.NewRequest("GET", url, nil)
-	res, err := http.DefaultClient.Do(req)
-	if err == nil && res.StatusCode == http.StatusOK {
-		res.Body.Close()
-		return nil
-	}
-	if res != nil {
-		res.Body.Close()
-	}
-
-	payload := map[string]interface{}{
-		"vectors": map[string]interface{}{
-			"size":     1536, // OpenAI embedding の次元数
-			"distance": "Cosine",
-		},
-	}
-	b, _ := json.Marshal(payload)
-
-	req, _ = http.NewRequest("PUT", url, bytes.NewReader(b))
-	req.Header.Set("Content-Type", "application/json")
-
-	res, err = http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to create collection: %w", err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(res.Body)
-		return fmt.Errorf("create collection failed: %s", string(bodyBytes))
-	}
-
-	log.Println("Qdrant collection 'faq_vectors' created.")
-	return nil
+// GenerateEmbedding converts text to vector with the model of the active collection
+func GenerateEmbedding(text string) ([]float64, error) {
+	return embed(text, ActiveCollection().Model)
 }
 
-// GenerateEmbedding converts text to vector via embedding API (e.g., OpenRouter)
-func GenerateEmbedding(text string) ([]float64, error) {
+// embed converts text to vector via embedding API (e.g., OpenRouter)
+func embed(text, embeddingModel string) ([]float64, error) {
 	body := EmbeddingRequest{
 		Input: text,
-		Model: "text-embedding-ada-002",
+		Model: embeddingModel,
 	}
 	b, _ := json.Marshal(body)
 
@@ -122,16 +87,47 @@ func GenerateEmbedding(text string) ([]float64, error) {
 	return parsed.Data[0].Embedding, nil
 }
 
-// UpsertToQdrant saves a vector with metadata to Qdrant
-func UpsertToQdrant(id string, userID int64, question, answer string, vector []float64) error {
+// UpsertToQdrant embeds the question and saves it with metadata to Qdrant.
+// Each target collection gets a vector from its own model, so a migration that
+// switches the active collection meanwhile cannot mix vectors from different models.
+func UpsertToQdrant(f model.FAQ) error {
+	for _, c := range writeCollections() {
+		vec, err := embed(f.Question, c.Model)
+		if err != nil {
+			return err
+		}
+		if err := upsertPoint(c, f, vec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func faqPayload(f model.FAQ) map[string]interface{} {
+	tags := f.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return map[string]interface{}{
+		"workspace_id":      f.WorkspaceID,
+		"user_id":           f.UserID,
+		"knowledge_base_id": f.KnowledgeBaseID,
+		"answer":            f.Answer,
+		"question":          f.Question,
+		"category":          f.Category,
+		"tags":              tags,
+	}
+}
+
+func upsertPoint(c Collection, f model.FAQ, vector []float64) error {
+	if len(vector) != c.Dimension {
+		return fmt.Errorf("vector size %d does not match collection %q (%d)", len(vector), c.Name, c.Dimension)
+	}
+
 	point := QdrantPoint{
-		ID:     id,
-		Vector: vector,
-		Payload: map[string]interface{}{
-			"user_id":  userID,
-			"answer":   answer,
-			"question": question,
-		},
+		ID:      f.ID,
+		Vector:  vector,
+		Payload: faqPayload(f),
 	}
 
 	payload := QdrantUpsertRequest{
@@ -139,7 +135,7 @@ func UpsertToQdrant(id string, userID int64, question, answer string, vector []f
 	}
 	b, _ := json.Marshal(payload)
 
-	url := fmt.Sprintf(config.QdrantURL + "/collections/faq_vectors/points?wait=true")
+	url := config.QdrantURL + "/collections/" + c.Name + "/points?wait=true"
 	req, _ := http.NewRequest("PUT", url, bytes.NewBuffer(b))
 	req.Header.Set("Content-Type", "application/json")
 
@@ -158,46 +154,120 @@ func UpsertToQdrant(id string, userID int64, question, answer string, vector []f
 
 // DeleteFromQdrant removes a point from Qdrant by ID
 func DeleteFromQdrant(id string) error {
+	return DeletePointsFromQdrant([]string{id})
+}
+
+// DeletePointsFromQdrant removes several points in one request per collection.
+func DeletePointsFromQdrant(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
 	payload := map[string]interface{}{
-		"points": []string{id},
+		"points": ids,
 	}
 	b, _ := json.Marshal(payload)
 
-	url := config.QdrantURL + "/collections/faq_vectors/points/delete?wait=true"
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(b))
-	req.Header.Set("Content-Type", "application/json")
+	for _, c := range writeCollections() {
+		url := config.QdrantURL + "/collections/" + c.Name + "/points/delete?wait=true"
+		req, _ := http.NewRequest("POST", url, bytes.NewBuffer(b))
+		req.Header.Set("Content-Type", "application/json")
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			log.Printf("Qdrant deletion failed: %d", res.StatusCode)
+			return fmt.Errorf("failed to delete from Qdrant")
+		}
 	}
-	defer res.Body.Close()
+	return nil
+}
 
-	if res.StatusCode != http.StatusOK {
-		log.Printf("Qdrant deletion failed: %d", res.StatusCode)
-		return fmt.Errorf("failed to delete from Qdrant")
+// SetPayload merges payload fields into existing points without re-embedding them.
+func SetPayload(ids []string, payload map[string]interface{}) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	b, _ := json.Marshal(map[string]interface{}{
+		"payload": payload,
+		"points":  ids,
+	})
+
+	for _, c := range writeCollections() {
+		req, _ := http.NewRequest("POST", config.QdrantURL+"/collections/"+c.Name+"/points/payload?wait=true", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to set payload in %q: status %d", c.Name, res.StatusCode)
+		}
 	}
 	return nil
 }
 
-func SearchSimilarFAQs(vector []float64, userID int64, topK int) ([]model.FAQ, error) {
+// SearchFilter narrows a similarity search to a knowledge base, a category
+// and/or a set of tags. Every tag must be present on a matching FAQ.
+type SearchFilter struct {
+	KnowledgeBaseID int64
+	Category        string
+	Tags            []string
+}
+
+func (f SearchFilter) conditions(workspaceID int64) []map[string]interface{} {
+	must := []map[string]interface{}{
+		{
+			"key":   "workspace_id",
+			"match": map[string]interface{}{"value": workspaceID},
+		},
+	}
+	if f.KnowledgeBaseID != 0 {
+		must = append(must, map[string]interface{}{
+			"key":   "knowledge_base_id",
+			"match": map[string]interface{}{"value": f.KnowledgeBaseID},
+		})
+	}
+	if f.Category != "" {
+		must = append(must, map[string]interface{}{
+			"key":   "category",
+			"match": map[string]interface{}{"value": f.Category},
+		})
+	}
+	for _, tag := range f.Tags {
+		must = append(must, map[string]interface{}{
+			"key":   "tags",
+			"match": map[string]interface{}{"value": tag},
+		})
+	}
+	return must
+}
+
+// SearchSimilarFAQs returns the FAQs of a workspace closest to vector.
+func SearchSimilarFAQs(vector []float64, workspaceID int64, filter SearchFilter, topK int) ([]model.FAQ, error) {
+	c := ActiveCollection()
+	if len(vector) != c.Dimension {
+		return nil, fmt.Errorf("vector size %d does not match collection %q (%d)", len(vector), c.Name, c.Dimension)
+	}
+
 	query := map[string]interface{}{
 		"vector":       vector,
 		"limit":        topK,
 		"with_payload": true,
 		"filter": map[string]interface{}{
-			"must": []map[string]interface{}{
-				{
-					"key":   "user_id",
-					"match": map[string]interface{}{"value": userID},
-				},
-			},
+			"must": filter.conditions(workspaceID),
 		},
 	}
 
 	body, _ := json.Marshal(query)
 
-	req, _ := http.NewRequest("POST", config.QdrantURL+"/collections/faq_vectors/points/search", bytes.NewBuffer(body))
+	req, _ := http.NewRequest("POST", config.QdrantURL+"/collections/"+c.Name+"/points/search", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 
 	res, err := http.DefaultClient.Do(req)
@@ -230,7 +300,9 @@ func SearchSimilarFAQs(vector []float64, userID int64, topK int) ([]model.FAQ, e
 	for _, r := range result.Result {
 		if q, ok := r.Payload["question"].(string); ok {
 			if a, ok := r.Payload["answer"].(string); ok {
-				faqs = append(faqs, model.FAQ{Question: q, Answer: a})
+				category, _ := r.Payload["category"].(string)
+				id, _ := r.ID.(string)
+				faqs = append(faqs, model.FAQ{ID: id, Question: q, Answer: a, Category: category})
 			}
 		}
 	}
@@ -0,0 +1,315 @@
+package workspace
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/model"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// userFromRequest は JWTAuthMiddleware が設定したユーザー ID を返す。無ければ 401 を書き込んで false を返す
+func userFromRequest(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID, ok := r.Context().Value(auth.UserIDContextKey).(int64)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}
+	return userID, ok
+}
+
+// HandleListWorkspaces は GET /workspaces で所属するワークスペースを一覧する
+func HandleListWorkspaces(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := userFromRequest(w, r)
+		if !ok {
+			return
+		}
+		workspaces, err := ListWorkspaces(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch workspaces", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(workspaces)
+	}
+}
+
+// HandleCreateWorkspace は POST /workspaces でチーム用ワークスペースを作成する
+func HandleCreateWorkspace(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := userFromRequest(w, r)
+		if !ok {
+			return
+		}
+		var input struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		ws := &model.Workspace{Name: strings.TrimSpace(input.Name), CreatedBy: userID}
+		if ws.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		if err := CreateWorkspace(db, ws); err != nil {
+			http.Error(w, "Failed to create workspace", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ws)
+	}
+}
+
+// workspaceHandler はパスの {id} のワークスペースを読み込み、role 以上の権限があれば fn を呼ぶ。
+// 所属していないワークスペースは存在を明かさず 404 にする
+func workspaceHandler(db *sql.DB, role string, fn func(w http.ResponseWriter, r *http.Request, scope Scope, ws *model.Workspace)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := userFromRequest(w, r)
+		if !ok {
+			return
+		}
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		ws, err := GetWorkspace(db, id, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch workspace", http.StatusInternalServerError)
+			return
+		}
+		if ws == nil {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+			return
+		}
+		scope := Scope{UserID: userID, WorkspaceID: ws.ID, Role: ws.Role}
+		if !Require(w, scope, role) {
+			return
+		}
+		fn(w, r, scope, ws)
+	}
+}
+
+// HandleGetWorkspace は GET /workspaces/{id} でワークスペースを返す
+func HandleGetWorkspace(db *sql.DB) http.HandlerFunc {
+	return workspaceHandler(db, model.RoleViewer, func(w http.ResponseWriter, r *http.Request, scope Scope, ws *model.Workspace) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ws)
+	})
+}
+
+// HandleRenameWorkspace は PATCH /workspaces/{id} で名前を変更する (owner)
+func HandleRenameWorkspace(db *sql.DB) http.HandlerFunc {
+	return workspaceHandler(db, model.RoleOwner, func(w http.ResponseWriter, r *http.Request, scope Scope, ws *model.Workspace) {
+		var input struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		ws.Name = strings.TrimSpace(input.Name)
+		if ws.Name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		if err := RenameWorkspace(db, ws.ID, ws.Name); err != nil {
+			http.Error(w, "Failed to update workspace", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ws)
+	})
+}
+
+// HandleDeleteWorkspace は DELETE /workspaces/{id} でワークスペースを削除する (owner、空の場合のみ)
+func HandleDeleteWorkspace(db *sql.DB) http.HandlerFunc {
+	return workspaceHandler(db, model.RoleOwner, func(w http.ResponseWriter, r *http.Request, scope Scope, ws *model.Workspace) {
+		err := DeleteWorkspace(db, ws.ID)
+		switch {
+		case errors.Is(err, ErrPersonal), errors.Is(err, ErrNotEmpty):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			http.Error(w, "Failed to delete workspace", http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+// HandleListMembers は GET /workspaces/{id}/members でメンバーを一覧する
+func HandleListMembers(db *sql.DB) http.HandlerFunc {
+	return workspaceHandler(db, model.RoleViewer, func(w http.ResponseWriter, r *http.Request, scope Scope, ws *model.Workspace) {
+		members, err := ListMembers(db, scope.WorkspaceID)
+		if err != nil {
+			http.Error(w, "Failed to fetch members", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(members)
+	})
+}
+
+// HandleUpdateMember は PATCH /workspaces/{id}/members/{user_id} で役割を変更する (owner)
+func HandleUpdateMember(db *sql.DB) http.HandlerFunc {
+	return workspaceHandler(db, model.RoleOwner, func(w http.ResponseWriter, r *http.Request, scope Scope, ws *model.Workspace) {
+		memberID, err := strconv.ParseInt(r.PathValue("user_id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		var input struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		writeMemberResult(w, SetMemberRole(db, scope.WorkspaceID, memberID, input.Role))
+	})
+}
+
+// HandleRemoveMember は DELETE /workspaces/{id}/members/{user_id} でメンバーを外す。
+// 外せるのは owner だが、自分で抜けるのは誰でもできる
+func HandleRemoveMember(db *sql.DB) http.HandlerFunc {
+	return workspaceHandler(db, model.RoleViewer, func(w http.ResponseWriter, r *http.Request, scope Scope, ws *model.Workspace) {
+		memberID, err := strconv.ParseInt(r.PathValue("user_id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if memberID != scope.UserID && !Require(w, scope, model.RoleOwner) {
+			return
+		}
+		writeMemberResult(w, RemoveMember(db, scope.WorkspaceID, memberID))
+	})
+}
+
+func writeMemberResult(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRole):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrNotMember):
+		http.Error(w, "Member not found", http.StatusNotFound)
+	case errors.Is(err, ErrLastOwner):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		log.Printf("workspace member update error: %v", err)
+		http.Error(w, "Failed to update member", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleListInvitations は GET /workspaces/{id}/invitations で未受諾の招待を一覧する (owner)
+func HandleListInvitations(db *sql.DB) http.HandlerFunc {
+	return workspaceHandler(db, model.RoleOwner, func(w http.ResponseWriter, r *http.Request, scope Scope, ws *model.Workspace) {
+		invitations, err := ListInvitations(db, scope.WorkspaceID)
+		if err != nil {
+			http.Error(w, "Failed to fetch invitations", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(invitations)
+	})
+}
+
+// HandleCreateInvitation は POST /workspaces/{id}/invitations で招待を作成する (owner)
+func HandleCreateInvitation(db *sql.DB) http.HandlerFunc {
+	return workspaceHandler(db, model.RoleOwner, func(w http.ResponseWriter, r *http.Request, scope Scope, ws *model.Workspace) {
+		var input struct {
+			Email string `json:"email"`
+			Role  string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if input.Role == "" {
+			input.Role = model.RoleEditor
+		}
+		if !strings.Contains(input.Email, "@") {
+			http.Error(w, "A valid email is required", http.StatusBadRequest)
+			return
+		}
+		inv := &model.WorkspaceInvitation{
+			WorkspaceID: scope.WorkspaceID,
+			Email:       input.Email,
+			Role:        input.Role,
+			InvitedBy:   scope.UserID,
+		}
+		err := CreateInvitation(db, inv)
+		switch {
+		case errors.Is(err, ErrInvalidRole):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrPersonal), errors.Is(err, ErrAlreadyMember):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			log.Printf("CreateInvitation error: %v", err)
+			http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
+		default:
+			// トークンはこの応答でしか返さない
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(inv)
+		}
+	})
+}
+
+// HandleRevokeInvitation は DELETE /workspaces/{id}/invitations/{invitation_id} で招待を取り消す (owner)
+func HandleRevokeInvitation(db *sql.DB) http.HandlerFunc {
+	return workspaceHandler(db, model.RoleOwner, func(w http.ResponseWriter, r *http.Request, scope Scope, ws *model.Workspace) {
+		id, err := strconv.ParseInt(r.PathValue("invitation_id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		err = RevokeInvitation(db, scope.WorkspaceID, id)
+		if errors.Is(err, ErrInvitationInvalid) {
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to revoke invitation", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// HandleAcceptInvitation は POST /invitations/accept で招待を受諾する
+func HandleAcceptInvitation(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := userFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+			http.Error(w, "token is required", http.StatusBadRequest)
+			return
+		}
+		ws, err := AcceptInvitation(db, input.Token, userID)
+		if errors.Is(err, ErrInvitationInvalid) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("AcceptInvitation error: %v", err)
+			http.Error(w, "Failed to accept invitation", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ws)
+	}
+}
@@ -0,0 +1,482 @@
+package workspace
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"faq-search-ai/internal/model"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// InvitationTTL は招待の有効期間
+const InvitationTTL = 7 * 24 * time.Hour
+
+// PersonalName は個人用ワークスペースの名前
+const PersonalName = "Personal"
+
+// Querier は *sql.DB と *sql.Tx のどちらでも受け取れるようにするためのもの
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// EnsurePersonal はユーザーの個人用ワークスペースのIDを返し、無ければ作成する。
+// ワークスペースと所有者の行は別々に書き込むので、所有者の行が欠けていれば補う
+func EnsurePersonal(q Querier, userID int64) (int64, error) {
+	var id int64
+	err := q.QueryRow(`SELECT id FROM workspaces WHERE created_by = ? AND personal = 1`, userID).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		result, err := q.Exec(`INSERT INTO workspaces (name, personal, created_by, created_at) VALUES (?, 1, ?, ?)`, PersonalName, userID, time.Now())
+		if isUniqueViolation(err) {
+			// 同時に作成された場合は先に作られた方を使う
+			return EnsurePersonal(q, userID)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return 0, err
+		}
+	case err != nil:
+		return 0, err
+	default:
+		// 読み取りのたびに書き込まないよう、欠けているときだけ追加する
+		if _, err := memberRole(q, id, userID); !errors.Is(err, ErrNotMember) {
+			return id, err
+		}
+	}
+	_, err = q.Exec(`INSERT OR IGNORE INTO workspace_members (workspace_id, user_id, role, created_at) VALUES (?, ?, ?, ?)`, id, userID, model.RoleOwner, time.Now())
+	return id, err
+}
+
+func memberRole(q Querier, workspaceID, userID int64) (string, error) {
+	var role string
+	err := q.QueryRow(`SELECT role FROM workspace_members WHERE workspace_id = ? AND user_id = ?`, workspaceID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotMember
+	}
+	return role, err
+}
+
+// ListWorkspaces はユーザーが所属するワークスペースを、個人用を先頭にして返す
+func ListWorkspaces(db *sql.DB, userID int64) ([]model.Workspace, error) {
+	if _, err := EnsurePersonal(db, userID); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT w.id, w.name, w.personal, m.role, w.created_by, w.created_at
+		FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id
+		WHERE m.user_id = ? ORDER BY w.personal DESC, w.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []model.Workspace{}
+	for rows.Next() {
+		var ws model.Workspace
+		if err := rows.Scan(&ws.ID, &ws.Name, &ws.Personal, &ws.Role, &ws.CreatedBy, &ws.CreatedAt); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, ws)
+	}
+	return workspaces, rows.Err()
+}
+
+// GetWorkspace はユーザーが所属するワークスペースを返す。所属していなければ nil
+func GetWorkspace(db *sql.DB, id, userID int64) (*model.Workspace, error) {
+	var ws model.Workspace
+	err := db.QueryRow(`
+		SELECT w.id, w.name, w.personal, m.role, w.created_by, w.created_at
+		FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id
+		WHERE w.id = ? AND m.user_id = ?`, id, userID).
+		Scan(&ws.ID, &ws.Name, &ws.Personal, &ws.Role, &ws.CreatedBy, &ws.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+// CreateWorkspace はチーム用のワークスペースを作り、作成者をオーナーにする
+func CreateWorkspace(db *sql.DB, ws *model.Workspace) error {
+	now := time.Now()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO workspaces (name, personal, created_by, created_at) VALUES (?, 0, ?, ?)`, ws.Name, ws.CreatedBy, now)
+	if err != nil {
+		return err
+	}
+	if ws.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO workspace_members (workspace_id, user_id, role, created_at) VALUES (?, ?, ?, ?)`, ws.ID, ws.CreatedBy, model.RoleOwner, now); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	ws.Personal, ws.Role, ws.CreatedAt = false, model.RoleOwner, now
+	return nil
+}
+
+func RenameWorkspace(db *sql.DB, id int64, name string) error {
+	_, err := db.Exec(`UPDATE workspaces SET name = ? WHERE id = ?`, name, id)
+	return err
+}
+
+// DeleteWorkspace は空のチーム用ワークスペースを削除する
+func DeleteWorkspace(db *sql.DB, id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var personal bool
+	err = tx.QueryRow(`SELECT personal FROM workspaces WHERE id = ?`, id).Scan(&personal)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if personal {
+		return ErrPersonal
+	}
+
+	var count int
+	if err := tx.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM faqs WHERE workspace_id = ?) +
+			(SELECT COUNT(*) FROM knowledge_bases WHERE workspace_id = ?)`, id, id).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrNotEmpty
+	}
+
+	for _, stmt := range []string{
+		`DELETE FROM workspace_invitations WHERE workspace_id = ?`,
+		`DELETE FROM workspace_members WHERE workspace_id = ?`,
+		`DELETE FROM workspaces WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func ListMembers(db *sql.DB, workspaceID int64) ([]model.WorkspaceMember, error) {
+	rows, err := db.Query(`
+		SELECT m.workspace_id, m.user_id, u.email, u.username, m.role, m.created_at
+		FROM workspace_members m JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = ? ORDER BY m.created_at, m.user_id`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []model.WorkspaceMember{}
+	for rows.Next() {
+		var m model.WorkspaceMember
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Email, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetMemberRole はメンバーの役割を変更する。最後のオーナーは降格できない
+func SetMemberRole(db *sql.DB, workspaceID, userID int64, role string) error {
+	if !ValidRole(role) {
+		return ErrInvalidRole
+	}
+	return changeMember(db, workspaceID, userID, role != model.RoleOwner, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE workspace_members SET role = ? WHERE workspace_id = ? AND user_id = ?`, role, workspaceID, userID)
+		return err
+	})
+}
+
+// RemoveMember はメンバーをワークスペースから外す。最後のオーナーは外せない
+func RemoveMember(db *sql.DB, workspaceID, userID int64) error {
+	return changeMember(db, workspaceID, userID, true, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM workspace_members WHERE workspace_id = ? AND user_id = ?`, workspaceID, userID)
+		return err
+	})
+}
+
+// changeMember は userID がメンバーであることを確かめてから fn を実行する。
+// dropsOwner が true ならオーナーが居なくならないことも確かめる
+func changeMember(db *sql.DB, workspaceID, userID int64, dropsOwner bool, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := memberRole(tx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if dropsOwner && current == model.RoleOwner {
+		var owners int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM workspace_members WHERE workspace_id = ? AND role = ?`, workspaceID, model.RoleOwner).Scan(&owners); err != nil {
+			return err
+		}
+		if owners <= 1 {
+			return ErrLastOwner
+		}
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SoleMemberWorkspaces はユーザーだけが所属するワークスペース (個人用を含む) を返す。退会時に中身ごと削除する
+func SoleMemberWorkspaces(db *sql.DB, userID int64) ([]int64, error) {
+	rows, err := db.Query(`
+		SELECT m.workspace_id FROM workspace_members m
+		WHERE m.user_id = ? AND NOT EXISTS (
+			SELECT 1 FROM workspace_members o WHERE o.workspace_id = m.workspace_id AND o.user_id <> m.user_id)
+		ORDER BY m.workspace_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SoleOwnedShared はユーザーが唯一のオーナーで、他のメンバーがいるワークスペースを返す。
+// 退会する前に他のメンバーをオーナーにしてもらう
+func SoleOwnedShared(db *sql.DB, userID int64) ([]int64, error) {
+	rows, err := db.Query(`
+		SELECT m.workspace_id FROM workspace_members m
+		WHERE m.user_id = ? AND m.role = ?
+			AND NOT EXISTS (SELECT 1 FROM workspace_members o
+				WHERE o.workspace_id = m.workspace_id AND o.user_id <> m.user_id AND o.role = ?)
+			AND EXISTS (SELECT 1 FROM workspace_members o
+				WHERE o.workspace_id = m.workspace_id AND o.user_id <> m.user_id)
+		ORDER BY m.workspace_id`, userID, model.RoleOwner, model.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// RemoveUser は退会するユーザーを全てのワークスペースから外し、workspaceIDs (中身を削除済みのもの) を削除する。
+// オーナーが居なくなるワークスペースでは、最も古くから所属するメンバーをオーナーにする
+func RemoveUser(db *sql.DB, userID int64, workspaceIDs []int64) error {
+	orphaned, err := SoleOwnedShared(db, userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range orphaned {
+		if _, err := tx.Exec(`
+			UPDATE workspace_members SET role = ?
+			WHERE workspace_id = ? AND user_id = (
+				SELECT user_id FROM workspace_members WHERE workspace_id = ? AND user_id <> ?
+				ORDER BY created_at, user_id LIMIT 1)`, model.RoleOwner, id, id, userID); err != nil {
+			return err
+		}
+	}
+	for _, id := range workspaceIDs {
+		for _, stmt := range []string{
+			`DELETE FROM workspace_invitations WHERE workspace_id = ?`,
+			`DELETE FROM workspace_members WHERE workspace_id = ?`,
+			`DELETE FROM workspaces WHERE id = ?`,
+		} {
+			if _, err := tx.Exec(stmt, id); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM workspace_members WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateInvitation は招待を作成し、inv.Token に招待トークンを設定する
+func CreateInvitation(db *sql.DB, inv *model.WorkspaceInvitation) error {
+	if !ValidRole(inv.Role) {
+		return ErrInvalidRole
+	}
+	inv.Email = strings.ToLower(strings.TrimSpace(inv.Email))
+
+	var personal bool
+	err := db.QueryRow(`SELECT personal FROM workspaces WHERE id = ?`, inv.WorkspaceID).Scan(&personal)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if personal {
+		return ErrPersonal
+	}
+
+	var exists int
+	err = db.QueryRow(`
+		SELECT 1 FROM workspace_members m JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = ? AND lower(u.email) = ?`, inv.WorkspaceID, inv.Email).Scan(&exists)
+	if err == nil {
+		return ErrAlreadyMember
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	inv.CreatedAt, inv.ExpiresAt = now, now.Add(InvitationTTL)
+	result, err := db.Exec(`
+		INSERT INTO workspace_invitations (workspace_id, email, role, token_hash, invited_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, inv.WorkspaceID, inv.Email, inv.Role, hashToken(token), inv.InvitedBy, inv.CreatedAt, inv.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	if inv.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	inv.Token = token
+	return nil
+}
+
+// ListInvitations は受諾されておらず期限内の招待を返す
+func ListInvitations(db *sql.DB, workspaceID int64) ([]model.WorkspaceInvitation, error) {
+	rows, err := db.Query(`
+		SELECT id, workspace_id, email, role, invited_by, created_at, expires_at
+		FROM workspace_invitations
+		WHERE workspace_id = ? AND accepted_at IS NULL AND expires_at > ?
+		ORDER BY id`, workspaceID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []model.WorkspaceInvitation{}
+	for rows.Next() {
+		var inv model.WorkspaceInvitation
+		if err := rows.Scan(&inv.ID, &inv.WorkspaceID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.CreatedAt, &inv.ExpiresAt); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+func RevokeInvitation(db *sql.DB, workspaceID, id int64) error {
+	result, err := db.Exec(`DELETE FROM workspace_invitations WHERE id = ? AND workspace_id = ? AND accepted_at IS NULL`, id, workspaceID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvitationInvalid
+	}
+	return nil
+}
+
+// AcceptInvitation は招待トークンを使って userID をワークスペースに加える。
+// 招待されたメールアドレスのユーザーしか受諾できない
+func AcceptInvitation(db *sql.DB, token string, userID int64) (*model.Workspace, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var inv model.WorkspaceInvitation
+	err = tx.QueryRow(`
+		SELECT i.id, i.workspace_id, i.role FROM workspace_invitations i, users u
+		WHERE i.token_hash = ? AND i.accepted_at IS NULL AND i.expires_at > ?
+			AND u.id = ? AND lower(u.email) = i.email`, hashToken(token), time.Now(), userID).
+		Scan(&inv.ID, &inv.WorkspaceID, &inv.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	// 既にメンバーなら役割は変えない
+	if _, err := tx.Exec(`
+		INSERT INTO workspace_members (workspace_id, user_id, role, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(workspace_id, user_id) DO NOTHING`, inv.WorkspaceID, userID, inv.Role, now); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE workspace_invitations SET accepted_by = ?, accepted_at = ? WHERE id = ?`, userID, now, inv.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetWorkspace(db, inv.WorkspaceID, userID)
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
@@ -0,0 +1,104 @@
+package workspace
+
+import (
+	"database/sql"
+	"errors"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/model"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// HeaderName はリクエスト対象のワークスペースを指定するヘッダー。省略時は個人用ワークスペース
+const HeaderName = "X-Workspace-ID"
+
+var (
+	ErrNotFound          = errors.New("workspace not found")
+	ErrNotMember         = errors.New("not a member of this workspace")
+	ErrInvalidRole       = errors.New("role must be owner, editor or viewer")
+	ErrLastOwner         = errors.New("workspace must keep at least one owner")
+	ErrPersonal          = errors.New("personal workspaces cannot be shared")
+	ErrNotEmpty          = errors.New("workspace still has FAQs or knowledge bases")
+	ErrAlreadyMember     = errors.New("user is already a member")
+	ErrInvitationInvalid = errors.New("invitation is invalid or expired")
+)
+
+// roleRank は権限の強さ。上位の役割は下位の操作を全て行える
+var roleRank = map[string]int{
+	model.RoleViewer: 1,
+	model.RoleEditor: 2,
+	model.RoleOwner:  3,
+}
+
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// Scope はリクエストを処理するユーザーと対象のワークスペース
+type Scope struct {
+	UserID      int64
+	WorkspaceID int64
+	Role        string
+}
+
+// Allows は role 以上の権限を持っているかを返す
+func (s Scope) Allows(role string) bool {
+	return roleRank[s.Role] >= roleRank[role]
+}
+
+// Resolve はユーザーが requested のワークスペースで持つ役割を返す。
+// requested が空なら個人用ワークスペースを（無ければ作成して）使う
+func Resolve(db *sql.DB, userID int64, requested string) (Scope, error) {
+	scope := Scope{UserID: userID}
+	if requested == "" {
+		id, err := EnsurePersonal(db, userID)
+		if err != nil {
+			return scope, err
+		}
+		scope.WorkspaceID, scope.Role = id, model.RoleOwner
+		return scope, nil
+	}
+
+	id, err := strconv.ParseInt(requested, 10, 64)
+	if err != nil {
+		return scope, ErrNotFound
+	}
+	role, err := memberRole(db, id, userID)
+	if err != nil {
+		return scope, err
+	}
+	scope.WorkspaceID, scope.Role = id, role
+	return scope, nil
+}
+
+// FromRequest は認証済みリクエストのスコープを解決し、role 未満の権限なら 403 を書き込む
+func FromRequest(db *sql.DB, w http.ResponseWriter, r *http.Request, role string) (Scope, bool) {
+	userID, ok := r.Context().Value(auth.UserIDContextKey).(int64)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return Scope{}, false
+	}
+	scope, err := Resolve(db, userID, r.Header.Get(HeaderName))
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrNotMember) {
+		// 所属していないワークスペースの存在は明かさない
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return scope, false
+	}
+	if err != nil {
+		log.Printf("workspace.Resolve error: %v", err)
+		http.Error(w, "Failed to resolve workspace", http.StatusInternalServerError)
+		return scope, false
+	}
+	return scope, Require(w, scope, role)
+}
+
+// Require は role 未満の権限なら 403 を書き込んで false を返す
+func Require(w http.ResponseWriter, scope Scope, role string) bool {
+	if scope.Allows(role) {
+		return true
+	}
+	http.Error(w, "Forbidden: requires "+role+" role", http.StatusForbidden)
+	return false
+}
@@ -0,0 +1,191 @@
+package workspace_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"faq-search-ai/internal/auth"
+	"faq-search-ai/internal/config"
+	"faq-search-ai/internal/faq"
+	"faq-search-ai/internal/model"
+	"faq-search-ai/internal/workspace"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	for _, email := range []string{"owner@example.com", "editor@example.com", "viewer@example.com", "other@example.com"} {
+		if _, err := db.Exec(`INSERT INTO users (email, username, password_hash) VALUES (?, ?, 'x')`, email, email); err != nil {
+			t.Fatalf("failed to insert user: %v", err)
+		}
+	}
+	return db
+}
+
+func serve(h http.HandlerFunc, userID, workspaceID int64, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if workspaceID != 0 {
+		req.Header.Set(workspace.HeaderName, strconv.FormatInt(workspaceID, 10))
+	}
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserIDContextKey, userID))
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+// routes は本番のルーターと同じパターンでワークスペースのハンドラーを振り分ける
+func routes(db *sql.DB) http.HandlerFunc {
+	mux := http.NewServeMux()
+	for pattern, h := range map[string]http.HandlerFunc{
+		"GET /workspaces":                                     workspace.HandleListWorkspaces(db),
+		"POST /workspaces":                                    workspace.HandleCreateWorkspace(db),
+		"GET /workspaces/{id}":                                workspace.HandleGetWorkspace(db),
+		"PATCH /workspaces/{id}":                              workspace.HandleRenameWorkspace(db),
+		"DELETE /workspaces/{id}":                             workspace.HandleDeleteWorkspace(db),
+		"GET /workspaces/{id}/members":                        workspace.HandleListMembers(db),
+		"PATCH /workspaces/{id}/members/{user_id}":            workspace.HandleUpdateMember(db),
+		"DELETE /workspaces/{id}/members/{user_id}":           workspace.HandleRemoveMember(db),
+		"GET /workspaces/{id}/invitations":                    workspace.HandleListInvitations(db),
+		"POST /workspaces/{id}/invitations":                   workspace.HandleCreateInvitation(db),
+		"DELETE /workspaces/{id}/invitations/{invitation_id}": workspace.HandleRevokeInvitation(db),
+	} {
+		mux.HandleFunc(pattern, h)
+	}
+	return mux.ServeHTTP
+}
+
+func TestInvitationsAndRoles(t *testing.T) {
+	db := setupTestDB(t)
+	workspaces := routes(db)
+	accept := workspace.HandleAcceptInvitation(db)
+	faqMux := http.NewServeMux()
+	faqMux.HandleFunc("GET /faqs", faq.HandleListFAQs(db))
+	faqMux.HandleFunc("POST /faqs", faq.HandleCreateFAQ(db))
+	faqs := faqMux.ServeHTTP
+
+	rec := serve(workspaces, 1, 0, http.MethodPost, "/workspaces", map[string]string{"name": "Support"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d", rec.Code)
+	}
+	var ws model.Workspace
+	json.NewDecoder(rec.Body).Decode(&ws)
+	base := "/workspaces/" + strconv.FormatInt(ws.ID, 10)
+
+	invite := func(email, role string) string {
+		rec := serve(workspaces, 1, 0, http.MethodPost, base+"/invitations", map[string]string{"email": email, "role": role})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("invite %s: expected 201, got %d", email, rec.Code)
+		}
+		var inv model.WorkspaceInvitation
+		json.NewDecoder(rec.Body).Decode(&inv)
+		return inv.Token
+	}
+	editorToken := invite("Editor@Example.com", model.RoleEditor)
+	viewerToken := invite("viewer@example.com", model.RoleViewer)
+
+	// 宛先と異なるユーザーは受諾できない
+	if _, err := workspace.AcceptInvitation(db, editorToken, 4); !errors.Is(err, workspace.ErrInvitationInvalid) {
+		t.Errorf("expected ErrInvitationInvalid for another user, got %v", err)
+	}
+	if rec := serve(accept, 2, 0, http.MethodPost, "/invitations/accept", map[string]string{"token": editorToken}); rec.Code != http.StatusOK {
+		t.Fatalf("accept editor: expected 200, got %d", rec.Code)
+	}
+	if rec := serve(accept, 3, 0, http.MethodPost, "/invitations/accept", map[string]string{"token": viewerToken}); rec.Code != http.StatusOK {
+		t.Fatalf("accept viewer: expected 200, got %d", rec.Code)
+	}
+	// 受諾済みのトークンは使えない
+	if rec := serve(accept, 3, 0, http.MethodPost, "/invitations/accept", map[string]string{"token": viewerToken}); rec.Code != http.StatusNotFound {
+		t.Errorf("reuse: expected 404, got %d", rec.Code)
+	}
+
+	draft := map[string]string{"question": "q", "answer": "a", "status": model.StatusDraft}
+	if rec := serve(faqs, 3, ws.ID, http.MethodPost, "/faqs", draft); rec.Code != http.StatusForbidden {
+		t.Errorf("viewer create: expected 403, got %d", rec.Code)
+	}
+	if rec := serve(faqs, 2, ws.ID, http.MethodPost, "/faqs", draft); rec.Code != http.StatusCreated {
+		t.Fatalf("editor create: expected 201, got %d", rec.Code)
+	}
+	if rec := serve(faqs, 4, ws.ID, http.MethodGet, "/faqs", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("non-member: expected 404, got %d", rec.Code)
+	}
+
+	// 編集者の作成したFAQは他のメンバーにも見え、個人用ワークスペースには入らない
+	for userID, want := range map[int64]int{1: 1, 3: 1} {
+		rec := serve(faqs, userID, ws.ID, http.MethodGet, "/faqs", nil)
+		var list []model.FAQ
+		json.NewDecoder(rec.Body).Decode(&list)
+		if len(list) != want {
+			t.Errorf("user %d: expected %d shared faqs, got %d", userID, want, len(list))
+		}
+	}
+	rec = serve(faqs, 2, 0, http.MethodGet, "/faqs", nil)
+	var personal []model.FAQ
+	json.NewDecoder(rec.Body).Decode(&personal)
+	if len(personal) != 0 {
+		t.Errorf("expected empty personal workspace, got %d faqs", len(personal))
+	}
+
+	if rec := serve(workspaces, 2, 0, http.MethodPatch, base+"/members/3", map[string]string{"role": model.RoleEditor}); rec.Code != http.StatusForbidden {
+		t.Errorf("editor changing roles: expected 403, got %d", rec.Code)
+	}
+	if rec := serve(workspaces, 1, 0, http.MethodPatch, base+"/members/1", map[string]string{"role": model.RoleViewer}); rec.Code != http.StatusConflict {
+		t.Errorf("demoting last owner: expected 409, got %d", rec.Code)
+	}
+	if rec := serve(workspaces, 3, 0, http.MethodDelete, base+"/members/3", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("leaving: expected 204, got %d", rec.Code)
+	}
+	if rec := serve(faqs, 3, ws.ID, http.MethodGet, "/faqs", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("after leaving: expected 404, got %d", rec.Code)
+	}
+	if rec := serve(workspaces, 1, 0, http.MethodDelete, base, nil); rec.Code != http.StatusConflict {
+		t.Errorf("deleting non-empty workspace: expected 409, got %d", rec.Code)
+	}
+}
+
+func TestPersonalWorkspace(t *testing.T) {
+	db := setupTestDB(t)
+
+	first, err := workspace.EnsurePersonal(db, 1)
+	if err != nil {
+		t.Fatalf("EnsurePersonal failed: %v", err)
+	}
+	again, _ := workspace.EnsurePersonal(db, 1)
+	if first != again {
+		t.Errorf("expected the same personal workspace, got %d and %d", first, again)
+	}
+
+	// 所有者の行を書き込む前に失敗していても、次の呼び出しで補う
+	db.Exec(`DELETE FROM workspace_members WHERE workspace_id = ?`, first)
+	if again, err := workspace.EnsurePersonal(db, 1); err != nil || again != first {
+		t.Fatalf("expected to repair the personal workspace, got %d (%v)", again, err)
+	}
+	if ws, err := workspace.GetWorkspace(db, first, 1); err != nil || ws == nil || ws.Role != model.RoleOwner {
+		t.Errorf("expected the owner to be restored, got %+v (%v)", ws, err)
+	}
+
+	inv := &model.WorkspaceInvitation{WorkspaceID: first, Email: "editor@example.com", Role: model.RoleEditor, InvitedBy: 1}
+	if err := workspace.CreateInvitation(db, inv); !errors.Is(err, workspace.ErrPersonal) {
+		t.Errorf("expected ErrPersonal, got %v", err)
+	}
+	if err := workspace.DeleteWorkspace(db, first); !errors.Is(err, workspace.ErrPersonal) {
+		t.Errorf("expected ErrPersonal on delete, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+'use client'
+
+import { useRouter } from 'next/navigation'
+import { useEffect, useState, type ChangeEvent } from 'react'
+import { Button } from "@/components/ui/button"
+import { Input } from "@/components/ui/input"
+import { Label } from "@/components/ui/label"
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { Alert, AlertDescription } from "@/components/ui/alert"
+import { saveSession, signinMFA } from '@/services/api'
+
+// Single sign-on returns here with the tokens, or an MFA challenge, in the
+// URL fragment so they never reach server logs.
+export default function AuthCallbackPage() {
+  const [mfaToken, setMfaToken] = useState("")
+  const [code, setCode] = useState("")
+  const [message, setMessage] = useState("")
+  const [isLoading, setIsLoading] = useState(false)
+  const router = useRouter()
+
+  useEffect(() => {
+    const fragment = new URLSearchParams(window.location.hash.slice(1))
+    // Drop the tokens from the address bar and history
+    window.history.replaceState(null, '', window.location.pathname)
+
+    const token = fragment.get('token')
+    const refreshToken = fragment.get('refresh_token')
+    if (token && refreshToken) {
+      saveSession({ token, refresh_token: refreshToken })
+      router.replace('/knowledge')
+      return
+    }
+    const challenge = fragment.get('mfa_token')
+    if (fragment.get('mfa_required') === 'true' && challenge) {
+      setMfaToken(challenge)
+      return
+    }
+    setMessage('Sign-in did not complete. Please try again.')
+  }, [])
+
+  const handleVerify = async () => {
+    setIsLoading(true)
+    try {
+      saveSession(await signinMFA(mfaToken, code))
+      router.replace('/knowledge')
+    } catch (error) {
+      setMessage((error as Error).message || 'Login failed')
+    } finally {
+      setIsLoading(false)
+    }
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-blue-50 to-indigo-100 p-4">
+      <Card className="w-full max-w-md shadow-xl">
+        <CardHeader className="space-y-1">
+          <CardTitle className="text-2xl font-bold text-center">Signing In</CardTitle>
+          <CardDescription className="text-center text-muted-foreground">
+            {mfaToken ? "Enter the code from your authenticator app or a recovery code" : "Completing single sign-on"}
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          {mfaToken && (
+            <>
+              <div className="space-y-2">
+                <Label htmlFor="code" className="text-sm font-medium">
+                  Authentication Code
+                </Label>
+                <Input
+                  id="code"
+                  inputMode="numeric"
+                  autoComplete="one-time-code"
+                  placeholder="123456"
+                  value={code}
+                  onChange={(e: ChangeEvent<HTMLInputElement>) => setCode(e.target.value)}
+                  required
+                />
+              </div>
+              <Button onClick={handleVerify} className="w-full" disabled={isLoading || !code}>
+                {isLoading ? "Verifying..." : "Verify"}
+              </Button>
+            </>
+          )}
+
+          {message && (
+            <Alert className="border-red-200 bg-red-50">
+              <AlertDescription className="text-red-800">{message}</AlertDescription>
+            </Alert>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
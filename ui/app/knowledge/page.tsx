@@ -8,7 +8,7 @@ import { Input } from "@/components/ui/input"
 import { Textarea } from "@/components/ui/textarea"
 import { Badge } from "@/components/ui/badge"
 import { Plus, Edit3, Trash2, Search, BookOpen, MessageCircleQuestion, Sparkles, Save, X, Brain } from "lucide-react"
-import { askFAQ, createFAQ, deleteFAQ, fetchFAQs, updateFAQ } from "@/services/api"
+import { askFAQ, createFAQ, deleteFAQ, fetchFAQs, hasSession, updateFAQ } from "@/services/api"
 
 type FAQ = {
   id: string
@@ -21,7 +21,7 @@ export default function KnowledgePage() {
   const [question, setQuestion] = useState("")
   const [answer, setAnswer] = useState("")
   const [editingId, setEditingId] = useState<string | null>(null)
-  const [token, setToken] = useState<string | null>(null)
+  const [signedIn, setSignedIn] = useState(false)
   const router = useRouter()
 
   const [searchQuestion, setSearchQuestion] = useState("")
@@ -30,25 +30,28 @@ export default function KnowledgePage() {
   const [showSearchResult, setShowSearchResult] = useState(false)
 
   useEffect(() => {
-    const storedToken = localStorage.getItem("token")
-    if (!storedToken) {
+    if (!hasSession()) {
       router.push("/signin")
       return
     }
-    setToken(storedToken)
+    setSignedIn(true)
   }, [])
 
   useEffect(() => {
-    if(token) {
-      fetchFAQs(token).then(setFaqs).catch(console.error)
+    if(signedIn) {
+      fetchFAQs().then(setFaqs).catch((e) => {
+        console.error(e)
+        // The refresh token has expired too, so sign in again
+        if (!hasSession()) router.push("/signin")
+      })
     }
-  }, [token])
+  }, [signedIn])
 
   const createNewFAQ = async () => {
     if (!question || !answer) return
      try {
-      await createFAQ(token!, question, answer)
-      const updatedFaqs = await fetchFAQs(token!)
+      await createFAQ(question, answer)
+      const updatedFaqs = await fetchFAQs()
       setFaqs(updatedFaqs)
       setQuestion("")
       setAnswer("")
@@ -60,8 +63,8 @@ export default function KnowledgePage() {
   const updateExistingFAQ = async () => {
     if (!editingId) return
     try {
-      await updateFAQ(token!, editingId, question, answer)
-      const updatedFaqs = await fetchFAQs(token!)
+      await updateFAQ(editingId, question, answer)
+      const updatedFaqs = await fetchFAQs()
       setFaqs(updatedFaqs)
       setEditingId(null)
       setQuestion("")
@@ -73,8 +76,8 @@ export default function KnowledgePage() {
 
   const deleteExistingFAQ = async (id: string) => {
     try {
-      await deleteFAQ(token!, id)
-      const updatedFaqs = await fetchFAQs(token!)
+      await deleteFAQ(id)
+      const updatedFaqs = await fetchFAQs()
       setFaqs(updatedFaqs)
     } catch (e) {
       console.error(e)
@@ -91,7 +94,7 @@ export default function KnowledgePage() {
     if (!searchQuestion) return
     setIsSearching(true)
     try {
-      const data = await askFAQ(token!, searchQuestion)
+      const data = await askFAQ(searchQuestion)
       setSearchResult(data.answer)
       setShowSearchResult(true)
     } catch (e) {
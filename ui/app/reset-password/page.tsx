@@ -0,0 +1,76 @@
+'use client'
+
+import { useRouter } from 'next/navigation'
+import { useEffect, useState, type ChangeEvent } from 'react'
+import { Button } from "@/components/ui/button"
+import { Input } from "@/components/ui/input"
+import { Label } from "@/components/ui/label"
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { Alert, AlertDescription } from "@/components/ui/alert"
+import { resetPassword } from '@/services/api'
+
+// Password reset emails link here with ?token=...
+export default function ResetPasswordPage() {
+  const [token, setToken] = useState("")
+  const [password, setPassword] = useState("")
+  const [message, setMessage] = useState("")
+  const [isLoading, setIsLoading] = useState(false)
+  const router = useRouter()
+
+  useEffect(() => {
+    const t = new URLSearchParams(window.location.search).get('token')
+    if (t) setToken(t)
+    else setMessage('The reset link is missing its token.')
+  }, [])
+
+  const handleReset = async () => {
+    setIsLoading(true)
+    try {
+      await resetPassword(token, password)
+      router.push('/signin')
+    } catch (error) {
+      setMessage((error as Error).message || 'Password reset failed')
+    } finally {
+      setIsLoading(false)
+    }
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-blue-50 to-indigo-100 p-4">
+      <Card className="w-full max-w-md shadow-xl">
+        <CardHeader className="space-y-1">
+          <CardTitle className="text-2xl font-bold text-center">Reset Password</CardTitle>
+          <CardDescription className="text-center text-muted-foreground">
+            Choose a new password. You will be signed out everywhere else.
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          <div className="space-y-2">
+            <Label htmlFor="password" className="text-sm font-medium">
+              New Password
+            </Label>
+            <Input
+              id="password"
+              type="password"
+              autoComplete="new-password"
+              placeholder="Enter a new password"
+              value={password}
+              onChange={(e: ChangeEvent<HTMLInputElement>) => setPassword(e.target.value)}
+              required
+            />
+          </div>
+
+          <Button onClick={handleReset} className="w-full" disabled={isLoading || !token || !password}>
+            {isLoading ? "Saving..." : "Set Password"}
+          </Button>
+
+          {message && (
+            <Alert className="border-red-200 bg-red-50">
+              <AlertDescription className="text-red-800">{message}</AlertDescription>
+            </Alert>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
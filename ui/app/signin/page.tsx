@@ -9,7 +9,7 @@ import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/com
 import { Alert, AlertDescription } from "@/components/ui/alert"
 import { Mail, Lock, Eye, EyeOff } from "lucide-react"
 import { sign } from 'crypto'
-import { signin } from '@/services/api'
+import { saveSession, signin, signinMFA } from '@/services/api'
 
 export default function SigninPage() {
   const [email, setEmail] = useState("")
@@ -17,14 +17,22 @@ export default function SigninPage() {
   const [showPassword, setShowPassword] = useState(false)
   const [message, setMessage] = useState("")
   const [isLoading, setIsLoading] = useState(false)
+  const [mfaToken, setMfaToken] = useState("")
+  const [code, setCode] = useState("")
   const router = useRouter()
   const BASE_URL = process.env.NEXT_PUBLIC_API_BASE_URL
 
   const handleSignin = async () => {
     setIsLoading(true)
     try {
-      const data = await signin(email, password)
-      localStorage.setItem('token', data.token)
+      // Accounts with two-factor authentication finish signing in with a code
+      const data = mfaToken ? await signinMFA(mfaToken, code) : await signin(email, password)
+      if ('mfa_required' in data) {
+        setMfaToken(data.mfa_token)
+        setMessage('Enter the code from your authenticator app or a recovery code')
+        return
+      }
+      saveSession(data)
       setMessage('Login successful!')
       router.push('/knowledge')
     } catch (error) {
@@ -92,6 +100,23 @@ export default function SigninPage() {
             </div>
           </div>
 
+          {mfaToken && (
+            <div className="space-y-2">
+              <Label htmlFor="code" className="text-sm font-medium">
+                Authentication Code
+              </Label>
+              <Input
+                id="code"
+                inputMode="numeric"
+                autoComplete="one-time-code"
+                placeholder="123456"
+                value={code}
+                onChange={(e: ChangeEvent<HTMLInputElement>) => setCode(e.target.value)}
+                required
+              />
+            </div>
+          )}
+
           <Button
             onClick={handleSignin}
             className="w-full bg-gradient-to-r from-blue-600 to-indigo-600 hover:from-blue-700 hover:to-indigo-700 text-white font-medium py-2.5 transition-all duration-200 transform hover:scale-[1.02]"
@@ -0,0 +1,57 @@
+'use client'
+
+import Link from 'next/link'
+import { useEffect, useState } from 'react'
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { Alert, AlertDescription } from "@/components/ui/alert"
+import { verifyEmail } from '@/services/api'
+
+// Verification emails link here with ?token=...
+export default function VerifyEmailPage() {
+  const [status, setStatus] = useState<'verifying' | 'verified' | 'failed'>('verifying')
+  const [message, setMessage] = useState("")
+
+  useEffect(() => {
+    const token = new URLSearchParams(window.location.search).get('token')
+    if (!token) {
+      setStatus('failed')
+      setMessage('The verification link is missing its token.')
+      return
+    }
+    verifyEmail(token)
+      .then(() => setStatus('verified'))
+      .catch((error: Error) => {
+        setStatus('failed')
+        setMessage(error.message)
+      })
+  }, [])
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-blue-50 to-indigo-100 p-4">
+      <Card className="w-full max-w-md shadow-xl">
+        <CardHeader className="space-y-1">
+          <CardTitle className="text-2xl font-bold text-center">Email Verification</CardTitle>
+          <CardDescription className="text-center text-muted-foreground">
+            {status === 'verifying' && "Verifying your email address..."}
+            {status === 'verified' && "Your email address has been verified."}
+            {status === 'failed' && "The link is invalid or has expired."}
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          {message && (
+            <Alert className="border-red-200 bg-red-50">
+              <AlertDescription className="text-red-800">{message}</AlertDescription>
+            </Alert>
+          )}
+          {status !== 'verifying' && (
+            <div className="text-center text-sm">
+              <Link href="/signin" className="text-blue-600 hover:text-blue-800 font-medium hover:underline">
+                Go to sign in
+              </Link>
+            </div>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
@@ -1,4 +1,71 @@
-const BASE_URL = process.env.NEXT_PUBLIC_API_BASE_URL
+const BASE_URL = `${process.env.NEXT_PUBLIC_API_BASE_URL}/api/v1`
+
+export type TokenPair = {
+  token: string
+  refresh_token: string
+  token_type: string
+  expires_in: number
+}
+
+export type MFAChallenge = {
+  mfa_required: true
+  mfa_token: string
+  expires_in: number
+}
+
+// Access tokens are short-lived, so the refresh token is kept alongside them
+// and traded for a new pair whenever the API answers 401.
+export function saveSession(pair: Pick<TokenPair, 'token' | 'refresh_token'>) {
+  localStorage.setItem('token', pair.token)
+  localStorage.setItem('refresh_token', pair.refresh_token)
+}
+
+export function clearSession() {
+  localStorage.removeItem('token')
+  localStorage.removeItem('refresh_token')
+}
+
+export function hasSession() {
+  return localStorage.getItem('token') !== null
+}
+
+let refreshing: Promise<boolean> | null = null
+
+// refreshSession shares one in-flight refresh between concurrent requests:
+// refresh tokens are single-use, and replaying one revokes the whole session.
+function refreshSession(): Promise<boolean> {
+  if (!refreshing) {
+    refreshing = (async () => {
+      const refreshToken = localStorage.getItem('refresh_token')
+      if (!refreshToken) return false
+      const res = await fetch(`${BASE_URL}/token/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: refreshToken }),
+      })
+      if (!res.ok) {
+        clearSession()
+        return false
+      }
+      saveSession(await res.json())
+      return true
+    })().finally(() => {
+      refreshing = null
+    })
+  }
+  return refreshing
+}
+
+async function authFetch(path: string, init: RequestInit = {}): Promise<Response> {
+  const send = () => {
+    const headers = new Headers(init.headers)
+    headers.set('Authorization', `Bearer ${localStorage.getItem('token')}`)
+    return fetch(`${BASE_URL}${path}`, { ...init, headers })
+  }
+  const res = await send()
+  if (res.status !== 401 || !(await refreshSession())) return res
+  return send()
+}
 
 export async function signup(email: string, username: string, password: string) {
   const res = await fetch(`${BASE_URL}/signup`, {
@@ -15,7 +82,9 @@ export async function signup(email: string, username: string, password: string)
   return res.json()
 }
 
-export async function signin(email: string, password: string): Promise<{ token: string }> {
+// signin returns either a token pair or, for accounts with two-factor
+// authentication, a challenge to complete with signinMFA.
+export async function signin(email: string, password: string): Promise<TokenPair | MFAChallenge> {
   const res = await fetch(`${BASE_URL}/login`, {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
@@ -28,61 +97,94 @@ export async function signin(email: string, password: string): Promise<{ token:
   }
 
   const data = await res.json()
+  if (data.mfa_required) return data as MFAChallenge
   if (!data.token) throw new Error('No token received')
 
-  return data
+  return data as TokenPair
 }
 
-export async function fetchFAQs(token: string) {
-  const res = await fetch(`${BASE_URL}/faqs`, {
-    headers: { Authorization: `Bearer ${token}` },
+export async function signinMFA(mfaToken: string, code: string): Promise<TokenPair> {
+  const res = await fetch(`${BASE_URL}/login/mfa`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ mfa_token: mfaToken, code }),
   })
+
+  if (!res.ok) {
+    const errorText = await res.text()
+    throw new Error(`Login failed: ${errorText}`)
+  }
+
+  return res.json()
+}
+
+export async function fetchFAQs() {
+  const res = await authFetch(`/faqs`)
   if (!res.ok) throw new Error("Failed to fetch FAQs")
   return res.json()
 }
 
-export async function createFAQ(token: string, question: string, answer: string) {
-  const res = await fetch(`${BASE_URL}/faqs`, {
+export async function createFAQ(question: string, answer: string) {
+  const res = await authFetch(`/faqs`, {
     method: "POST",
     headers: {
       "Content-Type": "application/json",
-      Authorization: `Bearer ${token}`,
     },
     body: JSON.stringify({ question, answer }),
   })
   if (!res.ok) throw new Error("Failed to create FAQ")
 }
 
-export async function updateFAQ(token: string, id: string, question: string, answer: string) {
-  const res = await fetch(`${BASE_URL}/faqs/${id}`, {
+export async function updateFAQ(id: string, question: string, answer: string) {
+  const res = await authFetch(`/faqs/${id}`, {
     method: "PUT",
     headers: {
       "Content-Type": "application/json",
-      Authorization: `Bearer ${token}`,
     },
     body: JSON.stringify({ question, answer }),
   })
   if (!res.ok) throw new Error("Failed to update FAQ")
 }
 
-export async function deleteFAQ(token: string, id: string) {
-  const res = await fetch(`${BASE_URL}/faqs/${id}`, {
+export async function deleteFAQ(id: string) {
+  const res = await authFetch(`/faqs/${id}`, {
     method: "DELETE",
-    headers: { Authorization: `Bearer ${token}` },
   })
   if (!res.ok) throw new Error("Failed to delete FAQ")
   return
 }
 
-export async function askFAQ(token: string, question: string) {
-  const res = await fetch(`${BASE_URL}/faqs/ask`, {
+export async function askFAQ(question: string) {
+  const res = await authFetch(`/faqs/ask`, {
     method: "POST",
     headers: {
       "Content-Type": "application/json",
-      Authorization: `Bearer ${token}`,
     },
     body: JSON.stringify({ question }),
   })
   if (!res.ok) throw new Error("Failed to get FAQ answer")
   return res.json()
-}
\ No newline at end of file
+}
+export async function searchFAQs(q: string) {
+  const res = await authFetch(`/faqs/search?q=${encodeURIComponent(q)}`)
+  if (!res.ok) throw new Error("Failed to search FAQs")
+  return res.json()
+}
+
+export async function verifyEmail(token: string) {
+  const res = await fetch(`${BASE_URL}/verify-email`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ token }),
+  })
+  if (!res.ok) throw new Error(`Verification failed: ${await res.text()}`)
+}
+
+export async function resetPassword(token: string, newPassword: string) {
+  const res = await fetch(`${BASE_URL}/password/reset`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ token, new_password: newPassword }),
+  })
+  if (!res.ok) throw new Error(`Password reset failed: ${await res.text()}`)
+}